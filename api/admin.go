@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"money-transfer-system/service"
+
+	"github.com/gorilla/mux"
+)
+
+// LimitsRequest represents a request to change an account's limits. A zero
+// max_transfer removes the limit.
+type LimitsRequest struct {
+	MaxTransfer json.RawMessage `json:"max_transfer"`
+}
+
+// ProfileRequest represents a request to replace an account holder's profile
+type ProfileRequest struct {
+	DisplayName string              `json:"display_name"`
+	Type        service.AccountType `json:"type"`
+	Contact     service.Contact     `json:"contact"`
+}
+
+// FreezeAccountHandler stops an account from sending or receiving transfers
+func (api *API) FreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	api.setStatus(w, r, service.StatusFrozen)
+}
+
+// UnfreezeAccountHandler makes a frozen account active again
+func (api *API) UnfreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	api.setStatus(w, r, service.StatusActive)
+}
+
+// setStatus changes the status of the account named in the URL. Closed
+// accounts stay closed.
+func (api *API) setStatus(w http.ResponseWriter, r *http.Request, status service.AccountStatus) {
+	account, ok := api.adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	if account.Status() == service.StatusClosed {
+		writeError(w, http.StatusConflict, "account_closed", service.ErrAccountClosed.Error())
+		return
+	}
+	account.SetStatus(status)
+
+	action := "account.frozen"
+	if status == service.StatusActive {
+		action = "account.unfrozen"
+	}
+	api.audit(r, action, map[string]interface{}{"username": account.Username})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// SetLimitsHandler replaces an account's transfer limits
+func (api *API) SetLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	var req LimitsRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	maxTransfer, fieldErr := parseOptionalAmount("max_transfer", req.MaxTransfer)
+	if fieldErr != nil {
+		writeValidationError(w, []FieldError{*fieldErr})
+		return
+	}
+
+	account, ok := api.adminAccount(w, r)
+	if !ok {
+		return
+	}
+	account.SetLimits(service.Limits{MaxTransfer: maxTransfer})
+	api.audit(r, "account.limits_changed", map[string]interface{}{"username": account.Username, "max_transfer": maxTransfer})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// SetProfileHandler replaces an account holder's profile. A new display name
+// is screened like a new holder.
+func (api *API) SetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var req ProfileRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	profile, fields := req.profile()
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	account, ok := api.adminAccount(w, r)
+	if !ok {
+		return
+	}
+	err := service.UpdateProfile(r.Context(), api.accountManager, account, profile)
+	if errors.Is(err, service.ErrSanctioned) {
+		writeError(w, http.StatusForbidden, service.ErrorCode(err), service.ErrSanctioned.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// SetSigningHandler makes an account joint with the owners and signing rules
+// in the body, or a single-owner account again if owners is empty
+func (api *API) SetSigningHandler(w http.ResponseWriter, r *http.Request) {
+	var policy service.SigningPolicy
+	if !decodeStrict(w, r, &policy) {
+		return
+	}
+	if len(policy.Owners) > 0 {
+		if err := policy.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_signing_policy", err.Error())
+			return
+		}
+	}
+
+	account, ok := api.adminAccount(w, r)
+	if !ok {
+		return
+	}
+	if len(policy.Owners) == 0 {
+		account.SetSigningPolicy(nil)
+	} else {
+		account.SetSigningPolicy(&policy)
+	}
+	api.audit(r, "account.signing_changed", map[string]interface{}{"username": account.Username, "owners": policy.Owners, "rules": policy.Rules})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// adminAccount looks up the account named by ID or username in the URL,
+// writing a 404 if it does not exist
+func (api *API) adminAccount(w http.ResponseWriter, r *http.Request) (*service.Account, bool) {
+	account, err := service.LookupAccount(api.accountManager, mux.Vars(r)["username"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+		return nil, false
+	}
+	return account, true
+}
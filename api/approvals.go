@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+
+	"github.com/gorilla/mux"
+)
+
+// DecisionRequest carries the reason for approving or rejecting a transfer
+type DecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// DecisionResponse is the approval after a decision and, for approvals, the
+// result of executing the transfer
+type DecisionResponse struct {
+	Approval service.Approval        `json:"approval"`
+	Result   *service.TransferResult `json:"result,omitempty"`
+}
+
+// approvalStatus maps approval errors to HTTP status codes
+func approvalStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrApprovalNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrSelfApproval), errors.Is(err, service.ErrCheckerRequired), errors.Is(err, service.ErrNotSigner):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrReasonRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	}
+	// Closed, expired or failed on execution
+	return http.StatusConflict
+}
+
+// canSeeApproval reports whether the caller may see the approval: someone
+// with approvals:read, an owner of the source account, or one of its joint
+// owners, who may need to sign it
+func (api *API) canSeeApproval(r *http.Request, approval service.Approval) bool {
+	if api.canAccess(r, approval.Request.From, auth.PermApprovalsRead) {
+		return true
+	}
+
+	account, err := api.accountManager.GetAccount(approval.Request.From)
+	if err != nil {
+		return false
+	}
+	policy := account.SigningPolicy()
+	return policy != nil && policy.IsOwner(service.ActorFromContext(r.Context()))
+}
+
+// ListApprovalsHandler returns the approvals the caller may see in
+// submission order, optionally filtered with ?status=pending
+func (api *API) ListApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	status := service.ApprovalStatus(r.URL.Query().Get("status"))
+
+	visible := []service.Approval{}
+	for _, approval := range api.transferService.Approvals(status) {
+		if api.canSeeApproval(r, approval) {
+			visible = append(visible, approval)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+// GetApprovalHandler returns an approval with its full trail
+func (api *API) GetApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	approval, err := api.transferService.Approval(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, approvalStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+	if !api.canSeeApproval(r, approval) {
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to access approval "+approval.ID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approval)
+}
+
+// ApproveHandler approves and executes a pending transfer
+func (api *API) ApproveHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeDecision(w, r)
+	if !ok {
+		return
+	}
+
+	result, approval, err := api.transferService.Approve(r.Context(), mux.Vars(r)["id"], req.Reason)
+	if err != nil {
+		writeError(w, approvalStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DecisionResponse{Approval: approval, Result: result})
+}
+
+// SignHandler adds the caller's signature to a transfer from a joint account
+// they own, executing it once it has enough signatures
+func (api *API) SignHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeDecision(w, r)
+	if !ok {
+		return
+	}
+
+	result, approval, err := api.transferService.Sign(r.Context(), mux.Vars(r)["id"], req.Reason)
+	if err != nil {
+		writeError(w, approvalStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DecisionResponse{Approval: approval, Result: result})
+}
+
+// RejectHandler rejects a pending transfer and releases its held funds
+func (api *API) RejectHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeDecision(w, r)
+	if !ok {
+		return
+	}
+
+	approval, err := api.transferService.Reject(r.Context(), mux.Vars(r)["id"], req.Reason)
+	if err != nil {
+		writeError(w, approvalStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DecisionResponse{Approval: approval})
+}
+
+// decodeDecision reads an optional decision body
+func decodeDecision(w http.ResponseWriter, r *http.Request) (DecisionRequest, bool) {
+	var req DecisionRequest
+	ok := decodeOptional(w, r, &req)
+	return req, ok
+}
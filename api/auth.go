@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHeader carries an API key. "Authorization: Bearer <token>" accepts
+// both API keys and JWTs.
+const APIKeyHeader = "X-API-Key"
+
+// WithKeyStore requires callers to authenticate with an API key from the
+// store and exposes key management under /admin/keys
+func WithKeyStore(keys *auth.KeyStore) Option {
+	return func(api *API) {
+		api.keyStore = keys
+	}
+}
+
+// WithJWTVerifier accepts JWT bearer tokens checked by the verifier and
+// restricts their holders to the accounts they own
+func WithJWTVerifier(verifier *auth.JWTVerifier) Option {
+	return func(api *API) {
+		api.jwtVerifier = verifier
+	}
+}
+
+// WithPolicy replaces the built-in role and scope permissions
+func WithPolicy(policy *auth.Policy) Option {
+	return func(api *API) {
+		api.policy = policy
+	}
+}
+
+// WithKeyRotationOverlap sets how long a rotated-out key keeps working when
+// the rotation request does not say
+func WithKeyRotationOverlap(overlap time.Duration) Option {
+	return func(api *API) {
+		api.rotationOverlap = overlap
+	}
+}
+
+// credentials returns the API key presented with the request
+func credentials(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// authEnabled reports whether callers must authenticate
+func (api *API) authEnabled() bool {
+	return api.keyStore != nil || api.jwtVerifier != nil
+}
+
+// authenticate checks the request's credentials: JWTs against the verifier
+// and anything else against the key store
+func (api *API) authenticate(r *http.Request) (*auth.Principal, error) {
+	token := credentials(r)
+	if api.jwtVerifier != nil && auth.IsJWT(token) {
+		return api.jwtVerifier.Authenticate(token)
+	}
+	if api.keyStore != nil {
+		return api.keyStore.Authenticate(token)
+	}
+	return nil, auth.ErrUnauthenticated
+}
+
+// canAccess reports whether the caller owns the account or holds the
+// permission to act on any account. Every account is accessible when
+// authentication is disabled.
+func (api *API) canAccess(r *http.Request, username string, anyAccount auth.Permission) bool {
+	if !api.authEnabled() {
+		return true
+	}
+
+	principal := auth.PrincipalFromContext(r.Context())
+	return principal.CanAccess(username) || api.policy.Allows(principal, anyAccount)
+}
+
+// require wraps a handler so it is only reachable by principals holding the
+// permission, and rate limits it. Client IPs are limited before they are
+// authenticated. Without authentication only the rate limits apply.
+func (api *API) require(perm auth.Permission, handler http.HandlerFunc) http.Handler {
+	next := api.rateLimit(handler)
+	if !api.authEnabled() {
+		return api.limitIP(next)
+	}
+
+	return api.limitIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := api.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mts"`)
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "a valid API key or bearer token is required")
+			return
+		}
+
+		addLogAttrs(r, slog.String("principal", principal.ID))
+		tracing.SpanFromContext(r.Context()).SetAttribute("auth.principal", principal.ID)
+
+		if !api.policy.Allows(principal, perm) {
+			writeError(w, http.StatusForbidden, "forbidden", "missing permission "+string(perm))
+			return
+		}
+
+		ctx := auth.ContextWithPrincipal(r.Context(), principal)
+		ctx = service.ContextWithActor(ctx, principal.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+// CreateKeyRequest represents a request to issue an API key
+type CreateKeyRequest struct {
+	ID       string   `json:"id"`
+	Scopes   []string `json:"scopes"`
+	Roles    []string `json:"roles,omitempty"`
+	Accounts []string `json:"accounts,omitempty"`
+	// AllAccounts is only accepted for admin keys
+	AllAccounts bool       `json:"all_accounts,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// RotateKeyRequest represents a request to rotate an API key. Overlap is a
+// duration such as "24h"; if omitted the configured default applies.
+type RotateKeyRequest struct {
+	Overlap string `json:"overlap,omitempty"`
+}
+
+// KeyResponse describes an API key. Secret is only set when a key is
+// created or rotated.
+type KeyResponse struct {
+	ID                string     `json:"id"`
+	Secret            string     `json:"secret,omitempty"`
+	Scopes            []string   `json:"scopes,omitempty"`
+	Roles             []string   `json:"roles,omitempty"`
+	Accounts          []string   `json:"accounts,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previous_expires_at,omitempty"`
+}
+
+// newKeyResponse describes a key without its hashes
+func newKeyResponse(key auth.Key, secret string) KeyResponse {
+	resp := KeyResponse{ID: key.ID, Secret: secret, Accounts: key.Accounts, CreatedAt: key.CreatedAt, ExpiresAt: key.ExpiresAt}
+	for _, scope := range key.Scopes {
+		resp.Scopes = append(resp.Scopes, string(scope))
+	}
+	for _, role := range key.Roles {
+		resp.Roles = append(resp.Roles, string(role))
+	}
+	if key.Previous != nil {
+		resp.PreviousExpiresAt = &key.Previous.ExpiresAt
+	}
+	return resp
+}
+
+// ListKeysHandler returns every API key without secrets or hashes
+func (api *API) ListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys := make([]KeyResponse, 0)
+	for _, key := range api.keyStore.List() {
+		keys = append(keys, newKeyResponse(key, ""))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateKeyHandler issues a new API key and returns its secret
+func (api *API) CreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateKeyRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	var roles []auth.Role
+	for _, name := range req.Roles {
+		role := auth.Role(name)
+		if !api.policy.HasRole(role) {
+			writeError(w, http.StatusBadRequest, "invalid_role", "unknown role "+name)
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	secret, key, err := api.keyStore.Issue(auth.Key{ID: req.ID, Scopes: scopes, Roles: roles, Accounts: req.Accounts, AllAccounts: req.AllAccounts, ExpiresAt: req.ExpiresAt})
+	if errors.Is(err, auth.ErrKeyExists) {
+		writeError(w, http.StatusConflict, "key_exists", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_key", err.Error())
+		return
+	}
+	api.audit(r, "key.created", map[string]interface{}{"id": key.ID, "scopes": key.Scopes, "roles": key.Roles, "accounts": key.Accounts, "all_accounts": key.AllAccounts})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newKeyResponse(key, secret))
+}
+
+// RotateKeyHandler replaces an API key's secret, keeping the old secret
+// valid for the overlap period
+func (api *API) RotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req RotateKeyRequest
+	if !decodeOptional(w, r, &req) {
+		return
+	}
+
+	overlap := api.rotationOverlap
+	if req.Overlap != "" {
+		var err error
+		if overlap, err = time.ParseDuration(req.Overlap); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_overlap", "overlap must be a duration such as 24h")
+			return
+		}
+	}
+	if overlap < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_overlap", "overlap cannot be negative")
+		return
+	}
+
+	secret, key, err := api.keyStore.Rotate(mux.Vars(r)["id"], overlap)
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		writeError(w, http.StatusNotFound, "key_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	api.audit(r, "key.rotated", map[string]interface{}{"id": key.ID, "overlap": overlap.String()})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newKeyResponse(key, secret))
+}
+
+// RevokeKeyHandler deletes an API key
+func (api *API) RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	err := api.keyStore.Revoke(id)
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		writeError(w, http.StatusNotFound, "key_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	api.audit(r, "key.revoked", map[string]interface{}{"id": id})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorResponse is the standard error envelope returned by the API
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes a single API error
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields lists each invalid field when Code is validation_failed
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// writeError writes an error envelope with the given status code
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorBody{Code: code, Message: message}})
+}
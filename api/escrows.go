@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+
+	"github.com/gorilla/mux"
+)
+
+// EscrowResponse is an escrow and, when it was just created, the result of
+// its funding transfer
+type EscrowResponse struct {
+	Escrow service.Escrow          `json:"escrow"`
+	Result *service.TransferResult `json:"result,omitempty"`
+}
+
+// ResolveRequest is the arbiter's decision on a disputed escrow
+type ResolveRequest struct {
+	PayeeAmount json.RawMessage `json:"payee_amount"`
+	Reason      string          `json:"reason"`
+}
+
+// escrowBody is the wire form of an escrow request
+type escrowBody struct {
+	Payer   string          `json:"payer"`
+	Payee   string          `json:"payee"`
+	Arbiter string          `json:"arbiter"`
+	Amount  json.RawMessage `json:"amount"`
+}
+
+// validate checks every field and returns the escrow request with the list
+// of invalid fields
+func (b escrowBody) validate() (service.EscrowRequest, []FieldError) {
+	var fields []FieldError
+	for _, f := range []struct{ name, value string }{{"payer", b.Payer}, {"payee", b.Payee}} {
+		switch {
+		case f.value == "":
+			fields = append(fields, FieldError{Field: f.name, Code: "required", Message: "is required"})
+		case !service.ValidAccountRef(f.value):
+			fields = append(fields, FieldError{Field: f.name, Code: "invalid_format", Message: fmt.Sprintf("must be an account ID or 1 to %d letters, digits, '.', '_' or '-', starting with a letter or digit", service.MaxUsernameLength)})
+		}
+	}
+	if b.Arbiter == "" {
+		fields = append(fields, FieldError{Field: "arbiter", Code: "required", Message: "is required"})
+	}
+
+	amount, err := parseAmount(b.Amount)
+	if err != nil {
+		fields = append(fields, *err)
+	}
+
+	return service.EscrowRequest{Payer: b.Payer, Payee: b.Payee, Arbiter: b.Arbiter, Amount: amount}, fields
+}
+
+// escrowStatus maps escrow errors to HTTP status codes
+func escrowStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrEscrowNotFound), errors.Is(err, service.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrNotArbiter), errors.Is(err, service.ErrSanctioned):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrEscrowState), errors.Is(err, service.ErrAccountFrozen), errors.Is(err, service.ErrAccountClosed),
+		errors.Is(err, service.ErrScreeningPending):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// canSeeEscrow reports whether the caller may see the escrow: its arbiter,
+// or someone with access to the payer or payee account
+func (api *API) canSeeEscrow(r *http.Request, escrow service.Escrow) bool {
+	return service.ActorFromContext(r.Context()) == escrow.Arbiter ||
+		api.canAccess(r, escrow.Payer, auth.PermAccountsReadAny) || api.canAccess(r, escrow.Payee, auth.PermAccountsReadAny)
+}
+
+// CreateEscrowHandler moves money from the payer into escrow. The escrow is
+// pending with status 202 if its funding transfer is held for approval.
+func (api *API) CreateEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	var body escrowBody
+	if !decodeStrict(w, r, &body) {
+		return
+	}
+	req, fields := body.validate()
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	req.Payer, req.Payee = api.username(req.Payer), api.username(req.Payee)
+	if !api.canAccess(r, req.Payer, auth.PermTransfersDebitAny) {
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to debit account "+req.Payer)
+		return
+	}
+	if !api.allowAccount(w, r, req.Payer) {
+		return
+	}
+
+	result, escrow, err := api.transferService.CreateEscrow(r.Context(), req)
+	if err != nil {
+		writeError(w, escrowStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+
+	status := http.StatusCreated
+	if escrow.Status == service.EscrowPending {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/escrows/"+escrow.ID)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(EscrowResponse{Escrow: escrow, Result: result})
+}
+
+// ListEscrowsHandler returns the escrows the caller may see in creation
+// order, optionally filtered with ?status=funded
+func (api *API) ListEscrowsHandler(w http.ResponseWriter, r *http.Request) {
+	status := service.EscrowStatus(r.URL.Query().Get("status"))
+
+	visible := []service.Escrow{}
+	for _, escrow := range api.transferService.Escrows(status) {
+		if api.canSeeEscrow(r, escrow) {
+			visible = append(visible, escrow)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+// GetEscrowHandler returns an escrow with its full trail
+func (api *API) GetEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	escrow, ok := api.visibleEscrow(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(escrow)
+}
+
+// ConfirmEscrowHandler releases an escrow to its payee on behalf of the
+// payer
+func (api *API) ConfirmEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	api.decideEscrow(w, r, func(escrow service.Escrow) bool {
+		return api.canAccess(r, escrow.Payer, auth.PermTransfersDebitAny)
+	}, api.transferService.Confirm)
+}
+
+// CancelEscrowHandler refunds an escrow to its payer on behalf of the payee
+func (api *API) CancelEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	api.decideEscrow(w, r, func(escrow service.Escrow) bool {
+		return api.canAccess(r, escrow.Payee, auth.PermTransfersDebitAny)
+	}, api.transferService.Cancel)
+}
+
+// DisputeEscrowHandler hands an escrow to its arbiter on behalf of the payer
+// or payee
+func (api *API) DisputeEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	api.decideEscrow(w, r, func(escrow service.Escrow) bool {
+		return api.canAccess(r, escrow.Payer, auth.PermTransfersDebitAny) || api.canAccess(r, escrow.Payee, auth.PermTransfersDebitAny)
+	}, api.transferService.Dispute)
+}
+
+// ResolveEscrowHandler splits a disputed escrow on behalf of its arbiter
+func (api *API) ResolveEscrowHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResolveRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	payeeAmount, fieldErr := parseOptionalAmount("payee_amount", req.PayeeAmount)
+	if fieldErr != nil {
+		writeValidationError(w, []FieldError{*fieldErr})
+		return
+	}
+	if _, ok := api.visibleEscrow(w, r); !ok {
+		return
+	}
+
+	escrow, err := api.transferService.Resolve(r.Context(), mux.Vars(r)["id"], payeeAmount, req.Reason)
+	if err != nil {
+		writeError(w, escrowStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EscrowResponse{Escrow: escrow})
+}
+
+// decideEscrow applies a confirm, cancel or dispute to the escrow in the URL
+// if allowed reports that the caller may act for the right party
+func (api *API) decideEscrow(w http.ResponseWriter, r *http.Request, allowed func(service.Escrow) bool,
+	decide func(ctx context.Context, id, reason string) (service.Escrow, error)) {
+	req, ok := decodeDecision(w, r)
+	if !ok {
+		return
+	}
+	escrow, ok := api.visibleEscrow(w, r)
+	if !ok {
+		return
+	}
+	if !allowed(escrow) {
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to act for this party of escrow "+escrow.ID)
+		return
+	}
+
+	escrow, err := decide(r.Context(), escrow.ID, req.Reason)
+	if err != nil {
+		writeError(w, escrowStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EscrowResponse{Escrow: escrow})
+}
+
+// visibleEscrow looks up the escrow in the URL, writing a 404 if it does not
+// exist and a 403 if the caller may not see it
+func (api *API) visibleEscrow(w http.ResponseWriter, r *http.Request) (service.Escrow, bool) {
+	escrow, err := api.transferService.Escrow(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, escrowStatus(err), service.ErrorCode(err), err.Error())
+		return escrow, false
+	}
+	if !api.canSeeEscrow(r, escrow) {
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to access escrow "+escrow.ID)
+		return escrow, false
+	}
+	return escrow, true
+}
@@ -2,9 +2,20 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
+	"time"
 
+	"money-transfer-system/auth"
+	"money-transfer-system/health"
+	"money-transfer-system/metrics"
+	"money-transfer-system/ratelimit"
+	"money-transfer-system/screening"
 	"money-transfer-system/service"
+	"money-transfer-system/tracing"
 
 	"github.com/gorilla/mux"
 )
@@ -13,24 +24,106 @@ import (
 type API struct {
 	transferService *service.TransferService
 	accountManager  service.AccountManager
+	accountCreation bool
+	notReady        atomic.Bool
+	livenessChecks  []health.Check
+	readinessChecks []health.Check
+	metrics         *metrics.Registry
+	httpMetrics     *metrics.HTTPMetrics
+	logger          *slog.Logger
+	tracer          *tracing.Tracer
+	keyStore        *auth.KeyStore
+	jwtVerifier     *auth.JWTVerifier
+	policy          *auth.Policy
+	rotationOverlap time.Duration
+	auditor         service.Auditor
+	screener        *screening.Screener
+	// readLimiter and transferLimiter hold per-caller request budgets
+	readLimiter       *ratelimit.Limiter
+	transferLimiter   *ratelimit.Limiter
+	trustForwardedFor bool
+	// ipLimiter limits each client IP before authentication; accountLimiter
+	// limits transfers out of each account
+	ipLimiter      *ratelimit.Limiter
+	accountLimiter *ratelimit.Limiter
+}
+
+// Option configures optional API behaviour
+type Option func(*API)
+
+// WithAccountCreation enables the POST /accounts route. It is only
+// registered when authentication is enabled.
+func WithAccountCreation(enabled bool) Option {
+	return func(api *API) {
+		api.accountCreation = enabled
+	}
+}
+
+// WithMetrics exposes the registry at GET /metrics and records HTTP
+// request metrics in it
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(api *API) {
+		api.metrics = registry
+		api.httpMetrics = metrics.NewHTTPMetrics(registry)
+	}
+}
+
+// WithLogger writes a structured log line for every request
+func WithLogger(logger *slog.Logger) Option {
+	return func(api *API) {
+		api.logger = logger
+	}
+}
+
+// WithTracer records a server span per request and a span for each transfer handler
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(api *API) {
+		api.tracer = tracer
+	}
+}
+
+// WithAuditor records account administration and API key changes
+func WithAuditor(auditor service.Auditor) Option {
+	return func(api *API) {
+		api.auditor = auditor
+	}
 }
 
 // NewAPI creates a new API instance
-func NewAPI(transferService *service.TransferService, accountManager service.AccountManager) *API {
-	return &API{
+func NewAPI(transferService *service.TransferService, accountManager service.AccountManager, opts ...Option) *API {
+	api := &API{
 		transferService: transferService,
 		accountManager:  accountManager,
+		rotationOverlap: 24 * time.Hour,
+		policy:          auth.DefaultPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(api)
 	}
+
+	return api
 }
 
-// GetAccountHandler returns the account information for the specified username
+// GetAccountHandler returns the account information for the specified
+// account ID or username
 func (api *API) GetAccountHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	username := vars["username"]
+	ref := vars["username"]
+
+	// Check access by username so an ID reveals no more than the username
+	account, err := service.LookupAccount(api.accountManager, ref)
+	username := ref
+	if err == nil {
+		username = account.Username
+	}
+	if !api.canAccess(r, username, auth.PermAccountsReadAny) {
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to access account "+ref)
+		return
+	}
 
-	account, err := api.accountManager.GetAccount(username)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
 		return
 	}
 
@@ -42,26 +135,152 @@ func (api *API) GetAccountHandler(w http.ResponseWriter, r *http.Request) {
 func (api *API) ListAccountsHandler(w http.ResponseWriter, r *http.Request) {
 	accounts := api.accountManager.ListAccounts()
 
+	// Callers only see the accounts they may access
+	visible := make([]*service.Account, 0, len(accounts))
+	for _, account := range accounts {
+		if api.canAccess(r, account.Username, auth.PermAccountsReadAny) {
+			visible = append(visible, account)
+		}
+	}
+	accounts = visible
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(accounts)
 }
 
+// CreateAccountRequest represents a request to open a new account
+type CreateAccountRequest struct {
+	Username    string              `json:"username"`
+	Balance     json.RawMessage     `json:"balance"`
+	DisplayName string              `json:"display_name"`
+	Type        service.AccountType `json:"type"`
+	Contact     service.Contact     `json:"contact"`
+}
+
+// CreateAccountHandler creates a new account. Accounts start empty unless
+// the caller may fund them.
+func (api *API) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateAccountRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+
+	if req.Username == "" {
+		writeError(w, http.StatusBadRequest, "invalid_username", "username is required")
+		return
+	}
+	if !service.ValidUsername(req.Username) {
+		writeError(w, http.StatusBadRequest, "invalid_username", fmt.Sprintf("username must be 1 to %d letters, digits, '.', '_' or '-', starting with a letter or digit, and not start with %q", service.MaxUsernameLength, service.AccountIDPrefix))
+		return
+	}
+
+	balance, fieldErr := parseOptionalAmount("balance", req.Balance)
+	if fieldErr != nil {
+		writeValidationError(w, []FieldError{*fieldErr})
+		return
+	}
+	if balance > 0 && !api.policy.Allows(auth.PrincipalFromContext(r.Context()), auth.PermAccountsFund) {
+		writeError(w, http.StatusForbidden, "forbidden", "missing permission "+string(auth.PermAccountsFund)+" to fund a new account")
+		return
+	}
+
+	profile, fields := req.profile()
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	// Create through the manager so it can screen the holder and record who
+	// created the account
+	account, err := service.CreateAccountWithProfile(r.Context(), api.accountManager, req.Username, balance, profile)
+	if errors.Is(err, service.ErrAccountExists) {
+		writeError(w, http.StatusConflict, "account_exists", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrSanctioned) {
+		writeError(w, http.StatusForbidden, service.ErrorCode(err), service.ErrSanctioned.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/accounts/"+account.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
 // TransferHandler handles money transfer requests
 func (api *API) TransferHandler(w http.ResponseWriter, r *http.Request) {
-	var req service.TransferRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+	ctx, span := api.tracer.Start(r.Context(), "TransferHandler")
+	defer span.End()
+
+	var body transferBody
+	if !decodeStrict(w, r, &body) {
+		addLogAttrs(r, slog.String("outcome", "invalid_request"))
+		return
+	}
+	req, fields := body.validate()
+	if len(fields) > 0 {
+		addLogAttrs(r, slog.String("outcome", "validation_failed"))
+		writeValidationError(w, fields)
+		return
+	}
+
+	// Accounts may be given by ID; access is checked against the username
+	req.From, req.To = api.username(req.From), api.username(req.To)
+	if !api.canAccess(r, req.From, auth.PermTransfersDebitAny) {
+		addLogAttrs(r, slog.String("from", req.From), slog.String("outcome", "forbidden"))
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to debit account "+req.From)
+		return
+	}
+	if !api.allowAccount(w, r, req.From) {
 		return
 	}
 
-	result, err := api.transferService.Transfer(req)
+	result, err := api.transferService.TransferContext(ctx, req)
+	span.RecordError(err)
+	addLogAttrs(r,
+		slog.String("from", req.From),
+		slog.String("to", req.To),
+		slog.Float64("amount", req.Amount),
+		slog.String("outcome", service.ErrorCode(err)),
+	)
 	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, service.ErrShuttingDown):
+			status = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", "5")
+		case errors.Is(err, service.ErrApprovalRequired), errors.Is(err, service.ErrSignaturesRequired):
+			status = http.StatusAccepted
+			w.Header().Set("Location", "/approvals/"+result.ApprovalID)
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(result)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
-} 
+}
+
+// username returns the username of the account ref identifies by ID or
+// username, or ref itself if there is no such account
+func (api *API) username(ref string) string {
+	if account, err := service.LookupAccount(api.accountManager, ref); err == nil {
+		return account.Username
+	}
+	return ref
+}
+
+// audit records an action for the caller of r if an auditor is configured
+func (api *API) audit(r *http.Request, action string, details map[string]interface{}) {
+	if api.auditor != nil {
+		api.auditor.Audit(r.Context(), action, details)
+	}
+}
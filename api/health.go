@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"money-transfer-system/health"
+)
+
+// WithLivenessChecks adds checks that must pass for GET /healthz
+func WithLivenessChecks(checks ...health.Check) Option {
+	return func(api *API) {
+		api.livenessChecks = append(api.livenessChecks, checks...)
+	}
+}
+
+// WithReadinessChecks adds checks that must pass for GET /readyz
+func WithReadinessChecks(checks ...health.Check) Option {
+	return func(api *API) {
+		api.readinessChecks = append(api.readinessChecks, checks...)
+	}
+}
+
+// SetReady marks the server as ready or not ready to receive traffic
+func (api *API) SetReady(ready bool) {
+	api.notReady.Store(!ready)
+}
+
+// HealthzHandler reports whether the process is alive. It fails when a
+// liveness check does, for example when an account lock is stuck.
+func (api *API) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := health.Evaluate(r.Context(), api.livenessChecks)
+	writeHealth(w, report, ok)
+}
+
+// ReadyzHandler reports whether the server should receive traffic.
+// It returns 503 while draining for shutdown or when a dependency is down.
+func (api *API) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if api.notReady.Load() || api.transferService.Draining() {
+		writeHealth(w, health.Report{Status: "draining"}, false)
+		return
+	}
+
+	report, ok := health.Evaluate(r.Context(), api.readinessChecks)
+	writeHealth(w, report, ok)
+}
+
+// writeHealth writes a health report with 200 or 503
+func writeHealth(w http.ResponseWriter, report health.Report, ok bool) {
+	code := http.StatusOK
+	if !ok {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
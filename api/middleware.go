@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"money-transfer-system/service"
+	"money-transfer-system/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// routeTemplate returns the path template of the matched route, so metrics
+// and logs are not partitioned by usernames in the URL
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
+
+// metricsMiddleware records request counts and latency per route
+func (api *API) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		api.httpMetrics.Observe(r.Method, routeTemplate(r), rec.status, time.Since(start))
+	})
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to propagate
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit hex request ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestIDMiddleware propagates the client's X-Request-ID or assigns a new
+// one, echoes it on the response and stores it in the request context
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(service.ContextWithRequestID(r.Context(), requestID)))
+	})
+}
+
+// logFieldsKey is the context key for per-request log fields
+type logFieldsKey struct{}
+
+// logFields lets handlers add attributes to the request log line
+type logFields struct {
+	attrs []slog.Attr
+}
+
+// addLogAttrs adds attributes to the request log line, if one is being written
+func addLogAttrs(r *http.Request, attrs ...slog.Attr) {
+	if fields, ok := r.Context().Value(logFieldsKey{}).(*logFields); ok {
+		fields.attrs = append(fields.attrs, attrs...)
+	}
+}
+
+// loggingMiddleware writes one structured log line per request
+func (api *API) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		fields := &logFields{}
+		ctx := context.WithValue(r.Context(), logFieldsKey{}, fields)
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := append([]slog.Attr{
+			slog.String("request_id", service.RequestIDFromContext(ctx)),
+			slog.String("method", r.Method),
+			slog.String("route", routeTemplate(r)),
+			slog.Int("status", rec.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}, fields.attrs...)
+
+		api.logger.LogAttrs(ctx, level, "http request", attrs...)
+	})
+}
+
+// tracingMiddleware starts a server span for each request, continuing the
+// caller's trace when a valid W3C traceparent header is present
+func (api *API) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, err := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); err == nil {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+
+		route := routeTemplate(r)
+		ctx, span := api.tracer.Start(ctx, r.Method+" "+route)
+		defer span.End()
+		w.Header().Set(tracing.TraceparentHeader, tracing.FormatTraceparent(span.SpanContext()))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.status_code", rec.status)
+		span.SetAttribute("request_id", service.RequestIDFromContext(ctx))
+		addLogAttrs(r, slog.String("trace_id", span.SpanContext().TraceID.String()))
+	})
+}
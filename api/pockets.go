@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+
+	"github.com/gorilla/mux"
+)
+
+// PocketRequest is the body of a request to create or change a pocket. Name
+// is ignored when changing a pocket, which is named in the URL.
+type PocketRequest struct {
+	Name        string  `json:"name"`
+	Goal        float64 `json:"goal"`
+	DirectDebit bool    `json:"direct_debit"`
+}
+
+// moveBody is the wire form of a request to move money between pockets. An
+// empty from or to is the main balance.
+type moveBody struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Amount json.RawMessage `json:"amount"`
+}
+
+// pocketNameError is the field error for an invalid pocket name
+func pocketNameError(field string) FieldError {
+	return FieldError{Field: field, Code: "invalid_format", Message: fmt.Sprintf("must be 1 to %d letters, digits, '.', '_' or '-', starting with a letter or digit", service.MaxPocketNameLength)}
+}
+
+// pocketStatus maps pocket errors to HTTP status codes
+func pocketStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrPocketNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPocketExists), errors.Is(err, service.ErrTooManyPockets),
+		errors.Is(err, service.ErrAccountFrozen), errors.Is(err, service.ErrAccountClosed):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// pocketAccount looks up the account named by ID or username in the URL if
+// the caller has access to it with perm, writing a 403 or 404 otherwise
+func (api *API) pocketAccount(w http.ResponseWriter, r *http.Request, perm auth.Permission) (*service.Account, bool) {
+	ref := mux.Vars(r)["username"]
+
+	// Check access by username so an ID reveals no more than the username
+	account, err := service.LookupAccount(api.accountManager, ref)
+	username := ref
+	if err == nil {
+		username = account.Username
+	}
+	if !api.canAccess(r, username, perm) {
+		writeError(w, http.StatusForbidden, "forbidden", "not allowed to access account "+ref)
+		return nil, false
+	}
+
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+		return nil, false
+	}
+	return account, true
+}
+
+// notEscrowAccount writes an error if the account is the escrow account,
+// whose money belongs to escrows and must not be earmarked
+func (api *API) notEscrowAccount(w http.ResponseWriter, account *service.Account) bool {
+	if api.transferService.IsEscrowAccount(account.Username) {
+		writeError(w, http.StatusBadRequest, service.ErrorCode(service.ErrEscrowAccount), service.ErrEscrowAccount.Error())
+		return false
+	}
+	return true
+}
+
+// ListPocketsHandler returns the pockets of an account in creation order
+func (api *API) ListPocketsHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := api.pocketAccount(w, r, auth.PermAccountsReadAny)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account.Pockets())
+}
+
+// CreatePocketHandler adds an empty pocket to an account
+func (api *API) CreatePocketHandler(w http.ResponseWriter, r *http.Request) {
+	var req PocketRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	var fields []FieldError
+	if !service.ValidPocketName(req.Name) {
+		fields = append(fields, pocketNameError("name"))
+	}
+	if req.Goal < 0 {
+		fields = append(fields, FieldError{Field: "goal", Code: "out_of_range", Message: "cannot be negative"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	account, ok := api.pocketAccount(w, r, auth.PermTransfersDebitAny)
+	if !ok || !api.notEscrowAccount(w, account) {
+		return
+	}
+	pocket, err := account.CreatePocket(req.Name, req.Goal, req.DirectDebit)
+	if err != nil {
+		writeError(w, pocketStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+	api.audit(r, "pocket.created", map[string]interface{}{"username": account.Username, "pocket": pocket.Name, "goal": pocket.Goal, "direct_debit": pocket.DirectDebit})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/accounts/"+account.ID+"/pockets/"+pocket.Name)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pocket)
+}
+
+// UpdatePocketHandler changes a pocket's goal and whether transfers may
+// debit it
+func (api *API) UpdatePocketHandler(w http.ResponseWriter, r *http.Request) {
+	var req PocketRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	if req.Goal < 0 {
+		writeValidationError(w, []FieldError{{Field: "goal", Code: "out_of_range", Message: "cannot be negative"}})
+		return
+	}
+
+	account, ok := api.pocketAccount(w, r, auth.PermTransfersDebitAny)
+	if !ok {
+		return
+	}
+	pocket, err := account.UpdatePocket(mux.Vars(r)["pocket"], req.Goal, req.DirectDebit)
+	if err != nil {
+		writeError(w, pocketStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+	api.audit(r, "pocket.updated", map[string]interface{}{"username": account.Username, "pocket": pocket.Name, "goal": pocket.Goal, "direct_debit": pocket.DirectDebit})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pocket)
+}
+
+// DeletePocketHandler removes a pocket, returning its balance to the main
+// balance, and returns the account
+func (api *API) DeletePocketHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := api.pocketAccount(w, r, auth.PermTransfersDebitAny)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["pocket"]
+	returned, err := account.DeletePocket(name)
+	if err != nil {
+		writeError(w, pocketStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+	api.audit(r, "pocket.deleted", map[string]interface{}{"username": account.Username, "pocket": name, "returned": returned})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// MovePocketHandler moves money between the main balance and the pockets of
+// an account, and returns the account
+func (api *API) MovePocketHandler(w http.ResponseWriter, r *http.Request) {
+	var body moveBody
+	if !decodeStrict(w, r, &body) {
+		return
+	}
+	var fields []FieldError
+	for _, f := range []struct{ name, value string }{{"from", body.From}, {"to", body.To}} {
+		if f.value != "" && !service.ValidPocketName(f.value) {
+			fields = append(fields, pocketNameError(f.name))
+		}
+	}
+	amount, fieldErr := parseAmount(body.Amount)
+	if fieldErr != nil {
+		fields = append(fields, *fieldErr)
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	account, ok := api.pocketAccount(w, r, auth.PermTransfersDebitAny)
+	if !ok || !api.notEscrowAccount(w, account) {
+		return
+	}
+	if err := account.MovePocket(body.From, body.To, amount); err != nil {
+		writeError(w, pocketStatus(err), service.ErrorCode(err), err.Error())
+		return
+	}
+	api.audit(r, "pocket.moved", map[string]interface{}{"username": account.Username, "from": body.From, "to": body.To, "amount": amount})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
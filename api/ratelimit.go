@@ -0,0 +1,142 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"money-transfer-system/auth"
+	"money-transfer-system/ratelimit"
+)
+
+// WithRateLimits limits each caller's reads and state-changing requests
+// separately. POST /transfer and every other non-GET route share the
+// transfer budget. A nil limiter leaves that budget unlimited.
+func WithRateLimits(read, transfer *ratelimit.Limiter) Option {
+	return func(api *API) {
+		api.readLimiter = read
+		api.transferLimiter = transfer
+	}
+}
+
+// WithIPRateLimit limits every request from each client IP before the
+// caller is authenticated, so failed authentication is limited too
+func WithIPRateLimit(limiter *ratelimit.Limiter) Option {
+	return func(api *API) {
+		api.ipLimiter = limiter
+	}
+}
+
+// WithAccountRateLimit limits transfers and escrows out of each account,
+// whoever the caller is
+func WithAccountRateLimit(limiter *ratelimit.Limiter) Option {
+	return func(api *API) {
+		api.accountLimiter = limiter
+	}
+}
+
+// WithTrustForwardedFor identifies unauthenticated callers by the last
+// X-Forwarded-For address, for servers behind a trusted proxy
+func WithTrustForwardedFor(trust bool) Option {
+	return func(api *API) {
+		api.trustForwardedFor = trust
+	}
+}
+
+// clientKey identifies the caller for rate limiting: the API key ID or JWT
+// subject when authenticated, otherwise the client IP
+func (api *API) clientKey(r *http.Request) string {
+	if principal := auth.PrincipalFromContext(r.Context()); principal != nil {
+		return "principal:" + principal.ID
+	}
+	return api.clientIP(r)
+}
+
+// clientIP identifies the client by its address, or by the last
+// X-Forwarded-For address behind a trusted proxy. Earlier addresses are
+// supplied by the client and could be forged to get a fresh budget.
+func (api *API) clientIP(r *http.Request) string {
+	if values := r.Header.Values("X-Forwarded-For"); api.trustForwardedFor && len(values) > 0 {
+		forwarded := values[len(values)-1]
+		if i := strings.LastIndex(forwarded, ","); i >= 0 {
+			forwarded = forwarded[i+1:]
+		}
+		if forwarded = strings.TrimSpace(forwarded); forwarded != "" {
+			return "ip:" + forwarded
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limitIP wraps a handler so that client IPs over their budget get a 429
+// before they are authenticated
+func (api *API) limitIP(next http.Handler) http.Handler {
+	if api.ipLimiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.allow(w, r, api.ipLimiter, api.clientIP(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allowAccount charges a transfer out of the account to its budget, writing
+// a 429 and returning false if the account is over it
+func (api *API) allowAccount(w http.ResponseWriter, r *http.Request, username string) bool {
+	return api.accountLimiter == nil || api.allow(w, r, api.accountLimiter, "account:"+username)
+}
+
+// rateLimit wraps a handler so that callers over their budget get a 429.
+// It runs after authentication so callers are keyed by principal.
+func (api *API) rateLimit(next http.Handler) http.Handler {
+	if api.readLimiter == nil && api.transferLimiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := api.transferLimiter
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			limiter = api.readLimiter
+		}
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if api.allow(w, r, limiter, api.clientKey(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow charges one request to the key's bucket and sets the rate limit
+// headers. It writes a 429 and returns false if the bucket is empty.
+func (api *API) allow(w http.ResponseWriter, r *http.Request, limiter *ratelimit.Limiter, key string) bool {
+	decision := limiter.Allow(key)
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", seconds(decision.Reset))
+
+	if !decision.Allowed {
+		addLogAttrs(r, slog.String("outcome", "rate_limited"))
+		w.Header().Set("Retry-After", seconds(decision.RetryAfter))
+		writeError(w, http.StatusTooManyRequests, "rate_limited", "too many requests, retry after "+seconds(decision.RetryAfter)+"s")
+		return false
+	}
+	return true
+}
+
+// seconds formats a duration as whole seconds, rounding up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -1,19 +1,91 @@
 package api
 
 import (
+	"money-transfer-system/auth"
+
 	"github.com/gorilla/mux"
 )
 
 // SetupRoutes configures the routes for the API
 func (api *API) SetupRoutes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	if api.logger != nil {
+		r.Use(api.loggingMiddleware)
+	}
+	if api.tracer != nil {
+		r.Use(api.tracingMiddleware)
+	}
 
 	// Account routes
-	r.HandleFunc("/accounts/{username}", api.GetAccountHandler).Methods("GET")
-	r.HandleFunc("/accounts", api.ListAccountsHandler).Methods("GET")
+	r.Handle("/accounts/{username}", api.require(auth.PermAccountsRead, api.GetAccountHandler)).Methods("GET")
+	r.Handle("/accounts", api.require(auth.PermAccountsRead, api.ListAccountsHandler)).Methods("GET")
+	if api.accountCreation && api.authEnabled() {
+		r.Handle("/accounts", api.require(auth.PermAccountsCreate, api.CreateAccountHandler)).Methods("POST")
+	}
 
 	// Transfer route
-	r.HandleFunc("/transfer", api.TransferHandler).Methods("POST")
+	r.Handle("/transfer", api.require(auth.PermTransfersCreate, api.TransferHandler)).Methods("POST")
+
+	// Pockets
+	r.Handle("/accounts/{username}/pockets", api.require(auth.PermAccountsRead, api.ListPocketsHandler)).Methods("GET")
+	r.Handle("/accounts/{username}/pockets", api.require(auth.PermTransfersCreate, api.CreatePocketHandler)).Methods("POST")
+	r.Handle("/accounts/{username}/pockets/move", api.require(auth.PermTransfersCreate, api.MovePocketHandler)).Methods("POST")
+	r.Handle("/accounts/{username}/pockets/{pocket}", api.require(auth.PermTransfersCreate, api.UpdatePocketHandler)).Methods("PUT")
+	r.Handle("/accounts/{username}/pockets/{pocket}", api.require(auth.PermTransfersCreate, api.DeletePocketHandler)).Methods("DELETE")
+
+	// Approval routes
+	if api.transferService.ApprovalsEnabled() {
+		r.Handle("/approvals", api.require(auth.PermAccountsRead, api.ListApprovalsHandler)).Methods("GET")
+		r.Handle("/approvals/{id}", api.require(auth.PermAccountsRead, api.GetApprovalHandler)).Methods("GET")
+		r.Handle("/approvals/{id}/approve", api.require(auth.PermTransfersApprove, api.ApproveHandler)).Methods("POST")
+		r.Handle("/approvals/{id}/reject", api.require(auth.PermTransfersApprove, api.RejectHandler)).Methods("POST")
+		r.Handle("/approvals/{id}/sign", api.require(auth.PermTransfersCreate, api.SignHandler)).Methods("POST")
+	}
+
+	// Escrows
+	if api.transferService.EscrowsEnabled() {
+		r.Handle("/escrows", api.require(auth.PermAccountsRead, api.ListEscrowsHandler)).Methods("GET")
+		r.Handle("/escrows", api.require(auth.PermTransfersCreate, api.CreateEscrowHandler)).Methods("POST")
+		r.Handle("/escrows/{id}", api.require(auth.PermAccountsRead, api.GetEscrowHandler)).Methods("GET")
+		r.Handle("/escrows/{id}/confirm", api.require(auth.PermTransfersCreate, api.ConfirmEscrowHandler)).Methods("POST")
+		r.Handle("/escrows/{id}/cancel", api.require(auth.PermTransfersCreate, api.CancelEscrowHandler)).Methods("POST")
+		r.Handle("/escrows/{id}/dispute", api.require(auth.PermTransfersCreate, api.DisputeEscrowHandler)).Methods("POST")
+		r.Handle("/escrows/{id}/resolve", api.require(auth.PermTransfersCreate, api.ResolveEscrowHandler)).Methods("POST")
+	}
+
+	// Account administration
+	r.Handle("/accounts/{username}/freeze", api.require(auth.PermAccountsFreeze, api.FreezeAccountHandler)).Methods("POST")
+	r.Handle("/accounts/{username}/unfreeze", api.require(auth.PermAccountsFreeze, api.UnfreezeAccountHandler)).Methods("POST")
+	r.Handle("/accounts/{username}/limits", api.require(auth.PermAccountsLimits, api.SetLimitsHandler)).Methods("PUT")
+	r.Handle("/accounts/{username}/profile", api.require(auth.PermAccountsCreate, api.SetProfileHandler)).Methods("PUT")
+	r.Handle("/accounts/{username}/signing", api.require(auth.PermAccountsLimits, api.SetSigningHandler)).Methods("PUT")
+
+	// Screening review queue
+	if api.screener != nil {
+		r.Handle("/screening/hits", api.require(auth.PermScreeningReview, api.ListHitsHandler)).Methods("GET")
+		r.Handle("/screening/hits/{id}", api.require(auth.PermScreeningReview, api.GetHitHandler)).Methods("GET")
+		r.Handle("/screening/hits/{id}/clear", api.require(auth.PermScreeningReview, api.ClearHitHandler)).Methods("POST")
+		r.Handle("/screening/hits/{id}/confirm", api.require(auth.PermScreeningReview, api.ConfirmHitHandler)).Methods("POST")
+	}
+
+	// API key management
+	if api.keyStore != nil {
+		r.Handle("/admin/keys", api.require(auth.PermKeysManage, api.ListKeysHandler)).Methods("GET")
+		r.Handle("/admin/keys", api.require(auth.PermKeysManage, api.CreateKeyHandler)).Methods("POST")
+		r.Handle("/admin/keys/{id}/rotate", api.require(auth.PermKeysManage, api.RotateKeyHandler)).Methods("POST")
+		r.Handle("/admin/keys/{id}", api.require(auth.PermKeysManage, api.RevokeKeyHandler)).Methods("DELETE")
+	}
+
+	// Health routes
+	r.HandleFunc("/healthz", api.HealthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", api.ReadyzHandler).Methods("GET")
+
+	// Metrics
+	if api.metrics != nil {
+		r.Handle("/metrics", api.metrics.Handler()).Methods("GET")
+		r.Use(api.metricsMiddleware)
+	}
 
 	return r
 } 
\ No newline at end of file
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"money-transfer-system/screening"
+	"money-transfer-system/service"
+
+	"github.com/gorilla/mux"
+)
+
+// WithScreener exposes the screening review queue under /screening/hits
+func WithScreener(screener *screening.Screener) Option {
+	return func(api *API) {
+		api.screener = screener
+	}
+}
+
+// screeningStatus maps review errors to HTTP status codes
+func screeningStatus(err error) int {
+	switch {
+	case errors.Is(err, screening.ErrHitNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrReasonRequired):
+		return http.StatusBadRequest
+	}
+	return http.StatusConflict
+}
+
+// screeningCode returns the error code for a review error
+func screeningCode(err error) string {
+	switch {
+	case errors.Is(err, screening.ErrHitNotFound):
+		return "hit_not_found"
+	case errors.Is(err, screening.ErrHitClosed):
+		return "hit_closed"
+	}
+	return service.ErrorCode(err)
+}
+
+// ListHitsHandler returns screening hits in the order they were found,
+// optionally filtered with ?status=pending
+func (api *API) ListHitsHandler(w http.ResponseWriter, r *http.Request) {
+	status := screening.HitStatus(r.URL.Query().Get("status"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.screener.Hits(status))
+}
+
+// GetHitHandler returns a screening hit with the watchlist entry it matched
+func (api *API) GetHitHandler(w http.ResponseWriter, r *http.Request) {
+	hit, err := api.screener.Hit(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, screeningStatus(err), screeningCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hit)
+}
+
+// ClearHitHandler records that a pending hit is a false positive
+func (api *API) ClearHitHandler(w http.ResponseWriter, r *http.Request) {
+	api.decideHit(w, r, api.screener.Clear)
+}
+
+// ConfirmHitHandler records that a pending hit is the listed party
+func (api *API) ConfirmHitHandler(w http.ResponseWriter, r *http.Request) {
+	api.decideHit(w, r, api.screener.Confirm)
+}
+
+// decideHit reads the decision reason and applies decide to the hit
+func (api *API) decideHit(w http.ResponseWriter, r *http.Request, decide func(ctx context.Context, id, reason string) (screening.Hit, error)) {
+	req, ok := decodeDecision(w, r)
+	if !ok {
+		return
+	}
+
+	hit, err := decide(r.Context(), mux.Vars(r)["id"], req.Reason)
+	if err != nil {
+		writeError(w, screeningStatus(err), screeningCode(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hit)
+}
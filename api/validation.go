@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"money-transfer-system/service"
+)
+
+// MaxBodyBytes bounds the size of JSON request bodies
+const MaxBodyBytes = 64 << 10
+
+// Transfer amount bounds. Amounts are in major currency units with at most
+// AmountDecimals decimal places.
+const (
+	AmountDecimals = 2
+	MaxAmount      = 1e12
+)
+
+// FieldError describes one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeValidationError writes a 400 listing every invalid field
+func writeValidationError(w http.ResponseWriter, fields []FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorBody{
+		Code:    "validation_failed",
+		Message: "request body has invalid fields",
+		Fields:  fields,
+	}})
+}
+
+// decodeStrict decodes a single JSON object of at most MaxBodyBytes into v,
+// rejecting unknown fields and trailing data. On failure it writes the error
+// response and returns false.
+func decodeStrict(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = errors.New("unexpected data after the JSON object")
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		writeError(w, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("request body exceeds %d bytes", MaxBodyBytes))
+	case errors.Is(err, io.EOF):
+		writeError(w, http.StatusBadRequest, "invalid_request", "request body is required")
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		writeError(w, http.StatusBadRequest, "invalid_request", "request body must be a JSON object")
+	case errors.As(err, &typeErr):
+		writeValidationError(w, []FieldError{{Field: typeErr.Field, Code: "invalid_type", Message: "must be a " + jsonType(typeErr.Type.Kind())}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		writeValidationError(w, []FieldError{{Field: field, Code: "unknown_field", Message: "is not a known field"}})
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request format: "+err.Error())
+	}
+	return false
+}
+
+// decodeOptional decodes the body like decodeStrict if there is one, leaving
+// v unchanged for an empty body
+func decodeOptional(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	return r.ContentLength == 0 || decodeStrict(w, r, v)
+}
+
+// jsonType names the JSON type expected for a Go kind
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "number"
+}
+
+// transferBody is the wire form of a transfer request. Amount is kept raw so
+// its precision can be checked exactly.
+type transferBody struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Amount json.RawMessage `json:"amount"`
+	// FromPocket is optional
+	FromPocket string `json:"from_pocket"`
+}
+
+// validate checks every field and returns the transfer request with the
+// list of invalid fields
+func (b transferBody) validate() (service.TransferRequest, []FieldError) {
+	var fields []FieldError
+	for _, f := range []struct{ name, value string }{{"from", b.From}, {"to", b.To}} {
+		switch {
+		case f.value == "":
+			fields = append(fields, FieldError{Field: f.name, Code: "required", Message: "is required"})
+		case !service.ValidAccountRef(f.value):
+			fields = append(fields, FieldError{Field: f.name, Code: "invalid_format", Message: fmt.Sprintf("must be an account ID or 1 to %d letters, digits, '.', '_' or '-', starting with a letter or digit", service.MaxUsernameLength)})
+		}
+	}
+
+	if b.FromPocket != "" && !service.ValidPocketName(b.FromPocket) {
+		fields = append(fields, pocketNameError("from_pocket"))
+	}
+
+	amount, err := parseAmount(b.Amount)
+	if err != nil {
+		fields = append(fields, *err)
+	}
+
+	return service.TransferRequest{From: b.From, To: b.To, Amount: amount, FromPocket: b.FromPocket}, fields
+}
+
+// parseAmount checks that raw is a JSON number in (0, MaxAmount] with at most
+// AmountDecimals decimal places
+func parseAmount(raw json.RawMessage) (float64, *FieldError) {
+	literal := strings.TrimSpace(string(raw))
+	if literal == "" || literal == "null" {
+		return 0, &FieldError{Field: "amount", Code: "required", Message: "is required"}
+	}
+	if literal[0] != '-' && (literal[0] < '0' || literal[0] > '9') {
+		return 0, &FieldError{Field: "amount", Code: "invalid_type", Message: "must be a number"}
+	}
+
+	// Range checks come first so that huge exponents never reach big.Rat
+	amount, err := strconv.ParseFloat(literal, 64)
+	switch {
+	case err != nil && !errors.Is(err, strconv.ErrRange):
+		return 0, &FieldError{Field: "amount", Code: "invalid_type", Message: "must be a number"}
+	case math.IsInf(amount, 0) || amount > MaxAmount:
+		return 0, &FieldError{Field: "amount", Code: "out_of_range", Message: fmt.Sprintf("must be at most %.0f", MaxAmount)}
+	case amount <= 0:
+		return 0, &FieldError{Field: "amount", Code: "out_of_range", Message: "must be positive"}
+	}
+
+	exact, ok := new(big.Rat).SetString(literal)
+	scale := new(big.Rat).SetFloat64(math.Pow10(AmountDecimals))
+	if !ok || !exact.Mul(exact, scale).IsInt() {
+		return 0, &FieldError{Field: "amount", Code: "too_precise", Message: fmt.Sprintf("must have at most %d decimal places", AmountDecimals)}
+	}
+	return amount, nil
+}
+
+// parseOptionalAmount checks an amount that may be absent or zero, such as an
+// initial balance, like parseAmount and reports problems against field
+func parseOptionalAmount(field string, raw json.RawMessage) (float64, *FieldError) {
+	literal := strings.TrimSpace(string(raw))
+	if literal == "" || literal == "null" {
+		return 0, nil
+	}
+	if amount, err := strconv.ParseFloat(literal, 64); err == nil && amount <= 0 {
+		if amount < 0 {
+			return 0, &FieldError{Field: field, Code: "out_of_range", Message: "must not be negative"}
+		}
+		return 0, nil
+	}
+
+	amount, fieldErr := parseAmount(raw)
+	if fieldErr != nil {
+		fieldErr.Field = field
+	}
+	return amount, fieldErr
+}
+
+// profile checks the holder fields of an account request and returns the
+// profile, typed personal unless given, with the list of invalid fields
+func (req CreateAccountRequest) profile() (service.Profile, []FieldError) {
+	return ProfileRequest{DisplayName: req.DisplayName, Type: req.Type, Contact: req.Contact}.profile()
+}
+
+// profile checks the holder fields and returns the profile, typed personal
+// unless given, with the list of invalid fields
+func (req ProfileRequest) profile() (service.Profile, []FieldError) {
+	profile := service.Profile{DisplayName: strings.TrimSpace(req.DisplayName), Type: req.Type, Contact: req.Contact}
+	if profile.Type == "" {
+		profile.Type = service.TypePersonal
+	}
+
+	var fields []FieldError
+	if !service.ValidDisplayName(profile.DisplayName) {
+		fields = append(fields, FieldError{Field: "display_name", Code: "invalid_format", Message: fmt.Sprintf("must be at most %d printable characters", service.MaxDisplayNameLength)})
+	}
+	if !profile.Type.Valid() {
+		fields = append(fields, FieldError{Field: "type", Code: "invalid_format", Message: "must be personal, business or system"})
+	}
+	if email := profile.Contact.Email; email != "" && !service.ValidEmail(email) {
+		fields = append(fields, FieldError{Field: "contact.email", Code: "invalid_format", Message: "must be an email address"})
+	}
+	if phone := profile.Contact.Phone; phone != "" && !service.ValidPhone(phone) {
+		fields = append(fields, FieldError{Field: "contact.phone", Code: "invalid_format", Message: "must be an E.164 number such as +14155550123"})
+	}
+	return profile, fields
+}
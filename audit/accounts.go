@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+
+	"money-transfer-system/service"
+)
+
+// AccountManager records account creation and profile changes in an audit
+// trail
+type AccountManager struct {
+	service.AccountManager
+	auditor service.Auditor
+}
+
+// NewAccountManager wraps accountManager so that every account it creates
+// is recorded by auditor
+func NewAccountManager(accountManager service.AccountManager, auditor service.Auditor) *AccountManager {
+	return &AccountManager{AccountManager: accountManager, auditor: auditor}
+}
+
+// CreateAccount creates an account and records it without an actor
+func (m *AccountManager) CreateAccount(username string, initialBalance float64) (*service.Account, error) {
+	return m.CreateAccountContext(context.Background(), username, initialBalance)
+}
+
+// CreateAccountContext creates an account and records it for the actor in ctx
+func (m *AccountManager) CreateAccountContext(ctx context.Context, username string, initialBalance float64) (*service.Account, error) {
+	var account *service.Account
+	var err error
+	if creator, ok := m.AccountManager.(service.ContextAccountCreator); ok {
+		account, err = creator.CreateAccountContext(ctx, username, initialBalance)
+	} else {
+		account, err = m.AccountManager.CreateAccount(username, initialBalance)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.auditor.Audit(ctx, "account.created", map[string]interface{}{"id": account.ID, "username": username, "balance": initialBalance})
+	return account, nil
+}
+
+// CreateAccountWithProfile creates an account with the holder's profile and
+// records it for the actor in ctx
+func (m *AccountManager) CreateAccountWithProfile(ctx context.Context, username string, initialBalance float64, profile service.Profile) (*service.Account, error) {
+	account, err := service.CreateAccountWithProfile(ctx, m.AccountManager, username, initialBalance, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	m.auditor.Audit(ctx, "account.created", map[string]interface{}{"id": account.ID, "username": username, "balance": initialBalance})
+	return account, nil
+}
+
+// UpdateProfile replaces the holder's profile and records it for the actor
+// in ctx
+func (m *AccountManager) UpdateProfile(ctx context.Context, account *service.Account, profile service.Profile) error {
+	previous := account.GetProfile()
+	if err := service.UpdateProfile(ctx, m.AccountManager, account, profile); err != nil {
+		return err
+	}
+
+	m.auditor.Audit(ctx, "account.profile_changed", map[string]interface{}{"id": account.ID, "username": account.Username, "from": previous, "to": profile})
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package audit keeps an append-only, hash-chained log of state-changing
+// actions. Every record carries the hash of the record before it, so deleted,
+// reordered or edited entries break the chain and are reported by Verify.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"money-transfer-system/service"
+)
+
+// Record is one line of the audit log
+type Record struct {
+	Seq       uint64          `json:"seq"`
+	Time      string          `json:"time"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	// PrevHash is the hash of the previous record, empty for the first
+	PrevHash string `json:"prev_hash"`
+	// Hash covers every other field of the record, including PrevHash
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hex SHA-256 of the record with Hash left empty
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends records to a writer, one JSON object per line
+type Log struct {
+	mutex    sync.Mutex
+	w        io.Writer
+	file     *os.File
+	seq      uint64
+	prevHash string
+	err      error
+}
+
+// NewLog starts a new chain written to w
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Open verifies the log at path and continues its chain, creating the file
+// if it does not exist. A log that fails verification is not opened.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := Verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log %s: %w", path, err)
+	}
+
+	return &Log{w: f, file: f, seq: uint64(result.Records), prevHash: result.Head}, nil
+}
+
+// Append adds a record for the action and returns it
+func (l *Log) Append(action, actor, requestID string, details map[string]interface{}) (Record, error) {
+	record := Record{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Action:    action,
+		Actor:     actor,
+		RequestID: requestID,
+	}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return Record{}, err
+		}
+		record.Details = data
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	record.Seq = l.seq + 1
+	record.PrevHash = l.prevHash
+	hash, err := record.computeHash()
+	if err != nil {
+		return Record{}, err
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return Record{}, err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		l.err = err
+		return Record{}, err
+	}
+
+	l.seq = record.Seq
+	l.prevHash = record.Hash
+	return record, nil
+}
+
+// Audit appends a record for the actor and request ID carried by ctx.
+// Write failures are kept and reported by Err.
+func (l *Log) Audit(ctx context.Context, action string, details map[string]interface{}) {
+	l.Append(action, service.ActorFromContext(ctx), service.RequestIDFromContext(ctx), details)
+}
+
+// Head returns the hash of the last record, which can be published so that
+// a later truncation of the log is detectable
+func (l *Log) Head() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.prevHash
+}
+
+// Err returns the most recent write error, if any
+func (l *Log) Err() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.err
+}
+
+// Flush syncs the log file to disk
+func (l *Log) Flush() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Sync()
+}
+
+// Close syncs and closes the log file
+func (l *Log) Close() error {
+	if err := l.Flush(); err != nil {
+		return err
+	}
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Result summarises a verified log
+type Result struct {
+	Records int
+	// Head is the hash of the last record, empty for an empty log
+	Head string
+}
+
+// VerifyError describes where and how the chain is broken
+type VerifyError struct {
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// ErrAnchorNotFound is returned when an anchored hash is not in the chain,
+// which means the log was truncated or rewritten
+var ErrAnchorNotFound = errors.New("anchored record not found")
+
+// Verify reads a log and checks every record's hash, sequence number and
+// link to the previous record. Each anchor, a head hash published earlier,
+// must appear in the chain; this detects records deleted from the end.
+func Verify(r io.Reader, anchors ...string) (Result, error) {
+	pending := make(map[string]bool, len(anchors))
+	for _, anchor := range anchors {
+		pending[anchor] = true
+	}
+
+	var result Result
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return result, &VerifyError{Line: line, Reason: "malformed record: " + err.Error()}
+		}
+
+		hash, err := record.computeHash()
+		if err != nil {
+			return result, &VerifyError{Line: line, Seq: record.Seq, Reason: err.Error()}
+		}
+		expected := uint64(result.Records) + 1
+		switch {
+		case hash != record.Hash:
+			return result, &VerifyError{Line: line, Seq: record.Seq, Reason: "hash mismatch, record was edited"}
+		case record.Seq > expected:
+			return result, &VerifyError{Line: line, Seq: record.Seq, Reason: fmt.Sprintf("expected seq %d, records were deleted", expected)}
+		case record.Seq < expected:
+			return result, &VerifyError{Line: line, Seq: record.Seq, Reason: fmt.Sprintf("expected seq %d, records were reordered or duplicated", expected)}
+		case record.PrevHash != result.Head:
+			return result, &VerifyError{Line: line, Seq: record.Seq, Reason: "previous hash mismatch, chain was rewritten"}
+		}
+
+		delete(pending, record.Hash)
+		result.Records++
+		result.Head = record.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	for anchor := range pending {
+		return result, fmt.Errorf("%w: %s", ErrAnchorNotFound, anchor)
+	}
+	return result, nil
+}
+
+// VerifyFile verifies the log at path
+func VerifyFile(path string, anchors ...string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	return Verify(f, anchors...)
+}
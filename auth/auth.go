@@ -0,0 +1,105 @@
+// Package auth authenticates API callers and describes what they are
+// allowed to do.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Scope is a permission granted to a credential
+type Scope string
+
+// Scopes
+const (
+	ScopeRead     Scope = "read"
+	ScopeTransfer Scope = "transfer"
+	ScopeAdmin    Scope = "admin"
+)
+
+// Valid reports whether the scope is a known scope
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopeRead, ScopeTransfer, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// ParseScopes converts scope names, rejecting unknown ones
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(name)
+		if !scope.Valid() {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// Common errors
+var (
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+	ErrKeyNotFound     = errors.New("api key not found")
+	ErrKeyExists       = errors.New("api key already exists")
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	ID     string
+	Scopes []Scope
+	Roles  []Role
+	// Accounts are the usernames the principal owns
+	Accounts []string
+	// AllAccounts lets the principal act on any account as an owner; only
+	// admin keys can carry it
+	AllAccounts bool
+}
+
+// HasScope reports whether the principal was granted the scope. The admin
+// scope grants every scope.
+func (p *Principal) HasScope(scope Scope) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the principal owns the account. Permissions such
+// as accounts:read_any are checked separately against the policy.
+func (p *Principal) CanAccess(username string) bool {
+	if p == nil {
+		return false
+	}
+	if p.AllAccounts {
+		return true
+	}
+	for _, owned := range p.Accounts {
+		if owned == username {
+			return true
+		}
+	}
+	return false
+}
+
+// principalKey is the context key for the authenticated principal
+type principalKey struct{}
+
+// ContextWithPrincipal returns a context carrying the principal
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated principal, or nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// clockSkew is how far exp and nbf may be off before a token is rejected
+const clockSkew = 30 * time.Second
+
+// verificationKey is a key that can check token signatures. Keys without a
+// kid match any token signed with their algorithm.
+type verificationKey struct {
+	kid    string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// JWTVerifier authenticates HS256 and RS256 signed JWT bearer tokens and maps
+// their subject to the accounts it owns
+type JWTVerifier struct {
+	issuer   string
+	audience string
+	keys     []verificationKey
+	owners   map[string][]string
+}
+
+// NewJWTVerifier creates a verifier that requires the given issuer and
+// audience claims, unless they are empty
+func NewJWTVerifier(issuer, audience string) *JWTVerifier {
+	return &JWTVerifier{issuer: issuer, audience: audience}
+}
+
+// AddHMACKey trusts tokens signed with HS256 and the shared secret
+func (v *JWTVerifier) AddHMACKey(kid string, secret []byte) {
+	v.keys = append(v.keys, verificationKey{kid: kid, alg: AlgHS256, secret: secret})
+}
+
+// AddRSAKey trusts tokens signed with RS256 and the matching private key
+func (v *JWTVerifier) AddRSAKey(kid string, key *rsa.PublicKey) {
+	v.keys = append(v.keys, verificationKey{kid: kid, alg: AlgRS256, public: key})
+}
+
+// SetOwners maps token subjects to the usernames they own. Without a mapping
+// a token's accounts claim is used, or else its subject as the username.
+func (v *JWTVerifier) SetOwners(owners map[string][]string) {
+	v.owners = owners
+}
+
+// LoadHMACKeyFile reads a shared secret from a file. Surrounding whitespace
+// is ignored.
+func (v *JWTVerifier) LoadHMACKeyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < 32 {
+		return fmt.Errorf("%s: HMAC secret must be at least 32 bytes", path)
+	}
+	v.AddHMACKey("", secret)
+	return nil
+}
+
+// LoadRSAKeyFile reads a PEM encoded RSA public key or certificate
+func (v *JWTVerifier) LoadRSAKeyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var public interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			public = cert.PublicKey
+		}
+	default:
+		return fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, ok := public.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s: not an RSA public key", path)
+	}
+	v.AddRSAKey("", key)
+	return nil
+}
+
+// jwk is one key of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// LoadJWKSFile reads RSA ("RSA") and HMAC ("oct") keys from a JWKS file
+func (v *JWTVerifier) LoadJWKSFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(key.N)
+			e, errE := base64.RawURLEncoding.DecodeString(key.E)
+			if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+				return fmt.Errorf("%s: key %d: invalid RSA modulus or exponent", path, i)
+			}
+			v.AddRSAKey(key.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) < 32 {
+				return fmt.Errorf("%s: key %d: HMAC secret must be at least 32 bytes", path, i)
+			}
+			v.AddHMACKey(key.Kid, secret)
+		default:
+			return fmt.Errorf("%s: key %d: unsupported key type %q", path, i, key.Kty)
+		}
+	}
+	return nil
+}
+
+// LoadOwnersFile reads a JSON object mapping subjects to owned usernames
+func LoadOwnersFile(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var owners map[string][]string
+	if err := json.Unmarshal(data, &owners); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return owners, nil
+}
+
+// audience is the aud claim, which may be a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// claims are the JWT claims the verifier understands
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Roles     []Role   `json:"roles"`
+	Accounts  []string `json:"accounts"`
+}
+
+// IsJWT reports whether a bearer credential looks like a JWT rather than an
+// API key
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Authenticate verifies a token's signature and claims and returns its
+// principal. Scopes come from the space-separated scope claim, with unknown
+// scopes ignored, and roles from the roles claim.
+func (v *JWTVerifier) Authenticate(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthenticated
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	if !v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return nil, ErrUnauthenticated
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	if err := v.validateClaims(c); err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{ID: c.Subject, Roles: c.Roles}
+	for _, name := range strings.Fields(c.Scope) {
+		if scope := Scope(name); scope.Valid() {
+			principal.Scopes = append(principal.Scopes, scope)
+		}
+	}
+
+	if v.owners != nil {
+		principal.Accounts = v.owners[c.Subject]
+	} else if c.Accounts != nil {
+		principal.Accounts = c.Accounts
+	} else {
+		principal.Accounts = []string{c.Subject}
+	}
+	return principal, nil
+}
+
+// verifySignature checks the signature with every trusted key matching the
+// algorithm and key ID. The algorithm must match the key type, so an RSA
+// public key can never be used as an HMAC secret.
+func (v *JWTVerifier) verifySignature(alg, kid, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+
+	for _, key := range v.keys {
+		if key.alg != alg || (key.kid != "" && kid != "" && key.kid != kid) {
+			continue
+		}
+
+		switch alg {
+		case AlgHS256:
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write([]byte(signed))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case AlgRS256:
+			if rsa.VerifyPKCS1v15(key.public, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateClaims checks expiry, issuer and audience
+func (v *JWTVerifier) validateClaims(c claims) error {
+	now := time.Now()
+
+	switch {
+	case c.Subject == "":
+		return fmt.Errorf("%w: token has no subject", ErrUnauthenticated)
+	case c.ExpiresAt == nil:
+		return fmt.Errorf("%w: token has no expiry", ErrUnauthenticated)
+	case now.After(time.Unix(*c.ExpiresAt, 0).Add(clockSkew)):
+		return fmt.Errorf("%w: token expired", ErrUnauthenticated)
+	case c.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*c.NotBefore, 0)):
+		return fmt.Errorf("%w: token not yet valid", ErrUnauthenticated)
+	case v.issuer != "" && c.Issuer != v.issuer:
+		return fmt.Errorf("%w: unexpected issuer", ErrUnauthenticated)
+	}
+
+	if v.audience != "" {
+		for _, aud := range c.Audience {
+			if aud == v.audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unexpected audience", ErrUnauthenticated)
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("invalid token segment")
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyPrefix starts every generated API key, so keys are easy to recognise
+// in logs and secret scanners
+const KeyPrefix = "mts_"
+
+// Key is a stored API key. Only the SHA-256 hash of the secret is kept.
+type Key struct {
+	ID        string       `json:"id"`
+	Hash      string       `json:"hash"`
+	Scopes    []Scope      `json:"scopes,omitempty"`
+	Roles     []Role       `json:"roles,omitempty"`
+	Accounts  []string     `json:"accounts,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	Previous  *RetiredHash `json:"previous,omitempty"`
+
+	// AllAccounts lets an admin key act on any account as an owner
+	AllAccounts bool `json:"all_accounts,omitempty"`
+}
+
+// RetiredHash is the hash of a rotated-out secret, accepted until it expires
+// so clients can switch to the new secret without downtime
+type RetiredHash struct {
+	Hash      string    `json:"hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HashKey returns the hex SHA-256 hash of an API key secret
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateSecret returns a new random API key secret
+func generateSecret() string {
+	var b [32]byte
+	rand.Read(b[:])
+	return KeyPrefix + hex.EncodeToString(b[:])
+}
+
+// validHash reports whether s looks like a hex SHA-256 hash
+func validHash(s string) bool {
+	if len(s) != 2*sha256.Size || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// validate checks a key loaded from a file
+func (k *Key) validate() error {
+	if k.ID == "" {
+		return errors.New("id is required")
+	}
+	if !validHash(k.Hash) {
+		return fmt.Errorf("key %q: hash must be a hex SHA-256 hash", k.ID)
+	}
+	if len(k.Scopes) == 0 && len(k.Roles) == 0 {
+		return fmt.Errorf("key %q: at least one scope or role is required", k.ID)
+	}
+	for _, scope := range k.Scopes {
+		if !scope.Valid() {
+			return fmt.Errorf("key %q: unknown scope %q", k.ID, scope)
+		}
+	}
+	for _, role := range k.Roles {
+		if role == "" {
+			return fmt.Errorf("key %q: role name is required", k.ID)
+		}
+	}
+	if k.AllAccounts && !k.isAdmin() {
+		return fmt.Errorf("key %q: all_accounts requires the admin role or scope", k.ID)
+	}
+	if k.Previous != nil && !validHash(k.Previous.Hash) {
+		return fmt.Errorf("key %q: previous hash must be a hex SHA-256 hash", k.ID)
+	}
+	return nil
+}
+
+// isAdmin reports whether the key has the admin role or scope
+func (k *Key) isAdmin() bool {
+	for _, role := range k.Roles {
+		if role == RoleAdmin {
+			return true
+		}
+	}
+	for _, scope := range k.Scopes {
+		if scope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore holds API keys and authenticates secrets against them. A store
+// opened from a file writes every change back to it.
+type KeyStore struct {
+	mutex sync.RWMutex
+	path  string
+	keys  map[string]*Key
+}
+
+// NewKeyStore creates an empty in-memory key store
+func NewKeyStore() *KeyStore {
+	return &KeyStore{keys: make(map[string]*Key)}
+}
+
+// OpenKeyStore loads the keys in the JSON file at path. A missing file gives
+// an empty store that is created on the first change.
+func OpenKeyStore(path string) (*KeyStore, error) {
+	s := NewKeyStore()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate key id %q", path, key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// CheckRoles returns an error for the first key with a role the policy does
+// not define, since such a role would grant nothing
+func (s *KeyStore) CheckRoles(policy *Policy) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, key := range s.sortedKeys() {
+		for _, role := range key.Roles {
+			if !policy.HasRole(role) {
+				return fmt.Errorf("key %q: unknown role %q", key.ID, role)
+			}
+		}
+	}
+	return nil
+}
+
+// save writes the keys back to the store's file, if it has one
+func (s *KeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.sortedKeys(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// update stores key under id, or deletes it if key is nil, and persists the
+// change, restoring the previous key if it cannot be saved
+func (s *KeyStore) update(id string, key *Key) error {
+	old, existed := s.keys[id]
+	if key == nil {
+		delete(s.keys, id)
+	} else {
+		s.keys[id] = key
+	}
+
+	if err := s.save(); err != nil {
+		if existed {
+			s.keys[id] = old
+		} else {
+			delete(s.keys, id)
+		}
+		return err
+	}
+	return nil
+}
+
+// sortedKeys returns the keys ordered by ID
+func (s *KeyStore) sortedKeys() []*Key {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Create adds a key with a newly generated secret. The secret is returned
+// once and cannot be recovered later.
+func (s *KeyStore) Create(id string, scopes []Scope, expiresAt *time.Time) (string, Key, error) {
+	return s.Issue(Key{ID: id, Scopes: scopes, ExpiresAt: expiresAt})
+}
+
+// Issue adds a key with the ID, scopes, roles, accounts and expiry of the
+// template and a newly generated secret. A key without accounts owns none;
+// it reaches other accounts only through permissions such as
+// transfers:debit_any, or through AllAccounts, which only admin keys may set.
+func (s *KeyStore) Issue(template Key) (string, Key, error) {
+	secret := generateSecret()
+	key := &Key{
+		ID:          template.ID,
+		Hash:        HashKey(secret),
+		Scopes:      template.Scopes,
+		Roles:       template.Roles,
+		Accounts:    template.Accounts,
+		AllAccounts: template.AllAccounts,
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   template.ExpiresAt,
+	}
+	if err := key.validate(); err != nil {
+		return "", Key{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.keys[key.ID]; ok {
+		return "", Key{}, ErrKeyExists
+	}
+	if err := s.update(key.ID, key); err != nil {
+		return "", Key{}, err
+	}
+	return secret, *key, nil
+}
+
+// Rotate replaces a key's secret. The old secret keeps working for the
+// overlap period; an overlap of zero revokes it immediately.
+func (s *KeyStore) Rotate(id string, overlap time.Duration) (string, Key, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, ok := s.keys[id]
+	if !ok {
+		return "", Key{}, ErrKeyNotFound
+	}
+
+	secret := generateSecret()
+	key := *old
+	key.Hash = HashKey(secret)
+	key.Previous = nil
+	if overlap > 0 {
+		key.Previous = &RetiredHash{Hash: old.Hash, ExpiresAt: time.Now().Add(overlap).UTC()}
+	}
+
+	if err := s.update(id, &key); err != nil {
+		return "", Key{}, err
+	}
+	return secret, key, nil
+}
+
+// Revoke deletes a key, invalidating its current and previous secrets
+func (s *KeyStore) Revoke(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+	return s.update(id, nil)
+}
+
+// List returns the stored keys ordered by ID
+func (s *KeyStore) List() []Key {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.sortedKeys() {
+		keys = append(keys, *key)
+	}
+	return keys
+}
+
+// Authenticate returns the principal for an API key secret, accepting the
+// previous secret of a rotated key until its overlap period ends
+func (s *KeyStore) Authenticate(secret string) (*Principal, error) {
+	if secret == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	hash := []byte(HashKey(secret))
+	now := time.Now()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, key := range s.keys {
+		if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+			continue
+		}
+
+		match := subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1
+		if !match && key.Previous != nil && now.Before(key.Previous.ExpiresAt) {
+			match = subtle.ConstantTimeCompare(hash, []byte(key.Previous.Hash)) == 1
+		}
+		if match {
+			return &Principal{
+				ID:          key.ID,
+				Scopes:      append([]Scope(nil), key.Scopes...),
+				Roles:       append([]Role(nil), key.Roles...),
+				Accounts:    append([]string(nil), key.Accounts...),
+				AllAccounts: key.AllAccounts,
+			}, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
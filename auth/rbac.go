@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Permission allows one kind of operation
+type Permission string
+
+// Permissions checked by the API
+const (
+	PermAccountsRead      Permission = "accounts:read"
+	PermAccountsReadAny   Permission = "accounts:read_any"
+	PermAccountsCreate    Permission = "accounts:create"
+	PermAccountsFund      Permission = "accounts:fund"
+	PermAccountsFreeze    Permission = "accounts:freeze"
+	PermAccountsLimits    Permission = "accounts:limits"
+	PermTransfersCreate   Permission = "transfers:create"
+	PermTransfersDebitAny Permission = "transfers:debit_any"
+	PermTransfersApprove  Permission = "transfers:approve"
+	PermApprovalsRead     Permission = "approvals:read"
+	PermKeysManage        Permission = "keys:manage"
+	PermScreeningReview   Permission = "screening:review"
+
+	// PermAll grants every permission
+	PermAll Permission = "*"
+)
+
+// Valid reports whether the permission is checked by the API or is PermAll
+func (p Permission) Valid() bool {
+	switch p {
+	case PermAccountsRead, PermAccountsReadAny, PermAccountsCreate, PermAccountsFund, PermAccountsFreeze, PermAccountsLimits,
+		PermTransfersCreate, PermTransfersDebitAny, PermTransfersApprove, PermApprovalsRead, PermKeysManage, PermScreeningReview,
+		PermAll:
+		return true
+	}
+	return false
+}
+
+// Role is a named set of permissions
+type Role string
+
+// Built-in roles
+const (
+	RoleCustomer   Role = "customer"
+	RoleSupport    Role = "support"
+	RoleTreasury   Role = "treasury"
+	RoleCompliance Role = "compliance"
+	RoleAdmin      Role = "admin"
+)
+
+// Policy maps roles and credential scopes to permissions
+type Policy struct {
+	Roles  map[Role][]Permission  `json:"roles"`
+	Scopes map[Scope][]Permission `json:"scopes"`
+}
+
+// DefaultPolicy returns the built-in role and scope mappings
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Roles: map[Role][]Permission{
+			RoleCustomer:   {PermAccountsRead, PermTransfersCreate},
+			RoleSupport:    {PermAccountsRead, PermAccountsReadAny, PermAccountsCreate, PermAccountsFreeze, PermApprovalsRead},
+			RoleTreasury:   {PermAccountsRead, PermAccountsReadAny, PermAccountsFund, PermAccountsLimits, PermTransfersCreate, PermTransfersDebitAny, PermTransfersApprove, PermApprovalsRead},
+			RoleCompliance: {PermAccountsRead, PermAccountsReadAny, PermScreeningReview},
+			RoleAdmin:      {PermAll},
+		},
+		Scopes: map[Scope][]Permission{
+			ScopeRead:     {PermAccountsRead},
+			ScopeTransfer: {PermTransfersCreate},
+			ScopeAdmin:    {PermAll},
+		},
+	}
+}
+
+// LoadPolicyFile reads a JSON policy. Roles and scopes missing from the file
+// keep their built-in permissions; roles it adds become available too.
+// Unknown fields, scopes and permissions are rejected, so a typo cannot
+// silently leave a role without access.
+func LoadPolicyFile(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file Policy
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	policy := DefaultPolicy()
+	for role, perms := range file.Roles {
+		if role == "" {
+			return nil, fmt.Errorf("%s: role name is required", path)
+		}
+		if err := checkPermissions(perms); err != nil {
+			return nil, fmt.Errorf("%s: role %q: %w", path, role, err)
+		}
+		policy.Roles[role] = perms
+	}
+	for scope, perms := range file.Scopes {
+		if !scope.Valid() {
+			return nil, fmt.Errorf("%s: unknown scope %q", path, scope)
+		}
+		if err := checkPermissions(perms); err != nil {
+			return nil, fmt.Errorf("%s: scope %q: %w", path, scope, err)
+		}
+		policy.Scopes[scope] = perms
+	}
+	return policy, nil
+}
+
+// checkPermissions returns an error for the first unknown permission
+func checkPermissions(perms []Permission) error {
+	for _, perm := range perms {
+		if !perm.Valid() {
+			return fmt.Errorf("unknown permission %q", perm)
+		}
+	}
+	return nil
+}
+
+// HasRole reports whether the policy defines the role
+func (p *Policy) HasRole(role Role) bool {
+	_, ok := p.Roles[role]
+	return ok
+}
+
+// Permissions returns every permission the principal holds through its
+// roles and scopes, sorted
+func (p *Policy) Permissions(principal *Principal) []Permission {
+	if principal == nil {
+		return nil
+	}
+
+	set := make(map[Permission]bool)
+	for _, role := range principal.Roles {
+		for _, perm := range p.Roles[role] {
+			set[perm] = true
+		}
+	}
+	for _, scope := range principal.Scopes {
+		for _, perm := range p.Scopes[scope] {
+			set[perm] = true
+		}
+	}
+
+	perms := make([]Permission, 0, len(set))
+	for perm := range set {
+		perms = append(perms, perm)
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+	return perms
+}
+
+// Allows reports whether the principal holds the permission
+func (p *Policy) Allows(principal *Principal, perm Permission) bool {
+	if principal == nil {
+		return false
+	}
+
+	grants := func(perms []Permission) bool {
+		for _, held := range perms {
+			if held == perm || held == PermAll {
+				return true
+			}
+		}
+		return false
+	}
+	for _, role := range principal.Roles {
+		if grants(p.Roles[role]) {
+			return true
+		}
+	}
+	for _, scope := range principal.Scopes {
+		if grants(p.Scopes[scope]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Command apikey creates, rotates and revokes API keys in a key file, so the
+// first admin key can be issued before the server is started.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"money-transfer-system/auth"
+)
+
+func main() {
+	file := flag.String("file", "keys.json", "API key file")
+	id := flag.String("id", "", "key ID")
+	scopes := flag.String("scopes", "", "comma-separated scopes for a new key (read, transfer, admin)")
+	roles := flag.String("roles", "", "comma-separated roles for a new key (customer, support, treasury, admin)")
+	accounts := flag.String("accounts", "", "comma-separated usernames a new key owns")
+	allAccounts := flag.Bool("all-accounts", false, "let a new admin key act on every account as an owner")
+	expires := flag.Duration("expires", 0, "lifetime of a new key (0 never expires)")
+	rotate := flag.Bool("rotate", false, "rotate the key instead of creating it")
+	overlap := flag.Duration("overlap", 24*time.Hour, "how long the old secret keeps working after -rotate")
+	revoke := flag.Bool("revoke", false, "revoke the key instead of creating it")
+	list := flag.Bool("list", false, "list keys and exit")
+	flag.Parse()
+
+	log.SetFlags(0)
+	keys, err := auth.OpenKeyStore(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *list {
+		for _, key := range keys.List() {
+			fmt.Printf("%s\tscopes=%v\troles=%v\tcreated %s\n", key.ID, key.Scopes, key.Roles, key.CreatedAt.Format(time.RFC3339))
+		}
+		return
+	}
+
+	if *id == "" {
+		fmt.Fprintln(os.Stderr, "-id is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var secret string
+	switch {
+	case *revoke:
+		err = keys.Revoke(*id)
+	case *rotate:
+		secret, _, err = keys.Rotate(*id, *overlap)
+	default:
+		var parsed []auth.Scope
+		if *scopes != "" {
+			if parsed, err = auth.ParseScopes(strings.Split(*scopes, ",")); err != nil {
+				break
+			}
+		}
+		var expiresAt *time.Time
+		if *expires > 0 {
+			t := time.Now().Add(*expires).UTC()
+			expiresAt = &t
+		}
+		key := auth.Key{ID: *id, Scopes: parsed, AllAccounts: *allAccounts, ExpiresAt: expiresAt}
+		if *roles != "" {
+			for _, role := range strings.Split(*roles, ",") {
+				key.Roles = append(key.Roles, auth.Role(role))
+			}
+		}
+		if *accounts != "" {
+			key.Accounts = strings.Split(*accounts, ",")
+		}
+		secret, _, err = keys.Issue(key)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Only the secret goes to stdout, so it can be captured by scripts
+	if secret != "" {
+		fmt.Println(secret)
+	}
+}
@@ -0,0 +1,31 @@
+// Command auditverify checks an audit log's hash chain and reports the first
+// deleted, reordered or edited record. It exits non-zero if the log is broken.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"money-transfer-system/audit"
+)
+
+func main() {
+	file := flag.String("file", "audit.log", "audit log file")
+	anchors := flag.String("anchor", "", "comma-separated head hashes recorded earlier; each must still be in the log")
+	flag.Parse()
+
+	log.SetFlags(0)
+	var expected []string
+	if *anchors != "" {
+		expected = strings.Split(*anchors, ",")
+	}
+
+	result, err := audit.VerifyFile(*file, expected...)
+	if err != nil {
+		log.Fatalf("%s: verification failed after %d records: %v", *file, result.Records, err)
+	}
+
+	fmt.Printf("%s: %d records verified, head %s\n", *file, result.Records, result.Head)
+}
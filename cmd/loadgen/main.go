@@ -0,0 +1,281 @@
+// Command loadgen generates transfer and read load against a running
+// money transfer server and reports latency, errors and a final
+// conservation-of-money check.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// config holds the load generator settings
+type config struct {
+	addr        string
+	accounts    int
+	balance     float64
+	prefix      string
+	duration    time.Duration
+	mode        string
+	concurrency int
+	rps         float64
+	readRatio   float64
+	zipfS       float64
+	maxAmount   int
+	timeout     time.Duration
+	apiKey      string
+}
+
+func parseFlags() config {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", "http://localhost:8081", "base URL of the transfer server")
+	flag.IntVar(&cfg.accounts, "accounts", 100, "number of accounts to create")
+	flag.Float64Var(&cfg.balance, "balance", 1000, "initial balance of each account")
+	flag.StringVar(&cfg.prefix, "prefix", fmt.Sprintf("loadgen-%d-", time.Now().Unix()), "username prefix for created accounts")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to generate load")
+	flag.StringVar(&cfg.mode, "mode", "closed", "load model: closed (fixed concurrency) or open (fixed arrival rate)")
+	flag.IntVar(&cfg.concurrency, "concurrency", 16, "number of workers in closed-loop mode")
+	flag.Float64Var(&cfg.rps, "rps", 500, "target requests per second in open-loop mode")
+	flag.Float64Var(&cfg.readRatio, "read-ratio", 0.5, "fraction of requests that are account reads")
+	flag.Float64Var(&cfg.zipfS, "zipf-s", 0, "Zipf skew for account selection (must be > 1; 0 selects uniformly)")
+	flag.IntVar(&cfg.maxAmount, "max-amount", 10, "maximum transfer amount")
+	flag.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "per-request timeout")
+	flag.StringVar(&cfg.apiKey, "api-key", os.Getenv("MTS_API_KEY"), "API key with read, transfer and admin scopes, if the server requires one")
+	flag.Parse()
+
+	return cfg
+}
+
+func (cfg config) validate() error {
+	switch {
+	case cfg.accounts < 2:
+		return fmt.Errorf("-accounts must be at least 2")
+	case cfg.mode != "closed" && cfg.mode != "open":
+		return fmt.Errorf("-mode must be closed or open, got %q", cfg.mode)
+	case cfg.mode == "closed" && cfg.concurrency < 1:
+		return fmt.Errorf("-concurrency must be positive")
+	case cfg.mode == "open" && cfg.rps <= 0:
+		return fmt.Errorf("-rps must be positive")
+	case cfg.readRatio < 0 || cfg.readRatio > 1:
+		return fmt.Errorf("-read-ratio must be between 0 and 1")
+	case cfg.zipfS != 0 && cfg.zipfS <= 1:
+		return fmt.Errorf("-zipf-s must be greater than 1")
+	case cfg.maxAmount < 1:
+		return fmt.Errorf("-max-amount must be positive")
+	}
+	return nil
+}
+
+// generator issues requests against the server and records their outcome
+type generator struct {
+	cfg    config
+	client *http.Client
+	names  []string
+	stats  *stats
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+	zipf  *rand.Zipf
+}
+
+// apiKeyTransport adds the API key to every request
+type apiKeyTransport struct {
+	key string
+}
+
+func (t apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.key != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-API-Key", t.key)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newGenerator(cfg config) *generator {
+	g := &generator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.timeout, Transport: apiKeyTransport{key: cfg.apiKey}},
+		stats:  newStats(),
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for i := 0; i < cfg.accounts; i++ {
+		g.names = append(g.names, fmt.Sprintf("%s%d", cfg.prefix, i))
+	}
+
+	if cfg.zipfS > 1 {
+		g.zipf = rand.NewZipf(g.rng, cfg.zipfS, 1, uint64(cfg.accounts-1))
+	}
+
+	return g
+}
+
+// pickAccount returns an account index, skewed towards low indexes under Zipf
+func (g *generator) pickAccount() int {
+	if g.zipf != nil {
+		return int(g.zipf.Uint64())
+	}
+	return g.rng.Intn(g.cfg.accounts)
+}
+
+// nextRequest chooses the next operation under the shared random source
+func (g *generator) nextRequest() (op string, from, to string, amount int) {
+	g.rngMu.Lock()
+	defer g.rngMu.Unlock()
+
+	if g.rng.Float64() < g.cfg.readRatio {
+		return "read", g.names[g.pickAccount()], "", 0
+	}
+
+	i, j := g.pickAccount(), g.pickAccount()
+	for i == j {
+		j = g.rng.Intn(g.cfg.accounts)
+	}
+	return "transfer", g.names[i], g.names[j], 1 + g.rng.Intn(g.cfg.maxAmount)
+}
+
+// do issues one request; start is the intended send time so open-loop
+// latencies include any queueing delay in the generator
+func (g *generator) do(start time.Time) {
+	op, from, to, amount := g.nextRequest()
+
+	var resp *http.Response
+	var err error
+	if op == "read" {
+		resp, err = g.client.Get(g.cfg.addr + "/accounts/" + from)
+	} else {
+		body, _ := json.Marshal(map[string]interface{}{"from": from, "to": to, "amount": amount})
+		resp, err = g.client.Post(g.cfg.addr+"/transfer", "application/json", bytes.NewReader(body))
+	}
+
+	outcome := "transport_error"
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		outcome = fmt.Sprintf("%d", resp.StatusCode)
+	}
+
+	g.stats.record(op, outcome, time.Since(start))
+}
+
+// setup creates the load generator's accounts through the API
+func (g *generator) setup() error {
+	for _, name := range g.names {
+		body, _ := json.Marshal(map[string]interface{}{"username": name, "balance": g.cfg.balance})
+		resp, err := g.client.Post(g.cfg.addr+"/accounts", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			return fmt.Errorf("creating %s: unexpected status %d", name, resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+// runClosed keeps a fixed number of workers busy until the deadline
+func (g *generator) runClosed(deadline time.Time) {
+	var wg sync.WaitGroup
+	for i := 0; i < g.cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				g.do(time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runOpen dispatches requests at the target rate regardless of how fast
+// the server responds
+func (g *generator) runOpen(deadline time.Time) {
+	interval := time.Duration(float64(time.Second) / g.cfg.rps)
+	var wg sync.WaitGroup
+
+	for next := time.Now(); next.Before(deadline); next = next.Add(interval) {
+		if d := time.Until(next); d > 0 {
+			time.Sleep(d)
+		}
+
+		wg.Add(1)
+		go func(scheduled time.Time) {
+			defer wg.Done()
+			g.do(scheduled)
+		}(next)
+	}
+	wg.Wait()
+}
+
+// checkConservation verifies the created accounts still hold the money they started with
+func (g *generator) checkConservation() (expected, actual float64, err error) {
+	resp, err := g.client.Get(g.cfg.addr + "/accounts")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	var accounts []struct {
+		Username string  `json:"username"`
+		Balance  float64 `json:"balance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&accounts); err != nil {
+		return 0, 0, err
+	}
+
+	for _, account := range accounts {
+		if strings.HasPrefix(account.Username, g.cfg.prefix) {
+			actual += account.Balance
+		}
+	}
+
+	return g.cfg.balance * float64(g.cfg.accounts), actual, nil
+}
+
+func main() {
+	cfg := parseFlags()
+	if err := cfg.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	g := newGenerator(cfg)
+
+	log.Printf("Creating %d accounts with prefix %q...", cfg.accounts, cfg.prefix)
+	if err := g.setup(); err != nil {
+		log.Fatalf("setup failed: %v", err)
+	}
+
+	log.Printf("Running %s-loop load for %v...", cfg.mode, cfg.duration)
+	started := time.Now()
+	deadline := started.Add(cfg.duration)
+	if cfg.mode == "open" {
+		g.runOpen(deadline)
+	} else {
+		g.runClosed(deadline)
+	}
+
+	g.stats.report(os.Stdout, time.Since(started))
+
+	expected, actual, err := g.checkConservation()
+	if err != nil {
+		log.Fatalf("conservation check failed: %v", err)
+	}
+
+	if expected != actual {
+		fmt.Printf("\nConservation check FAILED: expected total %.2f, got %.2f\n", expected, actual)
+		os.Exit(1)
+	}
+	fmt.Printf("\nConservation check passed: total %.2f\n", actual)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stats collects request latencies and outcomes per operation
+type stats struct {
+	mutex     sync.Mutex
+	latencies map[string][]time.Duration
+	outcomes  map[string]map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		latencies: make(map[string][]time.Duration),
+		outcomes:  make(map[string]map[string]int),
+	}
+}
+
+// record stores the latency and outcome of one request
+func (s *stats) record(op, outcome string, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latencies[op] = append(s.latencies[op], latency)
+	if s.outcomes[op] == nil {
+		s.outcomes[op] = make(map[string]int)
+	}
+	s.outcomes[op][outcome]++
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// report writes throughput, latency percentiles and the outcome breakdown
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ops := make([]string, 0, len(s.latencies))
+	total := 0
+	for op, latencies := range s.latencies {
+		ops = append(ops, op)
+		total += len(latencies)
+	}
+	sort.Strings(ops)
+
+	fmt.Fprintf(w, "\nRequests: %d in %v (%.1f req/s)\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+
+	fmt.Fprintf(w, "\n%-10s %8s %10s %10s %10s %10s %10s\n", "op", "count", "p50", "p90", "p99", "p99.9", "max")
+	for _, op := range ops {
+		latencies := s.latencies[op]
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		fmt.Fprintf(w, "%-10s %8d %10v %10v %10v %10v %10v\n", op, len(latencies),
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99),
+			percentile(latencies, 99.9), latencies[len(latencies)-1])
+	}
+
+	fmt.Fprintf(w, "\nOutcomes:\n")
+	for _, op := range ops {
+		codes := make([]string, 0, len(s.outcomes[op]))
+		for code := range s.outcomes[op] {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+
+		for _, code := range codes {
+			fmt.Fprintf(w, "  %-10s %-16s %d\n", op, code, s.outcomes[op][code])
+		}
+	}
+}
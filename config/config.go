@@ -0,0 +1,720 @@
+// Package config loads server configuration from defaults, a JSON or YAML
+// file, environment variables and command-line flags.
+//
+// Sources are applied in increasing order of precedence:
+//
+//	defaults < config file < environment variables < flags
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prepended to every environment variable name
+const EnvPrefix = "MTS_"
+
+// Store backends
+const (
+	BackendMemory  = "memory"
+	BackendSharded = "sharded"
+)
+
+// Config is the complete server configuration
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	Store     StoreConfig     `json:"store"`
+	TLS       TLSConfig       `json:"tls"`
+	Features  FeatureConfig   `json:"features"`
+	Health    HealthConfig    `json:"health"`
+	Log       LogConfig       `json:"log"`
+	Tracing   TracingConfig   `json:"tracing"`
+	Auth      AuthConfig      `json:"auth"`
+	Approvals ApprovalConfig  `json:"approvals"`
+	Audit     AuditConfig     `json:"audit"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Risk      RiskConfig      `json:"risk"`
+	Screening ScreeningConfig `json:"screening"`
+	Escrow    EscrowConfig    `json:"escrow"`
+}
+
+// EscrowConfig controls escrowed payments
+type EscrowConfig struct {
+	// Account holds escrowed money and is created if missing; empty
+	// disables escrows
+	Account string `json:"account"`
+	// Timeout is how long a funded escrow may wait for confirmation or a
+	// dispute before it is refunded
+	Timeout Duration `json:"timeout"`
+}
+
+// RiskConfig controls risk scoring of transfers
+type RiskConfig struct {
+	Enabled bool `json:"enabled"`
+	// Transfers scoring at least ReviewScore need approval and those scoring
+	// at least BlockScore are refused; zero disables either decision
+	ReviewScore int `json:"review_score"`
+	BlockScore  int `json:"block_score"`
+	// NewCounterpartyAmount is the smallest first payment to a new
+	// recipient that is scored
+	NewCounterpartyAmount float64 `json:"new_counterparty_amount"`
+	// NewCounterpartyWindow is how long a recipient stays known after the
+	// sender last paid it
+	NewCounterpartyWindow Duration `json:"new_counterparty_window"`
+	// FanOutRecipients is how many distinct recipients a sender may pay
+	// within FanOutWindow
+	FanOutRecipients int      `json:"fan_out_recipients"`
+	FanOutWindow     Duration `json:"fan_out_window"`
+	// RoundTripWindow is how long after A pays B a payment back is scored
+	RoundTripWindow Duration `json:"round_trip_window"`
+	// Transfers between UnusualHourStart and UnusualHourEnd in Timezone
+	// are scored
+	UnusualHourStart int    `json:"unusual_hour_start"`
+	UnusualHourEnd   int    `json:"unusual_hour_end"`
+	Timezone         string `json:"timezone"`
+}
+
+// ScreeningConfig controls sanctions screening of account holders and
+// transfer parties
+type ScreeningConfig struct {
+	// WatchlistFile is a JSON array of listed parties; empty disables
+	// screening
+	WatchlistFile string `json:"watchlist_file"`
+	// Names at least ReviewThreshold similar to a listed name are queued for
+	// review and those at least BlockThreshold similar are refused
+	ReviewThreshold float64 `json:"review_threshold"`
+	BlockThreshold  float64 `json:"block_threshold"`
+}
+
+// RateLimitConfig sets per-caller token bucket budgets. Callers are keyed by
+// API key ID or JWT subject, or by client IP when unauthenticated. Client IPs
+// and source accounts have budgets of their own.
+type RateLimitConfig struct {
+	// ReadRate is the sustained GET requests per second; zero disables the
+	// read limit
+	ReadRate  float64 `json:"read_rate"`
+	ReadBurst int     `json:"read_burst"`
+	// TransferRate is the sustained transfers and other state-changing
+	// requests per second; zero disables the transfer limit
+	TransferRate  float64 `json:"transfer_rate"`
+	TransferBurst int     `json:"transfer_burst"`
+	// IPRate is the sustained requests per second from one client IP,
+	// checked before authentication; zero disables the IP limit
+	IPRate  float64 `json:"ip_rate"`
+	IPBurst int     `json:"ip_burst"`
+	// AccountRate is the sustained transfers per second out of one account,
+	// whoever sends them; zero disables the account limit
+	AccountRate  float64 `json:"account_rate"`
+	AccountBurst int     `json:"account_burst"`
+	// TrustForwardedFor keys unauthenticated callers by X-Forwarded-For
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+}
+
+// AuditConfig controls the hash-chained audit log
+type AuditConfig struct {
+	// File receives one record per state-changing action; empty disables
+	// the audit log
+	File string `json:"file"`
+}
+
+// ApprovalConfig controls maker-checker approval of large transfers
+type ApprovalConfig struct {
+	// Threshold is the amount above which transfers need approval; zero
+	// disables approvals
+	Threshold float64 `json:"threshold"`
+	// Deadline is how long a transfer may wait before it expires
+	Deadline Duration `json:"deadline"`
+}
+
+// AuthConfig controls API authentication
+type AuthConfig struct {
+	// KeysFile holds the hashed API keys; authentication is disabled when empty
+	KeysFile string `json:"keys_file"`
+	// RotationOverlap is how long a rotated-out key keeps working by default
+	RotationOverlap Duration `json:"rotation_overlap"`
+	// JWT verification keys; JWTs are accepted when any of them is set
+	JWTHMACKeyFile string `json:"jwt_hmac_key_file"`
+	JWTRSAKeyFile  string `json:"jwt_rsa_key_file"`
+	JWTJWKSFile    string `json:"jwt_jwks_file"`
+	JWTIssuer      string `json:"jwt_issuer"`
+	JWTAudience    string `json:"jwt_audience"`
+	// OwnersFile maps JWT subjects to the usernames they own
+	OwnersFile string `json:"owners_file"`
+	// PolicyFile overrides the permissions granted to roles and scopes
+	PolicyFile string `json:"policy_file"`
+}
+
+// JWTEnabled reports whether JWT bearer tokens are accepted
+func (c AuthConfig) JWTEnabled() bool {
+	return c.JWTHMACKeyFile != "" || c.JWTRSAKeyFile != "" || c.JWTJWKSFile != ""
+}
+
+// Tracing exporters
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+)
+
+// TracingConfig selects where finished spans are exported
+type TracingConfig struct {
+	Exporter string `json:"exporter"`
+	File     string `json:"file"`
+}
+
+// LogConfig controls structured logging
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `json:"level"`
+}
+
+// HealthConfig tunes the health endpoints
+type HealthConfig struct {
+	// LockThreshold is how long an account lock may be held before
+	// /healthz reports the server as wedged
+	LockThreshold Duration `json:"lock_threshold"`
+}
+
+// ServerConfig holds HTTP listener settings
+type ServerConfig struct {
+	Addr         string   `json:"addr"`
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+	IdleTimeout  Duration `json:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests may take to drain
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+}
+
+// StoreConfig selects and configures the account store
+type StoreConfig struct {
+	Backend  string `json:"backend"`
+	Shards   int    `json:"shards"`
+	SeedFile string `json:"seed_file"`
+	// Empty starts with no accounts, ignoring SeedFile
+	Empty bool `json:"empty"`
+}
+
+// TLSConfig enables HTTPS when both files are set
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// Enabled reports whether the server should serve TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// FeatureConfig holds feature toggles
+type FeatureConfig struct {
+	AccountCreation          bool     `json:"account_creation"`
+	HotConsolidationInterval Duration `json:"hot_consolidation_interval"`
+}
+
+// Default returns the configuration used when nothing else is specified
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8081",
+			ReadTimeout:     Duration(10 * time.Second),
+			WriteTimeout:    Duration(10 * time.Second),
+			IdleTimeout:     Duration(15 * time.Second),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Store: StoreConfig{
+			Backend:  BackendMemory,
+			Shards:   64,
+			SeedFile: "fixtures/demo.json",
+		},
+		Features: FeatureConfig{
+			AccountCreation:          false,
+			HotConsolidationInterval: Duration(time.Second),
+		},
+		Health: HealthConfig{
+			LockThreshold: Duration(5 * time.Second),
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Tracing: TracingConfig{
+			Exporter: TracingNone,
+		},
+		Auth: AuthConfig{
+			RotationOverlap: Duration(24 * time.Hour),
+		},
+		Approvals: ApprovalConfig{
+			Deadline: Duration(24 * time.Hour),
+		},
+		RateLimit: RateLimitConfig{
+			ReadBurst:     20,
+			TransferBurst: 5,
+			IPBurst:       50,
+			AccountBurst:  5,
+		},
+		Risk: RiskConfig{
+			ReviewScore:           50,
+			BlockScore:            80,
+			NewCounterpartyAmount: 1000,
+			NewCounterpartyWindow: Duration(90 * 24 * time.Hour),
+			FanOutRecipients:      5,
+			FanOutWindow:          Duration(time.Hour),
+			RoundTripWindow:       Duration(24 * time.Hour),
+			UnusualHourStart:      0,
+			UnusualHourEnd:        5,
+			Timezone:              "UTC",
+		},
+		Screening: ScreeningConfig{
+			ReviewThreshold: 0.85,
+			BlockThreshold:  1,
+		},
+		Escrow: EscrowConfig{
+			Timeout: Duration(7 * 24 * time.Hour),
+		},
+	}
+}
+
+// Duration is a time.Duration that reads and writes strings like "10s"
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid duration %s", data)
+		}
+		*d = Duration(n)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// setting binds one configuration value to its flag and environment variable
+type setting struct {
+	name   string
+	usage  string
+	set    func(c *Config, value string) error
+	isBool bool
+}
+
+// env returns the environment variable name for the setting
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(s.name))
+}
+
+func stringSetting(name, usage string, field func(c *Config) *string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(c *Config) *Duration) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, field func(c *Config) *int) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatSetting(name, usage string, field func(c *Config) *float64) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+func boolSetting(name, usage string, field func(c *Config) *bool) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}, isBool: true}
+}
+
+// settings lists every value that can be set from flags and the environment
+var settings = []setting{
+	stringSetting("addr", "listen address", func(c *Config) *string { return &c.Server.Addr }),
+	durationSetting("read-timeout", "HTTP read timeout", func(c *Config) *Duration { return &c.Server.ReadTimeout }),
+	durationSetting("write-timeout", "HTTP write timeout", func(c *Config) *Duration { return &c.Server.WriteTimeout }),
+	durationSetting("idle-timeout", "HTTP idle timeout", func(c *Config) *Duration { return &c.Server.IdleTimeout }),
+	durationSetting("shutdown-timeout", "maximum time to drain in-flight requests on shutdown", func(c *Config) *Duration { return &c.Server.ShutdownTimeout }),
+	stringSetting("store-backend", "account store backend (memory or sharded)", func(c *Config) *string { return &c.Store.Backend }),
+	intSetting("store-shards", "number of shards for the sharded store", func(c *Config) *int { return &c.Store.Shards }),
+	stringSetting("seed-file", "JSON or CSV fixture with accounts to load at startup", func(c *Config) *string { return &c.Store.SeedFile }),
+	boolSetting("store-empty", "start with no accounts instead of loading the seed file", func(c *Config) *bool { return &c.Store.Empty }),
+	stringSetting("tls-cert-file", "TLS certificate file", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key-file", "TLS private key file", func(c *Config) *string { return &c.TLS.KeyFile }),
+	boolSetting("feature-account-creation", "enable POST /accounts", func(c *Config) *bool { return &c.Features.AccountCreation }),
+	stringSetting("log-level", "log level (debug, info, warn or error)", func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("tracing-exporter", "span exporter (none, stdout or file)", func(c *Config) *string { return &c.Tracing.Exporter }),
+	stringSetting("tracing-file", "file that receives spans when the exporter is file", func(c *Config) *string { return &c.Tracing.File }),
+	stringSetting("auth-keys-file", "JSON file of hashed API keys (empty disables authentication)", func(c *Config) *string { return &c.Auth.KeysFile }),
+	durationSetting("auth-rotation-overlap", "how long a rotated API key keeps working by default", func(c *Config) *Duration { return &c.Auth.RotationOverlap }),
+	stringSetting("auth-jwt-hmac-key-file", "file holding the HS256 secret for JWTs", func(c *Config) *string { return &c.Auth.JWTHMACKeyFile }),
+	stringSetting("auth-jwt-rsa-key-file", "PEM RSA public key for RS256 JWTs", func(c *Config) *string { return &c.Auth.JWTRSAKeyFile }),
+	stringSetting("auth-jwt-jwks-file", "JWKS file with JWT verification keys", func(c *Config) *string { return &c.Auth.JWTJWKSFile }),
+	stringSetting("auth-jwt-issuer", "required JWT iss claim", func(c *Config) *string { return &c.Auth.JWTIssuer }),
+	stringSetting("auth-jwt-audience", "required JWT aud claim", func(c *Config) *string { return &c.Auth.JWTAudience }),
+	stringSetting("auth-owners-file", "JSON file mapping JWT subjects to owned usernames", func(c *Config) *string { return &c.Auth.OwnersFile }),
+	stringSetting("auth-policy-file", "JSON file mapping roles and scopes to permissions", func(c *Config) *string { return &c.Auth.PolicyFile }),
+	floatSetting("approval-threshold", "amount above which transfers need a second person's approval (0 disables)", func(c *Config) *float64 { return &c.Approvals.Threshold }),
+	durationSetting("approval-deadline", "how long a transfer may await approval before it expires", func(c *Config) *Duration { return &c.Approvals.Deadline }),
+	stringSetting("audit-file", "append-only audit log of state-changing actions (empty disables)", func(c *Config) *string { return &c.Audit.File }),
+	floatSetting("ratelimit-read-rate", "GET requests per second per caller (0 disables)", func(c *Config) *float64 { return &c.RateLimit.ReadRate }),
+	intSetting("ratelimit-read-burst", "GET requests a caller may burst above the read rate", func(c *Config) *int { return &c.RateLimit.ReadBurst }),
+	floatSetting("ratelimit-transfer-rate", "transfers and other changes per second per caller (0 disables)", func(c *Config) *float64 { return &c.RateLimit.TransferRate }),
+	intSetting("ratelimit-transfer-burst", "transfers and other changes a caller may burst above the transfer rate", func(c *Config) *int { return &c.RateLimit.TransferBurst }),
+	floatSetting("ratelimit-ip-rate", "requests per second per client IP, checked before authentication (0 disables)", func(c *Config) *float64 { return &c.RateLimit.IPRate }),
+	intSetting("ratelimit-ip-burst", "requests a client IP may burst above the IP rate", func(c *Config) *int { return &c.RateLimit.IPBurst }),
+	floatSetting("ratelimit-account-rate", "transfers per second out of one account (0 disables)", func(c *Config) *float64 { return &c.RateLimit.AccountRate }),
+	intSetting("ratelimit-account-burst", "transfers out of one account that may burst above the account rate", func(c *Config) *int { return &c.RateLimit.AccountBurst }),
+	boolSetting("ratelimit-trust-forwarded-for", "key unauthenticated callers by X-Forwarded-For (only behind a trusted proxy)", func(c *Config) *bool { return &c.RateLimit.TrustForwardedFor }),
+	boolSetting("risk-enabled", "score transfers for fraud risk before they execute", func(c *Config) *bool { return &c.Risk.Enabled }),
+	intSetting("risk-review-score", "risk score at which transfers need approval (0 disables)", func(c *Config) *int { return &c.Risk.ReviewScore }),
+	intSetting("risk-block-score", "risk score at which transfers are refused (0 disables)", func(c *Config) *int { return &c.Risk.BlockScore }),
+	floatSetting("risk-new-counterparty-amount", "smallest first payment to a new recipient that adds risk", func(c *Config) *float64 { return &c.Risk.NewCounterpartyAmount }),
+	durationSetting("risk-new-counterparty-window", "how long a recipient stays known after the last payment to it", func(c *Config) *Duration { return &c.Risk.NewCounterpartyWindow }),
+	intSetting("risk-fan-out-recipients", "distinct recipients a sender may pay within the fan-out window", func(c *Config) *int { return &c.Risk.FanOutRecipients }),
+	durationSetting("risk-fan-out-window", "window for counting a sender's recipients", func(c *Config) *Duration { return &c.Risk.FanOutWindow }),
+	durationSetting("risk-round-trip-window", "how long after A pays B a payment back adds risk", func(c *Config) *Duration { return &c.Risk.RoundTripWindow }),
+	intSetting("risk-unusual-hour-start", "hour at which the unusual-hours window starts", func(c *Config) *int { return &c.Risk.UnusualHourStart }),
+	intSetting("risk-unusual-hour-end", "hour at which the unusual-hours window ends", func(c *Config) *int { return &c.Risk.UnusualHourEnd }),
+	stringSetting("risk-timezone", "IANA time zone for the unusual-hours window", func(c *Config) *string { return &c.Risk.Timezone }),
+	stringSetting("screening-watchlist-file", "JSON sanctions watchlist to screen parties against (empty disables)", func(c *Config) *string { return &c.Screening.WatchlistFile }),
+	floatSetting("screening-review-threshold", "name similarity from 0 to 1 at which parties are queued for review", func(c *Config) *float64 { return &c.Screening.ReviewThreshold }),
+	floatSetting("screening-block-threshold", "name similarity from 0 to 1 at which parties are refused", func(c *Config) *float64 { return &c.Screening.BlockThreshold }),
+	stringSetting("escrow-account", "account that holds escrowed payments (empty disables escrows)", func(c *Config) *string { return &c.Escrow.Account }),
+	durationSetting("escrow-timeout", "how long a funded escrow may wait before it is refunded", func(c *Config) *Duration { return &c.Escrow.Timeout }),
+	durationSetting("health-lock-threshold", "how long an account lock may be held before /healthz fails", func(c *Config) *Duration { return &c.Health.LockThreshold }),
+	durationSetting("feature-hot-consolidation-interval", "interval for consolidating hot accounts (0 disables)", func(c *Config) *Duration { return &c.Features.HotConsolidationInterval }),
+}
+
+// flagValue is a flag value recorded during parsing and applied after the
+// config file and environment so flags take precedence
+type flagValue struct {
+	setting setting
+	value   string
+}
+
+// settingFlag adapts a setting to flag.Value
+type settingFlag struct {
+	setting setting
+	values  *[]flagValue
+}
+
+func (f *settingFlag) String() string { return "" }
+
+func (f *settingFlag) Set(v string) error {
+	*f.values = append(*f.values, flagValue{f.setting, v})
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be passed without a value
+func (f *settingFlag) IsBoolFlag() bool { return f.setting.isBool }
+
+// Options controls how Load reads its sources
+type Options struct {
+	// Args are the command-line arguments without the program name
+	Args []string
+	// LookupEnv reads environment variables; defaults to os.LookupEnv
+	LookupEnv func(string) (string, bool)
+	// Output receives flag usage and errors; defaults to os.Stderr
+	Output io.Writer
+}
+
+// Result is the outcome of Load
+type Result struct {
+	Config *Config
+	// PrintConfig is set when --print-config was passed
+	PrintConfig bool
+}
+
+// Load builds the configuration from all sources and validates it
+func Load(opts Options) (*Result, error) {
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+
+	fs := flag.NewFlagSet("money-transfer-system", flag.ContinueOnError)
+	fs.SetOutput(opts.Output)
+
+	configFile := fs.String("config", "", "JSON or YAML config file (env "+EnvPrefix+"CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration and exit")
+
+	var flagValues []flagValue
+	for _, s := range settings {
+		fs.Var(&settingFlag{setting: s, values: &flagValues}, s.name, s.usage+" (env "+s.env()+")")
+	}
+
+	if err := fs.Parse(opts.Args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	// Config file
+	path := *configFile
+	if path == "" {
+		path, _ = opts.LookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Environment variables
+	for _, s := range settings {
+		if v, ok := opts.LookupEnv(s.env()); ok {
+			if err := s.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env(), err)
+			}
+		}
+	}
+
+	// Flags
+	for _, fv := range flagValues {
+		if err := fv.setting.set(cfg, fv.value); err != nil {
+			return nil, fmt.Errorf("invalid -%s: %w", fv.setting.name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Result{Config: cfg, PrintConfig: *printConfig}, nil
+}
+
+// loadFile merges a JSON or YAML file into the configuration
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		values, err := parseYAML(data)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		// Round-trip through JSON so both formats share the same field names
+		if data, err = json.Marshal(values); err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case ".json":
+	default:
+		return fmt.Errorf("unsupported config file extension %q", ext)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+// Validate checks that the configuration is usable
+func (c *Config) Validate() error {
+	var errs ValidationError
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Sprintf("server.addr %q: %v", c.Server.Addr, err))
+	}
+
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"health.lock_threshold", c.Health.LockThreshold},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 {
+			errs = append(errs, t.name+" must be positive")
+		}
+	}
+
+	switch c.Store.Backend {
+	case BackendMemory:
+	case BackendSharded:
+		if c.Store.Shards <= 0 {
+			errs = append(errs, "store.shards must be positive")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("store.backend %q must be %q or %q", c.Store.Backend, BackendMemory, BackendSharded))
+	}
+
+	if !c.Store.Empty && c.Store.SeedFile == "" {
+		errs = append(errs, "store.seed_file is required unless store.empty is set")
+	}
+
+	if c.TLS.Enabled() {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			errs = append(errs, "tls.cert_file and tls.key_file must be set together")
+		}
+		for _, f := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+			if _, err := os.Stat(f); f != "" && err != nil {
+				errs = append(errs, fmt.Sprintf("tls file %v", err))
+			}
+		}
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Sprintf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingFile:
+		if c.Tracing.File == "" {
+			errs = append(errs, "tracing.file is required when tracing.exporter is file")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("tracing.exporter %q must be none, stdout or file", c.Tracing.Exporter))
+	}
+
+	if c.Auth.RotationOverlap < 0 {
+		errs = append(errs, "auth.rotation_overlap cannot be negative")
+	}
+	if c.Auth.OwnersFile != "" && !c.Auth.JWTEnabled() {
+		errs = append(errs, "auth.owners_file requires a JWT key file")
+	}
+
+	if c.Approvals.Threshold < 0 || math.IsNaN(c.Approvals.Threshold) {
+		errs = append(errs, "approvals.threshold cannot be negative")
+	}
+	if c.Approvals.Threshold > 0 && c.Approvals.Deadline <= 0 {
+		errs = append(errs, "approvals.deadline must be positive")
+	}
+
+	for _, limit := range []struct {
+		name  string
+		rate  float64
+		burst int
+	}{
+		{"read", c.RateLimit.ReadRate, c.RateLimit.ReadBurst},
+		{"transfer", c.RateLimit.TransferRate, c.RateLimit.TransferBurst},
+		{"ip", c.RateLimit.IPRate, c.RateLimit.IPBurst},
+		{"account", c.RateLimit.AccountRate, c.RateLimit.AccountBurst},
+	} {
+		if limit.rate < 0 || math.IsNaN(limit.rate) {
+			errs = append(errs, fmt.Sprintf("rate_limit.%s_rate cannot be negative", limit.name))
+		}
+		if limit.rate > 0 && limit.burst < 1 {
+			errs = append(errs, fmt.Sprintf("rate_limit.%s_burst must be at least 1", limit.name))
+		}
+	}
+
+	if c.Risk.Enabled {
+		if c.Risk.ReviewScore < 0 || c.Risk.BlockScore < 0 {
+			errs = append(errs, "risk.review_score and risk.block_score cannot be negative")
+		}
+		if c.Risk.ReviewScore > 0 && c.Risk.BlockScore > 0 && c.Risk.BlockScore <= c.Risk.ReviewScore {
+			errs = append(errs, "risk.block_score must be above risk.review_score")
+		}
+		if c.Risk.FanOutRecipients < 1 || c.Risk.FanOutWindow <= 0 {
+			errs = append(errs, "risk.fan_out_recipients and risk.fan_out_window must be positive")
+		}
+		if c.Risk.RoundTripWindow <= 0 {
+			errs = append(errs, "risk.round_trip_window must be positive")
+		}
+		if c.Risk.NewCounterpartyWindow <= 0 {
+			errs = append(errs, "risk.new_counterparty_window must be positive")
+		}
+		if c.Risk.UnusualHourStart < 0 || c.Risk.UnusualHourStart > 23 || c.Risk.UnusualHourEnd < 0 || c.Risk.UnusualHourEnd > 24 {
+			errs = append(errs, "risk.unusual_hour_start must be 0-23 and risk.unusual_hour_end 0-24")
+		}
+		if _, err := time.LoadLocation(c.Risk.Timezone); err != nil {
+			errs = append(errs, fmt.Sprintf("risk.timezone: %v", err))
+		}
+	}
+
+	if c.Screening.WatchlistFile != "" {
+		review, block := c.Screening.ReviewThreshold, c.Screening.BlockThreshold
+		if !(review > 0 && review <= block && block <= 1) {
+			errs = append(errs, "screening.review_threshold and screening.block_threshold must satisfy 0 < review <= block <= 1")
+		}
+	}
+
+	if c.Escrow.Account != "" && c.Escrow.Timeout <= 0 {
+		errs = append(errs, "escrow.timeout must be positive")
+	}
+
+	if c.Features.HotConsolidationInterval < 0 {
+		errs = append(errs, "features.hot_consolidation_interval cannot be negative")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Print writes the configuration as indented JSON
+func (c *Config) Print(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
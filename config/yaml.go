@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non-blank, non-comment line of a YAML document
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// parseYAML parses the subset of YAML used by config files: nested
+// mappings, block lists of scalars, comments and quoted or plain scalars.
+// Anchors, flow collections and multi-line strings are not supported.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := stripComment(strings.TrimRight(raw, " \t\r"))
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	value, rest, err := parseYAMLBlock(lines, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].number)
+	}
+
+	mapping, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("line %d: top level must be a mapping", lines[0].number)
+	}
+	return mapping, nil
+}
+
+// parseYAMLBlock parses consecutive lines at the given indentation as a
+// mapping or list and returns the lines that follow the block
+func parseYAMLBlock(lines []yamlLine, indent int) (interface{}, []yamlLine, error) {
+	if strings.HasPrefix(lines[0].text, "- ") || lines[0].text == "-" {
+		var list []interface{}
+		for len(lines) > 0 && lines[0].indent == indent {
+			if !strings.HasPrefix(lines[0].text, "-") {
+				return nil, nil, fmt.Errorf("line %d: expected list item", lines[0].number)
+			}
+			list = append(list, parseYAMLScalar(strings.TrimSpace(strings.TrimPrefix(lines[0].text, "-"))))
+			lines = lines[1:]
+		}
+		return list, lines, nil
+	}
+
+	mapping := make(map[string]interface{})
+	for len(lines) > 0 && lines[0].indent == indent {
+		line := lines[0]
+		colon := strings.Index(line.text, ":")
+		if colon <= 0 {
+			return nil, nil, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+
+		key := strings.TrimSpace(line.text[:colon])
+		value := strings.TrimSpace(line.text[colon+1:])
+		if _, exists := mapping[key]; exists {
+			return nil, nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+		lines = lines[1:]
+
+		if value != "" {
+			mapping[key] = parseYAMLScalar(value)
+			continue
+		}
+
+		// A key without a value introduces a nested block
+		if len(lines) == 0 || lines[0].indent <= indent {
+			mapping[key] = nil
+			continue
+		}
+
+		nested, rest, err := parseYAMLBlock(lines, lines[0].indent)
+		if err != nil {
+			return nil, nil, err
+		}
+		mapping[key] = nested
+		lines = rest
+	}
+
+	if len(lines) > 0 && lines[0].indent > indent {
+		return nil, nil, fmt.Errorf("line %d: unexpected indentation", lines[0].number)
+	}
+
+	return mapping, lines, nil
+}
+
+// parseYAMLScalar converts a scalar to a bool, number, null or string
+func parseYAMLScalar(s string) interface{} {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if unquoted, err := strconv.Unquote(s); err == nil {
+				return unquoted
+			}
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+
+	switch s {
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case "null", "~":
+		return nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// stripComment removes a trailing comment that is not inside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -1,5 +1,5 @@
 module money-transfer-system
 
-go 1.19
+go 1.21
 
-require github.com/gorilla/mux v1.8.1 // indirect
+require github.com/gorilla/mux v1.8.1
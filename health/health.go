@@ -0,0 +1,114 @@
+// Package health provides dependency checks for the liveness and readiness
+// endpoints.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"money-transfer-system/service"
+)
+
+// DefaultCheckTimeout bounds how long a single check may run
+const DefaultCheckTimeout = 2 * time.Second
+
+// Check is a named dependency check
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Report is the JSON body returned by the health endpoints
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Evaluate runs the checks and reports whether all of them passed
+func Evaluate(ctx context.Context, checks []Check) (Report, bool) {
+	report := Report{Status: "ok", Checks: make(map[string]string, len(checks))}
+	healthy := true
+
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, DefaultCheckTimeout)
+		err := runCheck(checkCtx, check)
+		cancel()
+
+		if err != nil {
+			healthy = false
+			report.Checks[check.Name] = err.Error()
+		} else {
+			report.Checks[check.Name] = "ok"
+		}
+	}
+
+	if !healthy {
+		report.Status = "unavailable"
+	}
+	return report, healthy
+}
+
+// runCheck runs a check and gives up when the context expires, so a wedged
+// dependency is reported instead of hanging the endpoint
+func runCheck(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() { done <- check.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
+
+// StoreCheck verifies the account store answers lookups. A lookup of an
+// account that does not exist must fail with ErrAccountNotFound.
+func StoreCheck(accountManager service.AccountManager) Check {
+	return Check{Name: "store", Run: func(ctx context.Context) error {
+		_, err := accountManager.GetAccount("\x00healthcheck")
+		if err != nil && !errors.Is(err, service.ErrAccountNotFound) {
+			return err
+		}
+		return nil
+	}}
+}
+
+// LockCheck fails when any account mutex has been held longer than the
+// threshold, which indicates a stuck or deadlocked lock holder. It reads each
+// account's lock time without taking the lock.
+func LockCheck(accountManager service.AccountManager, threshold time.Duration) Check {
+	return Check{Name: "locks", Run: func(ctx context.Context) error {
+		var stuck []string
+		for _, account := range accountManager.ListAccounts() {
+			if held := account.LockHeldFor(); held > threshold {
+				stuck = append(stuck, fmt.Sprintf("%s (%v)", account.Username, held.Round(time.Millisecond)))
+			}
+		}
+
+		if len(stuck) > 0 {
+			sort.Strings(stuck)
+			return fmt.Errorf("account locks held longer than %v: %s", threshold, strings.Join(stuck, ", "))
+		}
+		return nil
+	}}
+}
+
+// WritableCheck verifies that files can be created in the directory holding
+// path, for example a journal or audit log
+func WritableCheck(name, path string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		f, err := os.CreateTemp(filepath.Dir(path), ".healthcheck-*")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}}
+}
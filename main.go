@@ -1,37 +1,383 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"money-transfer-system/api"
+	"money-transfer-system/audit"
+	"money-transfer-system/auth"
+	"money-transfer-system/config"
+	"money-transfer-system/health"
+	"money-transfer-system/metrics"
+	"money-transfer-system/ratelimit"
+	"money-transfer-system/risk"
+	"money-transfer-system/screening"
 	"money-transfer-system/service"
 	"money-transfer-system/store"
+	"money-transfer-system/tracing"
 )
 
+// newTracer creates the tracer selected by the configuration, or nil if
+// tracing is disabled
+func newTracer(cfg config.TracingConfig) (*tracing.Tracer, error) {
+	switch cfg.Exporter {
+	case config.TracingStdout:
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	case config.TracingFile:
+		exporter, err := tracing.NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.NewTracer(exporter), nil
+	}
+	return nil, nil
+}
+
+// newJWTVerifier loads the configured JWT verification keys and subject to
+// account mapping
+func newJWTVerifier(cfg config.AuthConfig) (*auth.JWTVerifier, error) {
+	verifier := auth.NewJWTVerifier(cfg.JWTIssuer, cfg.JWTAudience)
+	if cfg.JWTHMACKeyFile != "" {
+		if err := verifier.LoadHMACKeyFile(cfg.JWTHMACKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWTRSAKeyFile != "" {
+		if err := verifier.LoadRSAKeyFile(cfg.JWTRSAKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWTJWKSFile != "" {
+		if err := verifier.LoadJWKSFile(cfg.JWTJWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.OwnersFile != "" {
+		owners, err := auth.LoadOwnersFile(cfg.OwnersFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.SetOwners(owners)
+	}
+	return verifier, nil
+}
+
+// newRiskEngine creates a risk engine with the built-in rules
+func newRiskEngine(cfg config.RiskConfig) (*risk.Engine, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []risk.Rule{
+		risk.NewCounterpartyRule{MinAmount: cfg.NewCounterpartyAmount, Window: time.Duration(cfg.NewCounterpartyWindow), Score: risk.NewCounterpartyScore},
+		risk.FanOutRule{Window: time.Duration(cfg.FanOutWindow), MaxRecipients: cfg.FanOutRecipients, Score: risk.FanOutScore},
+		risk.RoundTripRule{Window: time.Duration(cfg.RoundTripWindow), Score: risk.RoundTripScore},
+		risk.UnusualHourRule{StartHour: cfg.UnusualHourStart, EndHour: cfg.UnusualHourEnd, Location: location, Score: risk.UnusualHourScore},
+	}
+	retention := max(time.Duration(cfg.FanOutWindow), time.Duration(cfg.RoundTripWindow))
+	return risk.NewEngine(cfg.ReviewScore, cfg.BlockScore, rules, risk.WithRetention(retention),
+		risk.WithCounterpartyRetention(time.Duration(cfg.NewCounterpartyWindow))), nil
+}
+
+// newStore creates the account store selected by the configuration
+func newStore(cfg config.StoreConfig) service.AccountManager {
+	if cfg.Backend == config.BackendSharded {
+		return store.NewShardedStore(cfg.Shards)
+	}
+	return store.NewInMemoryStore()
+}
+
+// seedStore loads the accounts from the configured fixture file
+func seedStore(accountManager service.AccountManager, cfg config.StoreConfig) error {
+	if cfg.Empty {
+		return nil
+	}
+
+	fixtures, err := store.LoadFixtureFile(cfg.SeedFile)
+	if err != nil {
+		return err
+	}
+
+	return store.Seed(accountManager, fixtures)
+}
+
+// ensureEscrowAccount creates the system account that holds escrowed money
+// unless the fixture already has it
+func ensureEscrowAccount(accountStore service.AccountManager, username string) error {
+	if _, err := accountStore.GetAccount(username); err == nil {
+		return nil
+	}
+
+	account, err := accountStore.CreateAccount(username, 0)
+	if err != nil {
+		return err
+	}
+	account.SetProfile(service.Profile{DisplayName: "Escrow", Type: service.TypeSystem})
+	return nil
+}
+
 func main() {
-	// Create the account store and initialize with default accounts
-	accountStore := store.NewInMemoryStore()
-	accountStore.Setup()
+	// Load configuration from defaults, config file, environment and flags
+	result, err := config.Load(config.Options{Args: os.Args[1:]})
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := result.Config
+
+	if result.PrintConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+
+	// Write structured JSON logs; the standard logger is routed through it too
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Log.Level))
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+
+	// Create the account store; fixture accounts are loaded once screening
+	// is set up
+	accountStore := newStore(cfg.Store)
+
+	if interval := time.Duration(cfg.Features.HotConsolidationInterval); interval > 0 {
+		stop := service.StartConsolidator(accountStore, interval)
+		defer stop()
+	}
+
+	// Open the audit log, refusing to start if its chain is broken
+	var auditLog *audit.Log
+	if cfg.Audit.File != "" {
+		if auditLog, err = audit.Open(cfg.Audit.File); err != nil {
+			log.Fatal(err)
+		}
+		auditLog.Audit(context.Background(), "config.loaded", map[string]interface{}{"config": cfg})
+	}
+
+	// Screen new account holders and transfer parties against the watchlist
+	accountManager := accountStore
+	var screener *screening.Screener
+	if cfg.Screening.WatchlistFile != "" {
+		watchlist, err := screening.LoadWatchlistFile(cfg.Screening.WatchlistFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		screeningOptions := []screening.Option{screening.WithThresholds(cfg.Screening.ReviewThreshold, cfg.Screening.BlockThreshold)}
+		if auditLog != nil {
+			screeningOptions = append(screeningOptions, screening.WithAuditor(auditLog))
+		}
+		screener = screening.NewScreener(watchlist, accountStore, screeningOptions...)
+		accountManager = screening.NewAccountManager(accountManager, screener)
+	}
+
+	// Load the fixture accounts through screening, so seeded holders are
+	// checked like new ones
+	if err := seedStore(accountManager, cfg.Store); err != nil {
+		log.Fatal(err)
+	}
+	if auditLog != nil {
+		accountManager = audit.NewAccountManager(accountManager, auditLog)
+	}
+
+	// Create tracer
+	tracer, err := newTracer(cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Load the role policy, then API keys and JWT verification keys; without
+	// either kind of key every route is open
+	policy := auth.DefaultPolicy()
+	if cfg.Auth.PolicyFile != "" {
+		if policy, err = auth.LoadPolicyFile(cfg.Auth.PolicyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	apiOptions := []api.Option{api.WithKeyRotationOverlap(time.Duration(cfg.Auth.RotationOverlap)), api.WithPolicy(policy)}
+	if cfg.Auth.KeysFile != "" {
+		keyStore, err := auth.OpenKeyStore(cfg.Auth.KeysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := keyStore.CheckRoles(policy); err != nil {
+			log.Fatalf("%s: %v", cfg.Auth.KeysFile, err)
+		}
+		apiOptions = append(apiOptions, api.WithKeyStore(keyStore))
+	}
+	if cfg.Auth.JWTEnabled() {
+		verifier, err := newJWTVerifier(cfg.Auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiOptions = append(apiOptions, api.WithJWTVerifier(verifier))
+	}
+	if cfg.Auth.KeysFile == "" && !cfg.Auth.JWTEnabled() {
+		logger.Warn("authentication disabled: set auth.keys_file or a JWT key file to require credentials")
+		if cfg.Features.AccountCreation {
+			logger.Warn("account creation disabled: it requires authentication")
+		}
+	}
+
+	// Limit each caller's reads and transfers separately
+	var readLimiter, transferLimiter *ratelimit.Limiter
+	if cfg.RateLimit.ReadRate > 0 {
+		readLimiter = ratelimit.NewLimiter(cfg.RateLimit.ReadRate, cfg.RateLimit.ReadBurst)
+	}
+	if cfg.RateLimit.TransferRate > 0 {
+		transferLimiter = ratelimit.NewLimiter(cfg.RateLimit.TransferRate, cfg.RateLimit.TransferBurst)
+	}
+	apiOptions = append(apiOptions,
+		api.WithRateLimits(readLimiter, transferLimiter),
+		api.WithTrustForwardedFor(cfg.RateLimit.TrustForwardedFor))
+
+	// Limit client IPs before authentication and transfers out of each
+	// account whoever sends them
+	if cfg.RateLimit.IPRate > 0 {
+		apiOptions = append(apiOptions, api.WithIPRateLimit(ratelimit.NewLimiter(cfg.RateLimit.IPRate, cfg.RateLimit.IPBurst)))
+	}
+	if cfg.RateLimit.AccountRate > 0 {
+		apiOptions = append(apiOptions, api.WithAccountRateLimit(ratelimit.NewLimiter(cfg.RateLimit.AccountRate, cfg.RateLimit.AccountBurst)))
+	}
+
+	// Create metrics
+	registry := metrics.NewRegistry()
+	metrics.RegisterAccountGauges(registry, accountStore)
 
 	// Create services
-	transferService := service.NewTransferService(accountStore)
+	serviceOptions := []service.Option{
+		service.WithObserver(metrics.NewTransferMetrics(registry)),
+		service.WithLogger(logger),
+		service.WithTracer(tracer),
+	}
+	if cfg.Approvals.Threshold > 0 {
+		serviceOptions = append(serviceOptions, service.WithApprovals(cfg.Approvals.Threshold, time.Duration(cfg.Approvals.Deadline)))
+	}
+	if cfg.Risk.Enabled {
+		engine, err := newRiskEngine(cfg.Risk)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serviceOptions = append(serviceOptions, service.WithRiskEngine(engine))
+		if cfg.Approvals.Threshold == 0 {
+			logger.Warn("approvals disabled: transfers the risk engine sends to review are blocked")
+		}
+	}
+	if auditLog != nil {
+		serviceOptions = append(serviceOptions, service.WithAuditor(auditLog))
+		apiOptions = append(apiOptions,
+			api.WithAuditor(auditLog),
+			api.WithReadinessChecks(
+				health.WritableCheck("audit_log", cfg.Audit.File),
+				health.Check{Name: "audit_writes", Run: func(context.Context) error { return auditLog.Err() }},
+			))
+	}
+	if screener != nil {
+		serviceOptions = append(serviceOptions, service.WithScreener(screener))
+		apiOptions = append(apiOptions, api.WithScreener(screener))
+	}
+	if cfg.Approvals.Threshold == 0 {
+		for _, account := range accountStore.ListAccounts() {
+			if account.SigningPolicy() != nil {
+				logger.Warn("approvals disabled: transfers from joint accounts that need several signatures are refused")
+				break
+			}
+		}
+	}
+	if cfg.Escrow.Account != "" {
+		if err := ensureEscrowAccount(accountStore, cfg.Escrow.Account); err != nil {
+			log.Fatalf("Failed to create escrow account: %v", err)
+		}
+		serviceOptions = append(serviceOptions, service.WithEscrow(cfg.Escrow.Account, time.Duration(cfg.Escrow.Timeout)))
+	}
+	transferService := service.NewTransferService(accountStore, serviceOptions...)
+
+	// Release the funds of approvals that pass their deadline
+	if transferService.ApprovalsEnabled() {
+		stop := transferService.StartApprovalExpirer(min(time.Minute, time.Duration(cfg.Approvals.Deadline)))
+		defer stop()
+	}
+
+	// Refund escrows that pass their deadline
+	if transferService.EscrowsEnabled() {
+		stop := transferService.StartEscrowExpirer(min(time.Minute, time.Duration(cfg.Escrow.Timeout)))
+		defer stop()
+	}
 
 	// Create API and set up routes
-	apiHandler := api.NewAPI(transferService, accountStore)
+	apiHandler := api.NewAPI(transferService, accountManager, append(apiOptions,
+		api.WithAccountCreation(cfg.Features.AccountCreation),
+		api.WithLivenessChecks(health.LockCheck(accountStore, time.Duration(cfg.Health.LockThreshold))),
+		api.WithReadinessChecks(health.StoreCheck(accountStore)),
+		api.WithMetrics(registry),
+		api.WithLogger(logger),
+		api.WithTracer(tracer))...)
 	router := apiHandler.SetupRoutes()
 
 	// Create HTTP server
 	server := &http.Server{
-		Addr:         ":8081",
+		Addr:         cfg.Server.Addr,
 		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
 	}
 
 	// Start the server
-	log.Println("Money Transfer System starting on port 8081...")
-	log.Fatal(server.ListenAndServe())
-} 
\ No newline at end of file
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Money Transfer System starting on %s...", cfg.Server.Addr)
+		if cfg.TLS.Enabled() {
+			serverErr <- server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	// Wait for a shutdown signal or a server failure
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-signals.Done():
+	}
+
+	log.Println("Shutdown requested, draining in-flight transfers...")
+	err = shutdown(server, apiHandler, transferService, time.Duration(cfg.Server.ShutdownTimeout))
+	if auditLog != nil {
+		err = errors.Join(err, auditLog.Close())
+	}
+	if err := errors.Join(err, tracer.Close()); err != nil {
+		log.Fatalf("Shutdown incomplete: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+// shutdown reports not ready, stops accepting new transfers and waits for
+// in-flight requests within the timeout
+func shutdown(server *http.Server, apiHandler *api.API, transferService *service.TransferService, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	apiHandler.SetReady(false)
+
+	var errs []error
+	if err := transferService.Drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
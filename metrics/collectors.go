@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"money-transfer-system/service"
+)
+
+// TransferMetrics records transfer outcomes, latency and lock contention.
+// It implements service.TransferObserver.
+type TransferMetrics struct {
+	transfers *CounterVec
+	duration  *HistogramVec
+	lockWait  *HistogramVec
+}
+
+// NewTransferMetrics registers the transfer metric families
+func NewTransferMetrics(r *Registry) *TransferMetrics {
+	return &TransferMetrics{
+		transfers: r.NewCounterVec("mts_transfers_total", "Transfers processed, by outcome.", "outcome"),
+		duration:  r.NewHistogramVec("mts_transfer_duration_seconds", "Time to process a transfer, by outcome.", nil, "outcome"),
+		lockWait:  r.NewHistogramVec("mts_account_lock_wait_seconds", "Time spent waiting for an account lock, by account tier.", nil, "tier"),
+	}
+}
+
+// TransferCompleted records the outcome and duration of a transfer
+func (m *TransferMetrics) TransferCompleted(outcome string, duration time.Duration) {
+	m.transfers.Inc(outcome)
+	m.duration.Observe(duration.Seconds(), outcome)
+}
+
+// LockAcquired records how long a transfer waited for an account lock
+func (m *TransferMetrics) LockAcquired(tier string, wait time.Duration) {
+	m.lockWait.Observe(wait.Seconds(), tier)
+}
+
+// Transfers returns the number of transfers recorded with the outcome
+func (m *TransferMetrics) Transfers(outcome string) float64 {
+	return m.transfers.Value(outcome)
+}
+
+// HTTPMetrics records request counts and latency per route
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// NewHTTPMetrics registers the HTTP metric families
+func NewHTTPMetrics(r *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: r.NewCounterVec("mts_http_requests_total", "HTTP requests, by method, route template and status code.", "method", "route", "code"),
+		duration: r.NewHistogramVec("mts_http_request_duration_seconds", "HTTP request latency, by method and route template.", nil, "method", "route"),
+	}
+}
+
+// Observe records one completed request
+func (m *HTTPMetrics) Observe(method, route string, code int, duration time.Duration) {
+	m.requests.Inc(method, route, strconv.Itoa(code))
+	m.duration.Observe(duration.Seconds(), method, route)
+}
+
+// RegisterAccountGauges exposes the number of accounts and the total balance
+// held across them, computed at scrape time
+func RegisterAccountGauges(r *Registry, accountManager service.AccountManager) {
+	r.NewGaugeFunc("mts_accounts", "Number of accounts.", func() float64 {
+		return float64(len(accountManager.ListAccounts()))
+	})
+
+	r.NewGaugeFunc("mts_balance_total", "Sum of all account balances.", func() float64 {
+		var total float64
+		for _, account := range accountManager.ListAccounts() {
+			total += account.GetBalance()
+		}
+		return total
+	})
+}
@@ -0,0 +1,137 @@
+// Package ratelimit provides per-key token bucket rate limiting.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket size, the most requests allowed in a burst
+	Limit int
+	// Remaining is the number of whole tokens left after this request
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed, zero
+	// if it would be allowed now
+	RetryAfter time.Duration
+}
+
+// bucket holds the tokens left for one key as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one token bucket per key. Each bucket holds up to burst
+// tokens and refills at rate tokens per second.
+type Limiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// Option configures optional Limiter behaviour
+type Option func(*Limiter)
+
+// WithClock replaces the clock, for tests
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+// NewLimiter allows rate requests per second per key with bursts of up to
+// burst requests
+func NewLimiter(rate float64, burst int, opts ...Option) *Limiter {
+	l := &Limiter{
+		rate:    rate,
+		burst:   burst,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	l.lastSweep = l.now()
+	return l
+}
+
+// Allow takes a token from the key's bucket if one is available
+func (l *Limiter) Allow(key string) Decision {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	decision := Decision{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = l.duration(1 - b.tokens)
+	}
+	decision.Remaining = int(math.Floor(b.tokens))
+	decision.Reset = l.duration(float64(l.burst) - b.tokens)
+	return decision
+}
+
+// refill returns the bucket's tokens at now
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(l.burst), b.tokens+elapsed*l.rate)
+}
+
+// duration returns how long it takes to refill the given number of tokens
+func (l *Limiter) duration(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket
+// starts full anyway. It runs at most once per full refill period.
+func (l *Limiter) sweep(now time.Time) {
+	period := l.duration(float64(l.burst))
+	if now.Sub(l.lastSweep) < period {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of keys currently tracked
+func (l *Limiter) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return len(l.buckets)
+}
@@ -0,0 +1,325 @@
+// Package risk scores transfers with pluggable rules. Each matching rule adds
+// to the transfer's score, and the total decides whether the transfer is
+// allowed, sent to review or blocked.
+package risk
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"money-transfer-system/service"
+)
+
+// Transfer is a transfer being scored or recorded in the history
+type Transfer struct {
+	From   string
+	To     string
+	Amount float64
+	At     time.Time
+
+	// reserved is set while the transfer is being scored or executed and
+	// has not been recorded as completed
+	reserved bool
+}
+
+// Rule scores one risk signal
+type Rule interface {
+	// Name identifies the rule in assessments
+	Name() string
+
+	// Evaluate returns the score and reason if the rule matches the transfer.
+	// The history already holds the transfer as a reservation.
+	Evaluate(history *History, transfer Transfer) (score int, reason string, ok bool)
+}
+
+// Engine scores transfers against its rules and keeps the history they use.
+// It implements service.RiskEngine.
+type Engine struct {
+	rules       []Rule
+	reviewScore int
+	blockScore  int
+	history     *History
+	now         func() time.Time
+}
+
+// Option configures optional Engine behaviour
+type Option func(*Engine)
+
+// WithClock replaces the clock, for tests
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+// WithRetention sets how long completed transfers are kept for rules that
+// look back in time. It should cover the longest rule window.
+func WithRetention(retention time.Duration) Option {
+	return func(e *Engine) {
+		e.history.retention = retention
+	}
+}
+
+// WithCounterpartyRetention sets how long a recipient is remembered after
+// the sender last paid it. It should cover the new counterparty window.
+func WithCounterpartyRetention(retention time.Duration) Option {
+	return func(e *Engine) {
+		e.history.counterpartyRetention = retention
+	}
+}
+
+// NewEngine creates an engine that sends transfers scoring at least
+// reviewScore to review and blocks those scoring at least blockScore. A zero
+// score disables that decision.
+func NewEngine(reviewScore, blockScore int, rules []Rule, opts ...Option) *Engine {
+	e := &Engine{
+		rules:       rules,
+		reviewScore: reviewScore,
+		blockScore:  blockScore,
+		history:     newHistory(24 * time.Hour),
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.history.now = e.now
+
+	return e
+}
+
+// Assess scores the transfer against every rule. The transfer is reserved in
+// the history first, so that concurrent transfers from the same sender or
+// back to it see each other; blocked transfers give up their reservation.
+func (e *Engine) Assess(ctx context.Context, req service.TransferRequest) service.RiskAssessment {
+	transfer := Transfer{From: req.From, To: req.To, Amount: req.Amount, At: e.now()}
+	assessment := service.RiskAssessment{Decision: service.RiskAllow}
+	e.history.reserve(transfer)
+
+	for _, rule := range e.rules {
+		if score, reason, ok := rule.Evaluate(e.history, transfer); ok {
+			assessment.Score += score
+			assessment.Rules = append(assessment.Rules, service.RuleHit{Rule: rule.Name(), Score: score, Reason: reason})
+		}
+	}
+
+	switch {
+	case e.blockScore > 0 && assessment.Score >= e.blockScore:
+		assessment.Decision = service.RiskBlock
+		e.history.release(transfer)
+	case e.reviewScore > 0 && assessment.Score >= e.reviewScore:
+		assessment.Decision = service.RiskReview
+	}
+	return assessment
+}
+
+// Record adds a completed transfer to the history in place of its
+// reservation
+func (e *Engine) Record(ctx context.Context, req service.TransferRequest) {
+	e.history.add(Transfer{From: req.From, To: req.To, Amount: req.Amount, At: e.now()})
+}
+
+// Counterparties returns how many sender and recipient pairs the history
+// remembers
+func (e *Engine) Counterparties() int {
+	n := 0
+	for _, sh := range e.history.shards {
+		sh.mutex.Lock()
+		for _, paid := range sh.counterparties {
+			n += len(paid)
+		}
+		sh.mutex.Unlock()
+	}
+	return n
+}
+
+// sweepInterval is how often the history drops entries past retention
+const sweepInterval = time.Minute
+
+// reservationTimeout is how long a reservation counts for other transfers if
+// its transfer is not recorded, for example because it failed or is held
+// for approval
+const reservationTimeout = time.Minute
+
+// historyShards is the number of independently locked history partitions
+const historyShards = 64
+
+// History holds the completed transfers rules look back on, and the
+// reservations of those being scored or executed. Each sender's entries live
+// in one of its shards, so transfers from different senders rarely contend.
+// It is safe for concurrent use.
+type History struct {
+	retention             time.Duration
+	counterpartyRetention time.Duration
+	now                   func() time.Time
+	shards                [historyShards]*historyShard
+
+	// lastSweep is when the shards were last swept, in Unix nanoseconds
+	lastSweep atomic.Int64
+}
+
+// historyShard holds the entries of the senders that hash to it
+type historyShard struct {
+	mutex sync.Mutex
+
+	// sent holds each account's recent outgoing transfers, oldest first
+	sent map[string][]Transfer
+	// counterparties records when each account last paid each recipient
+	counterparties map[string]map[string]time.Time
+}
+
+// newHistory keeps recent transfers for the retention period and
+// counterparties for 90 days
+func newHistory(retention time.Duration) *History {
+	h := &History{
+		retention:             retention,
+		counterpartyRetention: 90 * 24 * time.Hour,
+		now:                   time.Now,
+	}
+	for i := range h.shards {
+		h.shards[i] = &historyShard{
+			sent:           make(map[string][]Transfer),
+			counterparties: make(map[string]map[string]time.Time),
+		}
+	}
+	return h
+}
+
+// shardFor returns the shard holding the sender's entries, hashing the
+// username with FNV-1a
+func (h *History) shardFor(from string) *historyShard {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	hash := uint32(offset32)
+	for i := 0; i < len(from); i++ {
+		hash ^= uint32(from[i])
+		hash *= prime32
+	}
+	return h.shards[hash%historyShards]
+}
+
+// reserve adds a transfer being scored to the sender's transfers
+func (h *History) reserve(transfer Transfer) {
+	sh := h.shardFor(transfer.From)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	transfer.reserved = true
+	sh.sent[transfer.From] = append(h.prune(sh.sent[transfer.From], transfer.At), transfer)
+}
+
+// release drops a transfer's reservation
+func (h *History) release(transfer Transfer) {
+	sh := h.shardFor(transfer.From)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	sh.sent[transfer.From] = unreserve(sh.sent[transfer.From], transfer)
+}
+
+// add records a completed transfer in place of its reservation and drops
+// the sender's entries past retention
+func (h *History) add(transfer Transfer) {
+	sh := h.shardFor(transfer.From)
+	sh.mutex.Lock()
+	sent := unreserve(sh.sent[transfer.From], transfer)
+	sh.sent[transfer.From] = append(h.prune(sent, transfer.At), transfer)
+
+	if sh.counterparties[transfer.From] == nil {
+		sh.counterparties[transfer.From] = make(map[string]time.Time)
+	}
+	sh.counterparties[transfer.From][transfer.To] = transfer.At
+	sh.mutex.Unlock()
+
+	h.sweep(transfer.At)
+}
+
+// unreserve removes the oldest reservation matching the transfer
+func unreserve(sent []Transfer, transfer Transfer) []Transfer {
+	for i, t := range sent {
+		if t.reserved && t.To == transfer.To && t.Amount == transfer.Amount {
+			return append(sent[:i], sent[i+1:]...)
+		}
+	}
+	return sent
+}
+
+// prune drops transfers past retention and lapsed reservations
+func (h *History) prune(sent []Transfer, now time.Time) []Transfer {
+	cutoff := now.Add(-h.retention)
+	lapsed := now.Add(-reservationTimeout)
+	kept := sent[:0]
+	for _, t := range sent {
+		if !t.At.Before(cutoff) && !(t.reserved && t.At.Before(lapsed)) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// sweep drops senders with no transfers left within retention and
+// counterparties not paid within the counterparty retention. It runs at most
+// once per sweepInterval, locking one shard at a time.
+func (h *History) sweep(now time.Time) {
+	last := h.lastSweep.Load()
+	if now.Sub(time.Unix(0, last)) < sweepInterval || !h.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	for _, sh := range h.shards {
+		sh.mutex.Lock()
+		cutoff := now.Add(-h.retention)
+		for from, sent := range sh.sent {
+			if len(sent) == 0 || sent[len(sent)-1].At.Before(cutoff) {
+				delete(sh.sent, from)
+			}
+		}
+
+		cutoff = now.Add(-h.counterpartyRetention)
+		for from, paid := range sh.counterparties {
+			for to, at := range paid {
+				if at.Before(cutoff) {
+					delete(paid, to)
+				}
+			}
+			if len(paid) == 0 {
+				delete(sh.counterparties, from)
+			}
+		}
+		sh.mutex.Unlock()
+	}
+}
+
+// HasPaidSince reports whether from has completed a transfer to to at or
+// after since, within the counterparty retention
+func (h *History) HasPaidSince(from, to string, since time.Time) bool {
+	sh := h.shardFor(from)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	at, ok := sh.counterparties[from][to]
+	return ok && !at.Before(since)
+}
+
+// SentSince returns from's transfers completed or reserved at or after
+// since, within the retention period. Reservations that have lapsed are
+// left out.
+func (h *History) SentSince(from string, since time.Time) []Transfer {
+	sh := h.shardFor(from)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	lapsed := h.now().Add(-reservationTimeout)
+	var transfers []Transfer
+	for _, transfer := range sh.sent[from] {
+		if !transfer.At.Before(since) && !(transfer.reserved && transfer.At.Before(lapsed)) {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
@@ -0,0 +1,115 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default rule scores, chosen so that a round trip or a fan-out alone goes to
+// review and several signals together block
+const (
+	NewCounterpartyScore = 40
+	FanOutScore          = 50
+	RoundTripScore       = 60
+	UnusualHourScore     = 20
+)
+
+// NewCounterpartyRule matches large transfers to an account the sender has
+// not paid within Window. A zero Window looks back over the whole history.
+type NewCounterpartyRule struct {
+	MinAmount float64
+	Window    time.Duration
+	Score     int
+}
+
+// Name returns "new_counterparty"
+func (r NewCounterpartyRule) Name() string { return "new_counterparty" }
+
+// Evaluate matches a transfer of at least MinAmount to a recipient the
+// sender has not paid within Window
+func (r NewCounterpartyRule) Evaluate(history *History, transfer Transfer) (int, string, bool) {
+	var since time.Time
+	if r.Window > 0 {
+		since = transfer.At.Add(-r.Window)
+	}
+	if transfer.Amount < r.MinAmount || history.HasPaidSince(transfer.From, transfer.To, since) {
+		return 0, "", false
+	}
+	return r.Score, fmt.Sprintf("first payment to %s is %.2f, at least %.2f", transfer.To, transfer.Amount, r.MinAmount), true
+}
+
+// FanOutRule matches senders paying more than MaxRecipients distinct
+// accounts within Window, counting the transfer being scored
+type FanOutRule struct {
+	Window        time.Duration
+	MaxRecipients int
+	Score         int
+}
+
+// Name returns "fan_out"
+func (r FanOutRule) Name() string { return "fan_out" }
+
+// Evaluate matches a transfer that takes the sender past MaxRecipients
+// distinct recipients within Window
+func (r FanOutRule) Evaluate(history *History, transfer Transfer) (int, string, bool) {
+	recipients := map[string]bool{transfer.To: true}
+	for _, sent := range history.SentSince(transfer.From, transfer.At.Add(-r.Window)) {
+		recipients[sent.To] = true
+	}
+	if len(recipients) <= r.MaxRecipients {
+		return 0, "", false
+	}
+	return r.Score, fmt.Sprintf("%d recipients within %v, more than %d", len(recipients), r.Window, r.MaxRecipients), true
+}
+
+// RoundTripRule matches money sent back to an account that paid the sender
+// within Window, as in A→B followed by B→A
+type RoundTripRule struct {
+	Window time.Duration
+	Score  int
+}
+
+// Name returns "round_trip"
+func (r RoundTripRule) Name() string { return "round_trip" }
+
+// Evaluate matches a transfer to an account that paid the sender within
+// Window
+func (r RoundTripRule) Evaluate(history *History, transfer Transfer) (int, string, bool) {
+	for _, sent := range history.SentSince(transfer.To, transfer.At.Add(-r.Window)) {
+		if sent.To == transfer.From {
+			return r.Score, fmt.Sprintf("%s paid %s %.2f at %s", transfer.To, transfer.From, sent.Amount, sent.At.UTC().Format(time.RFC3339)), true
+		}
+	}
+	return 0, "", false
+}
+
+// UnusualHourRule matches transfers made between StartHour and EndHour in
+// Location, wrapping past midnight if StartHour is after EndHour
+type UnusualHourRule struct {
+	StartHour int
+	EndHour   int
+	// Location defaults to UTC
+	Location *time.Location
+	Score    int
+}
+
+// Name returns "unusual_hour"
+func (r UnusualHourRule) Name() string { return "unusual_hour" }
+
+// Evaluate matches a transfer made within the unusual hours
+func (r UnusualHourRule) Evaluate(history *History, transfer Transfer) (int, string, bool) {
+	location := r.Location
+	if location == nil {
+		location = time.UTC
+	}
+	hour := transfer.At.In(location).Hour()
+
+	inWindow := hour >= r.StartHour && hour < r.EndHour
+	if r.StartHour > r.EndHour {
+		inWindow = hour >= r.StartHour || hour < r.EndHour
+	}
+	if !inWindow {
+		return 0, "", false
+	}
+	return r.Score, fmt.Sprintf("made at %02d:00 %s, between %02d:00 and %02d:00", hour, location, r.StartHour, r.EndHour), true
+}
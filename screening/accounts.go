@@ -0,0 +1,127 @@
+package screening
+
+import (
+	"context"
+	"errors"
+
+	"money-transfer-system/service"
+)
+
+// AccountManager screens account holders before their accounts are created
+type AccountManager struct {
+	service.AccountManager
+	screener *Screener
+}
+
+// NewAccountManager wraps accountManager so that listed parties cannot open
+// accounts and potential matches open frozen accounts until reviewed
+func NewAccountManager(accountManager service.AccountManager, screener *Screener) *AccountManager {
+	return &AccountManager{AccountManager: accountManager, screener: screener}
+}
+
+// CreateAccount screens and creates an account
+func (m *AccountManager) CreateAccount(username string, initialBalance float64) (*service.Account, error) {
+	return m.CreateAccountContext(context.Background(), username, initialBalance)
+}
+
+// CreateAccountContext screens and creates an account on behalf of the actor
+// in ctx. It returns ErrSanctioned for listed parties. Potential matches get
+// a frozen account and a pending hit, and no error.
+func (m *AccountManager) CreateAccountContext(ctx context.Context, username string, initialBalance float64) (*service.Account, error) {
+	return m.create(ctx, username, initialBalance, nil)
+}
+
+// CreateAccountWithProfile screens the username and the holder's display
+// name, then creates an account with the profile like CreateAccountContext
+func (m *AccountManager) CreateAccountWithProfile(ctx context.Context, username string, initialBalance float64, profile service.Profile) (*service.Account, error) {
+	return m.create(ctx, username, initialBalance, &profile)
+}
+
+// UpdateProfile screens a changed display name before replacing the
+// holder's profile. It returns ErrSanctioned for listed parties, and freezes
+// the account for potential matches.
+func (m *AccountManager) UpdateProfile(ctx context.Context, account *service.Account, profile service.Profile) error {
+	var pending []Hit
+	if profile.DisplayName != account.GetProfile().DisplayName {
+		var err error
+		if pending, err = m.screenHolder(ctx, "", profile); err != nil {
+			return err
+		}
+	}
+
+	if err := service.UpdateProfile(ctx, m.AccountManager, account, profile); err != nil {
+		return err
+	}
+	m.freeze(account, pending)
+	return nil
+}
+
+// create screens the holder and creates the account, with the profile if it
+// is given
+func (m *AccountManager) create(ctx context.Context, username string, initialBalance float64, profile *service.Profile) (*service.Account, error) {
+	// Do not queue hits for accounts that cannot be created anyway
+	if _, err := m.AccountManager.GetAccount(username); err == nil {
+		return nil, service.ErrAccountExists
+	}
+
+	var holder service.Profile
+	if profile != nil {
+		holder = *profile
+	}
+	pending, err := m.screenHolder(ctx, username, holder)
+	if err != nil {
+		return nil, err
+	}
+
+	var account *service.Account
+	if profile != nil {
+		account, err = service.CreateAccountWithProfile(ctx, m.AccountManager, username, initialBalance, *profile)
+	} else {
+		account, err = createAccount(ctx, m.AccountManager, username, initialBalance)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.freeze(account, pending)
+	return account, nil
+}
+
+// screenHolder screens the username, if given, and the display name. It
+// returns the pending hits for potential matches, or ErrSanctioned if either
+// is listed.
+func (m *AccountManager) screenHolder(ctx context.Context, username string, profile service.Profile) ([]Hit, error) {
+	var pending []Hit
+	for _, party := range []string{username, profile.DisplayName} {
+		if party == "" || (party == profile.DisplayName && party == username) {
+			continue
+		}
+		hit, err := m.screener.ScreenAccount(ctx, party)
+		switch {
+		case errors.Is(err, service.ErrScreeningPending):
+			pending = append(pending, hit)
+		case err != nil:
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// freeze freezes an active account until its pending hits are reviewed
+func (m *AccountManager) freeze(account *service.Account, pending []Hit) {
+	if len(pending) == 0 || account.Status() != service.StatusActive {
+		return
+	}
+	account.SetStatus(service.StatusFrozen)
+	for _, hit := range pending {
+		m.screener.markFrozen(hit.ID, account.Username)
+	}
+}
+
+// createAccount creates the account through CreateAccountContext if the
+// manager supports it, so wrapped managers still see the actor
+func createAccount(ctx context.Context, accountManager service.AccountManager, username string, initialBalance float64) (*service.Account, error) {
+	if creator, ok := accountManager.(service.ContextAccountCreator); ok {
+		return creator.CreateAccountContext(ctx, username, initialBalance)
+	}
+	return accountManager.CreateAccount(username, initialBalance)
+}
@@ -0,0 +1,413 @@
+package screening
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"money-transfer-system/service"
+)
+
+// Review errors
+var (
+	ErrHitNotFound = errors.New("screening hit not found")
+	ErrHitClosed   = errors.New("screening hit is no longer pending")
+)
+
+// HitStatus is the review state of a screening hit
+type HitStatus string
+
+// Hit statuses
+const (
+	HitPending HitStatus = "pending"
+	// HitCleared means a reviewer found the party is not the listed one
+	HitCleared HitStatus = "cleared"
+	// HitConfirmed means the party is listed, either because a reviewer
+	// confirmed a potential match or because the match was exact
+	HitConfirmed HitStatus = "confirmed"
+)
+
+// Hit sources
+const (
+	SourceAccountCreation = "account_creation"
+	SourceTransfer        = "transfer"
+)
+
+// Hit is a party that matched the watchlist
+type Hit struct {
+	ID     string    `json:"id"`
+	Party  string    `json:"party"`
+	Source string    `json:"source"`
+	Match  Match     `json:"match"`
+	Status HitStatus `json:"status"`
+	// Frozen is set when the party's account was frozen because of the hit
+	Frozen bool `json:"frozen,omitempty"`
+	// Account is the username of the account the hit is about, when the
+	// party is the holder's display name rather than the username
+	Account   string     `json:"account,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// DefaultCacheSize is how many parties that did not match a Screener
+// remembers by default
+const DefaultCacheSize = 100000
+
+// Screener screens parties against a watchlist and queues potential
+// matches for review. It implements service.Screener.
+//
+// Parties that matched are remembered with their hit, so later checks reuse
+// the review decision and a cleared party is not flagged again. A bounded
+// number of parties that did not match are remembered too. Matching runs
+// outside the mutex, once per party however many callers check it at once.
+type Screener struct {
+	watchlist       *Watchlist
+	accounts        service.AccountManager
+	reviewThreshold float64
+	blockThreshold  float64
+	auditor         service.Auditor
+	cacheSize       int
+
+	mutex sync.Mutex
+	// parties maps each party that matched to its hit
+	parties map[string]*Hit
+	// clean and previousClean hold parties that did not match. When clean
+	// is full it replaces previousClean, so at most twice the cache size
+	// are kept and recently checked parties stay.
+	clean, previousClean map[string]struct{}
+	// matching holds the parties being matched, with a channel closed once
+	// the match is recorded
+	matching map[string]chan struct{}
+	hits     map[string]*Hit
+	order    []string
+}
+
+// Option configures optional Screener behaviour
+type Option func(*Screener)
+
+// WithThresholds sets the similarity at which a party is queued for review
+// and at which it is blocked outright. The defaults are 0.85 and 1, an exact
+// match after normalization.
+func WithThresholds(review, block float64) Option {
+	return func(s *Screener) {
+		s.reviewThreshold = review
+		s.blockThreshold = block
+	}
+}
+
+// WithCacheSize sets how many parties that did not match are remembered
+// before the oldest are screened again. The default is DefaultCacheSize.
+func WithCacheSize(size int) Option {
+	return func(s *Screener) {
+		s.cacheSize = size
+	}
+}
+
+// WithAuditor records hits and review decisions
+func WithAuditor(auditor service.Auditor) Option {
+	return func(s *Screener) {
+		s.auditor = auditor
+	}
+}
+
+// NewScreener screens against the watchlist. Accounts are frozen and
+// unfrozen in accounts as hits are confirmed and cleared.
+func NewScreener(watchlist *Watchlist, accounts service.AccountManager, opts ...Option) *Screener {
+	s := &Screener{
+		watchlist:       watchlist,
+		accounts:        accounts,
+		reviewThreshold: 0.85,
+		blockThreshold:  1,
+		cacheSize:       DefaultCacheSize,
+		parties:         make(map[string]*Hit),
+		clean:           make(map[string]struct{}),
+		matching:        make(map[string]chan struct{}),
+		hits:            make(map[string]*Hit),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Screen checks a transfer party
+func (s *Screener) Screen(ctx context.Context, party string) error {
+	_, err := s.screen(ctx, party, SourceTransfer)
+	return err
+}
+
+// ScreenAccount checks the holder of a new account. For a potential match it
+// returns the pending hit with ErrScreeningPending.
+func (s *Screener) ScreenAccount(ctx context.Context, username string) (Hit, error) {
+	return s.screen(ctx, username, SourceAccountCreation)
+}
+
+// screen returns the party's hit, screening it first if it is new, and the
+// error its status implies
+func (s *Screener) screen(ctx context.Context, party, source string) (Hit, error) {
+	hit, screened := s.cached(party)
+	if !screened {
+		hit = s.match(party, source)
+	}
+
+	if hit == nil {
+		return Hit{}, nil
+	}
+	snapshot := *hit
+	if !screened {
+		s.audit(ctx, "screening.hit", snapshot)
+	}
+
+	switch snapshot.Status {
+	case HitConfirmed:
+		return snapshot, fmt.Errorf("%w: %s (hit %s)", service.ErrSanctioned, party, snapshot.ID)
+	case HitPending:
+		return snapshot, fmt.Errorf("%w: %s (hit %s)", service.ErrScreeningPending, party, snapshot.ID)
+	}
+	return snapshot, nil
+}
+
+// cached returns a copy of the party's hit, or nil if it did not match, and
+// whether it has been screened. If it has not, the caller must match it;
+// other callers wait for that match instead of repeating it.
+func (s *Screener) cached(party string) (*Hit, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		if hit, ok := s.parties[party]; ok {
+			snapshot := *hit
+			return &snapshot, true
+		}
+		if s.isClean(party) {
+			return nil, true
+		}
+		done, ok := s.matching[party]
+		if !ok {
+			s.matching[party] = make(chan struct{})
+			return nil, false
+		}
+
+		s.mutex.Unlock()
+		<-done
+		s.mutex.Lock()
+	}
+}
+
+// isClean reports whether the party was screened recently and did not
+// match. The caller must hold the mutex.
+func (s *Screener) isClean(party string) bool {
+	if _, ok := s.clean[party]; ok {
+		return true
+	}
+	if _, ok := s.previousClean[party]; ok {
+		s.markClean(party)
+		return true
+	}
+	return false
+}
+
+// markClean remembers that the party did not match, starting a new
+// generation if the current one is full. The caller must hold the mutex.
+func (s *Screener) markClean(party string) {
+	if len(s.clean) >= s.cacheSize {
+		s.previousClean, s.clean = s.clean, make(map[string]struct{})
+	}
+	s.clean[party] = struct{}{}
+}
+
+// match compares a party with the watchlist without holding the mutex, then
+// records a hit if it is similar enough and releases the callers waiting for
+// the party. It returns a copy of the hit, or nil if there is none.
+func (s *Screener) match(party, source string) *Hit {
+	match, ok := s.watchlist.Best(party)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	close(s.matching[party])
+	delete(s.matching, party)
+	if !ok || match.Score < s.reviewThreshold {
+		s.markClean(party)
+		return nil
+	}
+
+	hit := &Hit{
+		ID:        newHitID(),
+		Party:     party,
+		Source:    source,
+		Match:     match,
+		Status:    HitPending,
+		CreatedAt: time.Now(),
+	}
+	if match.Score >= s.blockThreshold {
+		hit.Status = HitConfirmed
+	}
+
+	s.hits[hit.ID] = hit
+	s.order = append(s.order, hit.ID)
+	s.parties[party] = hit
+	snapshot := *hit
+	return &snapshot
+}
+
+// Cached returns how many screened parties the screener remembers
+func (s *Screener) Cached() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.parties) + len(s.clean) + len(s.previousClean)
+}
+
+// newHitID returns a random hit ID
+func newHitID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "scr_" + hex.EncodeToString(b[:])
+}
+
+// markFrozen records that the account was frozen because of the hit
+func (s *Screener) markFrozen(id, username string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if hit, ok := s.hits[id]; ok {
+		hit.Frozen = true
+		if hit.Party != username {
+			hit.Account = username
+		}
+	}
+}
+
+// heldFrozen reports whether another pending hit still keeps the account
+// frozen
+func (s *Screener) heldFrozen(username, except string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, hit := range s.hits {
+		if hit.ID != except && hit.Frozen && hit.Status == HitPending && hit.account() == username {
+			return true
+		}
+	}
+	return false
+}
+
+// account returns the username of the account the hit is about
+func (h Hit) account() string {
+	if h.Account != "" {
+		return h.Account
+	}
+	return h.Party
+}
+
+// Hit returns the hit with the given ID
+func (s *Screener) Hit(id string) (Hit, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hit, ok := s.hits[id]
+	if !ok {
+		return Hit{}, ErrHitNotFound
+	}
+	return *hit, nil
+}
+
+// Hits returns hits in the order they were found, only those with the status
+// unless it is empty
+func (s *Screener) Hits(status HitStatus) []Hit {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hits := []Hit{}
+	for _, id := range s.order {
+		if hit := s.hits[id]; status == "" || hit.Status == status {
+			hits = append(hits, *hit)
+		}
+	}
+	return hits
+}
+
+// Clear records that a pending hit is not the listed party, on behalf of the
+// actor in ctx, and unfreezes the account if the hit froze it
+func (s *Screener) Clear(ctx context.Context, id, reason string) (Hit, error) {
+	hit, err := s.decide(ctx, id, HitCleared, reason)
+	if err != nil {
+		return hit, err
+	}
+
+	if hit.Frozen && !s.heldFrozen(hit.account(), hit.ID) {
+		if account, err := s.accounts.GetAccount(hit.account()); err == nil && account.Status() == service.StatusFrozen {
+			account.SetStatus(service.StatusActive)
+		}
+	}
+	return hit, nil
+}
+
+// Confirm records that a pending hit is the listed party, on behalf of the
+// actor in ctx, and freezes the party's account
+func (s *Screener) Confirm(ctx context.Context, id, reason string) (Hit, error) {
+	hit, err := s.decide(ctx, id, HitConfirmed, reason)
+	if err != nil {
+		return hit, err
+	}
+
+	if account, err := s.accounts.GetAccount(hit.account()); err == nil && account.Status() == service.StatusActive {
+		account.SetStatus(service.StatusFrozen)
+	}
+	return hit, nil
+}
+
+// decide moves a pending hit to the status. A reason is required.
+func (s *Screener) decide(ctx context.Context, id string, status HitStatus, reason string) (Hit, error) {
+	if reason == "" {
+		return Hit{}, service.ErrReasonRequired
+	}
+
+	s.mutex.Lock()
+	hit, ok := s.hits[id]
+	if !ok {
+		s.mutex.Unlock()
+		return Hit{}, ErrHitNotFound
+	}
+	if hit.Status != HitPending {
+		snapshot := *hit
+		s.mutex.Unlock()
+		return snapshot, ErrHitClosed
+	}
+
+	now := time.Now()
+	hit.Status = status
+	hit.DecidedBy = service.ActorFromContext(ctx)
+	hit.DecidedAt = &now
+	hit.Reason = reason
+	snapshot := *hit
+	s.mutex.Unlock()
+
+	s.audit(ctx, "screening."+string(status), snapshot)
+	return snapshot, nil
+}
+
+// audit records a hit event if an auditor is configured
+func (s *Screener) audit(ctx context.Context, action string, hit Hit) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Audit(ctx, action, map[string]interface{}{
+		"hit_id":   hit.ID,
+		"party":    hit.Party,
+		"source":   hit.Source,
+		"entry_id": hit.Match.Entry.ID,
+		"score":    hit.Match.Score,
+		"status":   hit.Status,
+		"reason":   hit.Reason,
+	})
+}
@@ -0,0 +1,195 @@
+// Package screening checks account holders and transfer parties against a
+// local sanctions watchlist. Names are normalized and compared fuzzily;
+// potential matches are queued for a person to clear or confirm.
+package screening
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Entry is a listed party
+type Entry struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Program is the sanctions program that lists the party
+	Program string `json:"program,omitempty"`
+}
+
+// Match is the closest watchlist entry to a name
+type Match struct {
+	Entry Entry `json:"entry"`
+	// Name is the entry name or alias that matched
+	Name string `json:"name"`
+	// Score is the similarity from 0 to 1, where 1 is an exact match after
+	// normalization
+	Score float64 `json:"score"`
+}
+
+// candidate is a normalized entry name or alias
+type candidate struct {
+	entry int
+	name  string
+	forms []string
+}
+
+// Watchlist holds listed parties with their names pre-normalized
+type Watchlist struct {
+	entries    []Entry
+	candidates []candidate
+}
+
+// NewWatchlist indexes the entries
+func NewWatchlist(entries []Entry) *Watchlist {
+	w := &Watchlist{entries: entries}
+	for i, entry := range entries {
+		for _, name := range append([]string{entry.Name}, entry.Aliases...) {
+			if forms := normalizedForms(name); len(forms) > 0 {
+				w.candidates = append(w.candidates, candidate{entry: i, name: name, forms: forms})
+			}
+		}
+	}
+	return w
+}
+
+// LoadWatchlistFile reads a JSON array of entries
+func LoadWatchlistFile(path string) (*Watchlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, entry := range entries {
+		if entry.ID == "" || strings.TrimSpace(entry.Name) == "" {
+			return nil, fmt.Errorf("%s: entry %d needs an id and a name", path, i)
+		}
+	}
+	return NewWatchlist(entries), nil
+}
+
+// Len returns the number of listed parties
+func (w *Watchlist) Len() int {
+	return len(w.entries)
+}
+
+// Best returns the entry most similar to name, and false if the list is
+// empty or name has no letters or digits
+func (w *Watchlist) Best(name string) (Match, bool) {
+	forms := normalizedForms(name)
+	if len(forms) == 0 {
+		return Match{}, false
+	}
+
+	var best Match
+	found := false
+	for _, c := range w.candidates {
+		score := 0.0
+		for _, a := range forms {
+			for _, b := range c.forms {
+				score = max(score, similarity(a, b))
+			}
+		}
+		if !found || score > best.Score {
+			best = Match{Entry: w.entries[c.entry], Name: c.name, Score: score}
+			found = true
+		}
+	}
+	return best, found
+}
+
+// foldings spells accented Latin letters without their accents
+var foldings = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// Normalize lowercases a name, removes accents, turns punctuation into
+// spaces and sorts the words, so "Petrov, Iván" and "ivan.petrov" are equal
+func Normalize(name string) string {
+	sorted := words(name)
+	sort.Strings(sorted)
+	return strings.Join(sorted, " ")
+}
+
+// words returns the lowercase, unaccented words of a name in order
+func words(name string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case foldings[r] != "":
+			b.WriteString(foldings[r])
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// normalizedForms returns the forms a name is compared in: its sorted words
+// and, for names of several words, the words run together in their original
+// and sorted order, so "ivanpetrov" and "petrovivan" match "Ivan Petrov"
+func normalizedForms(name string) []string {
+	original := words(name)
+	if len(original) == 0 {
+		return nil
+	}
+
+	sorted := append([]string(nil), original...)
+	sort.Strings(sorted)
+	forms := []string{strings.Join(sorted, " ")}
+	if len(original) > 1 {
+		forms = append(forms, strings.Join(original, ""), strings.Join(sorted, ""))
+	}
+	return forms
+}
+
+// similarity returns 1 minus the Levenshtein distance divided by the length
+// of the longer string
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the number of single-rune edits that turn a into b
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
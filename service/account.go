@@ -1,8 +1,16 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Common errors
@@ -11,20 +19,210 @@ var (
 	ErrAccountNotFound   = errors.New("account not found")
 	ErrInvalidAmount     = errors.New("invalid amount, must be positive")
 	ErrSameAccount       = errors.New("cannot transfer to the same account")
+	ErrAccountExists     = errors.New("account already exists")
+	ErrAccountFrozen     = errors.New("account is frozen")
+	ErrAccountClosed     = errors.New("account is closed")
+	ErrCurrencyMismatch  = errors.New("accounts use different currencies")
+	ErrLimitExceeded     = errors.New("transfer exceeds account limit")
 )
 
+// MaxUsernameLength is the longest username ValidUsername accepts
+const MaxUsernameLength = 64
+
+// ValidUsername reports whether a username is 1 to MaxUsernameLength
+// letters, digits, dots, underscores or hyphens, starting with a letter or
+// digit. Usernames cannot start with AccountIDPrefix, so they are never
+// mistaken for IDs.
+func ValidUsername(username string) bool {
+	return validName(username) && !IsAccountID(username)
+}
+
+// ValidAccountRef reports whether ref is a valid username or has the form of
+// an account ID
+func ValidAccountRef(ref string) bool {
+	return validName(ref)
+}
+
+// validName reports whether name is 1 to MaxUsernameLength letters, digits,
+// dots, underscores or hyphens, starting with a letter or digit
+func validName(name string) bool {
+	if name == "" || len(name) > MaxUsernameLength {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case i > 0 && (c == '.' || c == '_' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AccountStatus is the lifecycle state of an account
+type AccountStatus string
+
+// Account statuses
+const (
+	StatusActive AccountStatus = "active"
+	StatusFrozen AccountStatus = "frozen"
+	StatusClosed AccountStatus = "closed"
+)
+
+// Valid reports whether the status is one of the known statuses
+func (s AccountStatus) Valid() bool {
+	return s == StatusActive || s == StatusFrozen || s == StatusClosed
+}
+
+// AccountType classifies the holder of an account
+type AccountType string
+
+// Account types
+const (
+	TypePersonal AccountType = "personal"
+	TypeBusiness AccountType = "business"
+	// TypeSystem accounts are operated by the platform itself
+	TypeSystem AccountType = "system"
+)
+
+// Valid reports whether the type is one of the known types
+func (t AccountType) Valid() bool {
+	return t == TypePersonal || t == TypeBusiness || t == TypeSystem
+}
+
+// Contact holds the account holder's contact details
+type Contact struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// Profile describes the holder of an account
+type Profile struct {
+	DisplayName string      `json:"display_name,omitempty"`
+	Type        AccountType `json:"type"`
+	Contact     Contact     `json:"contact"`
+}
+
+// Profile field bounds
+const (
+	MaxDisplayNameLength = 128
+	MaxEmailLength       = 254
+)
+
+// ValidDisplayName reports whether name is valid UTF-8 of at most
+// MaxDisplayNameLength printable runes
+func ValidDisplayName(name string) bool {
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidEmail reports whether s has the form local@domain with no spaces
+func ValidEmail(s string) bool {
+	local, domain, ok := strings.Cut(s, "@")
+	return ok && local != "" && strings.Contains(domain, ".") && len(s) <= MaxEmailLength &&
+		!strings.ContainsAny(s, " \t\r\n") && !strings.Contains(domain, "@")
+}
+
+// ValidPhone reports whether s is a + followed by 7 to 15 digits
+func ValidPhone(s string) bool {
+	digits, ok := strings.CutPrefix(s, "+")
+	if !ok || len(digits) < 7 || len(digits) > 15 {
+		return false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccountIDPrefix starts every account ID, so IDs can be told apart from
+// usernames in URLs
+const AccountIDPrefix = "acc_"
+
+// newAccountID returns a random account ID
+func newAccountID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return AccountIDPrefix + hex.EncodeToString(b[:])
+}
+
+// IsAccountID reports whether ref has the form of an account ID
+func IsAccountID(ref string) bool {
+	return strings.HasPrefix(ref, AccountIDPrefix)
+}
+
+// LookupAccount finds an account by ID or username. References that look
+// like IDs are tried as IDs first, so a username of that form still resolves
+// if no account has the ID.
+func LookupAccount(accountManager AccountManager, ref string) (*Account, error) {
+	if IsAccountID(ref) {
+		if account, err := accountManager.GetAccountByID(ref); err == nil {
+			return account, nil
+		}
+	}
+	return accountManager.GetAccount(ref)
+}
+
+// Limits restricts how an account may be debited. Zero means unlimited.
+type Limits struct {
+	MaxTransfer float64 `json:"max_transfer,omitempty"`
+}
+
 // Account represents a user account with balance
 type Account struct {
-	Username string  `json:"username"`
-	Balance  float64 `json:"balance"`
-	mutex    sync.Mutex
+	// ID is assigned at creation and never changes; Username is the alias
+	// used in transfers
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	Balance   float64   `json:"balance"`
+	// Currency is an ISO 4217 code; empty accounts accept any currency
+	Currency string `json:"currency,omitempty"`
+	// Limits, Profile and Signing are read and updated under the account lock
+	Limits  Limits  `json:"limits"`
+	Profile Profile `json:"profile"`
+	// Signing is set for joint accounts
+	Signing *SigningPolicy `json:"signing,omitempty"`
+	mutex   sync.Mutex
+
+	// held is the part of Balance reserved for transfers awaiting approval,
+	// read and updated under the account lock
+	held float64
+
+	// pockets earmark parts of Balance, read and updated under the account
+	// lock
+	pockets []*Pocket
+
+	// status is kept outside the mutex so it can be checked on hot accounts
+	status atomic.Value
+
+	// lockedAt is the time the mutex was acquired in Unix nanoseconds, or zero
+	lockedAt atomic.Int64
+
+	// hot is set for accounts whose credits are spread across sub-balances
+	hot atomic.Pointer[hotCredits]
 }
 
-// NewAccount creates a new account with the given username and initial balance
+// NewAccount creates a new personal account with the given username and
+// initial balance, and a new ID
 func NewAccount(username string, initialBalance float64) *Account {
 	return &Account{
-		Username: username,
-		Balance:  initialBalance,
+		ID:        newAccountID(),
+		Username:  username,
+		CreatedAt: time.Now().UTC(),
+		Balance:   initialBalance,
+		Profile:   Profile{Type: TypePersonal},
 	}
 }
 
@@ -35,8 +233,14 @@ func (a *Account) Deposit(amount float64) error {
 		return ErrInvalidAmount
 	}
 
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+	// Hot accounts take credits without touching the account mutex
+	if a.IsHot() {
+		a.credit(amount)
+		return nil
+	}
+
+	a.Lock()
+	defer a.Unlock()
 
 	a.Balance += amount
 	return nil
@@ -49,10 +253,11 @@ func (a *Account) Withdraw(amount float64) error {
 		return ErrInvalidAmount
 	}
 
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+	a.Lock()
+	defer a.Unlock()
 
-	if a.Balance < amount {
+	a.consolidateLocked()
+	if a.availableLocked() < amount {
 		return ErrInsufficientFunds
 	}
 
@@ -60,20 +265,155 @@ func (a *Account) Withdraw(amount float64) error {
 	return nil
 }
 
-// GetBalance returns the current balance of the account
+// Held returns the amount reserved for transfers awaiting approval
+func (a *Account) Held() float64 {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.held
+}
+
+// availableLocked returns the balance that is neither held nor in pockets.
+// The caller must hold the account lock.
+func (a *Account) availableLocked() float64 {
+	return a.Balance - a.held - a.earmarkedLocked()
+}
+
+// releaseHold returns held funds to the pocket they were taken from, or to
+// the available balance
+func (a *Account) releaseHold(amount float64, pocket string) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.unholdLocked(amount, pocket)
+}
+
+// GetBalance returns the current balance of the account, including any
+// credits not yet consolidated from hot sub-balances
 func (a *Account) GetBalance() float64 {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-	
-	return a.Balance
+	a.Lock()
+	defer a.Unlock()
+
+	return a.Balance + a.pendingCredits()
+}
+
+// Status returns the lifecycle state of the account
+func (a *Account) Status() AccountStatus {
+	if status, ok := a.status.Load().(AccountStatus); ok {
+		return status
+	}
+	return StatusActive
+}
+
+// SetStatus changes the lifecycle state of the account. It waits for any
+// transfer holding the account lock, so no transfer completes after it returns.
+func (a *Account) SetStatus(status AccountStatus) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.status.Store(status)
+}
+
+// SetLimits replaces the account limits
+func (a *Account) SetLimits(limits Limits) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.Limits = limits
+}
+
+// GetProfile returns the account holder's profile
+func (a *Account) GetProfile() Profile {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.Profile
+}
+
+// SetProfile replaces the account holder's profile
+func (a *Account) SetProfile(profile Profile) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.Profile = profile
+}
+
+// checkActive returns an error if the account cannot take part in transfers
+func (a *Account) checkActive() error {
+	switch a.Status() {
+	case StatusFrozen:
+		return ErrAccountFrozen
+	case StatusClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// sameCurrency reports whether money can move between the accounts. An
+// account without a currency accepts any.
+func sameCurrency(a, b *Account) bool {
+	return a.Currency == "" || b.Currency == "" || a.Currency == b.Currency
+}
+
+// MarshalJSON reports the aggregate balance so hot accounts serialize correctly
+func (a *Account) MarshalJSON() ([]byte, error) {
+	a.Lock()
+	balance := a.Balance + a.pendingCredits()
+	held := a.held
+	limits := a.Limits
+	profile := a.Profile
+	signing := a.signingLocked()
+	available := a.availableLocked() + a.pendingCredits()
+	pockets := a.pocketsLocked()
+	a.Unlock()
+
+	return json.Marshal(struct {
+		ID        string         `json:"id"`
+		Username  string         `json:"username"`
+		Profile   Profile        `json:"profile"`
+		CreatedAt time.Time      `json:"created_at"`
+		Balance   float64        `json:"balance"`
+		Available float64        `json:"available"`
+		Held      float64        `json:"held,omitempty"`
+		Pockets   []Pocket       `json:"pockets,omitempty"`
+		Currency  string         `json:"currency,omitempty"`
+		Status    AccountStatus  `json:"status"`
+		Limits    Limits         `json:"limits"`
+		Signing   *SigningPolicy `json:"signing,omitempty"`
+	}{
+		ID:        a.ID,
+		Username:  a.Username,
+		Profile:   profile,
+		CreatedAt: a.CreatedAt,
+		Balance:   balance,
+		Available: available,
+		Held:      held,
+		Pockets:   pockets,
+		Currency:  a.Currency,
+		Status:    a.Status(),
+		Limits:    limits,
+		Signing:   signing,
+	})
 }
 
 // Lock locks the account for concurrent access
 func (a *Account) Lock() {
 	a.mutex.Lock()
+	a.lockedAt.Store(time.Now().UnixNano())
 }
 
 // Unlock unlocks the account
 func (a *Account) Unlock() {
+	a.lockedAt.Store(0)
 	a.mutex.Unlock()
-} 
+}
+
+// LockHeldFor returns how long the account mutex has been held, or zero if
+// it is not currently locked
+func (a *Account) LockHeldFor() time.Duration {
+	lockedAt := a.lockedAt.Load()
+	if lockedAt == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, lockedAt))
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Approval errors
+var (
+	ErrApprovalRequired = errors.New("transfer requires approval")
+	ErrApprovalNotFound = errors.New("approval not found")
+	ErrApprovalClosed   = errors.New("approval is no longer pending")
+	ErrApprovalExpired  = errors.New("approval deadline has passed")
+	ErrSelfApproval     = errors.New("a transfer cannot be approved by its submitter")
+	ErrCheckerRequired  = errors.New("a transfer can only be approved by an authenticated checker")
+	ErrReasonRequired   = errors.New("a reason is required")
+)
+
+// ApprovalStatus is the state of a transfer awaiting approval
+type ApprovalStatus string
+
+// Approval statuses
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalExpired  ApprovalStatus = "expired"
+	// ApprovalFailed means the transfer was approved but could not execute
+	ApprovalFailed ApprovalStatus = "failed"
+)
+
+// ApprovalEvent is one entry in the approval trail
+type ApprovalEvent struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Approval is a transfer held until a second person approves or rejects it
+type Approval struct {
+	ID        string          `json:"id"`
+	Request   TransferRequest `json:"request"`
+	Status    ApprovalStatus  `json:"status"`
+	Maker     string          `json:"maker,omitempty"`
+	Checker   string          `json:"checker,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Deadline  time.Time       `json:"deadline"`
+	Trail     []ApprovalEvent `json:"trail"`
+	// Risk is set when the risk engine sent the transfer to review
+	Risk *RiskAssessment `json:"risk,omitempty"`
+	// Signers are the joint account owners who have signed the transfer, of
+	// the RequiredSignatures it needs before it can execute
+	Signers            []string `json:"signers,omitempty"`
+	RequiredSignatures int      `json:"required_signatures,omitempty"`
+	// CheckerRequired is set when the transfer also needs a checker's
+	// approval because of its amount or risk
+	CheckerRequired bool `json:"checker_required"`
+}
+
+// heldFunds is the hold of an approved transfer. transfer() sets released
+// once the hold has been spent, whether or not the transfer succeeds.
+type heldFunds struct {
+	amount   float64
+	released bool
+}
+
+// MaxDecidedApprovals is how many decided approvals are kept for listing
+// once their transfers have executed or been turned down. Older ones are
+// retired, except those funding escrows.
+const MaxDecidedApprovals = 10000
+
+// approvalQueue holds transfers awaiting approval
+type approvalQueue struct {
+	threshold float64
+	deadline  time.Duration
+
+	mutex     sync.Mutex
+	approvals map[string]*Approval
+	order     []string
+	// pending holds the approvals awaiting a decision, so expiry need not
+	// scan decided ones
+	pending map[string]*Approval
+	// final counts the approvals that may be retired
+	final int
+}
+
+// WithApprovals holds transfers above the threshold until a second person
+// approves them. Undecided transfers expire after the deadline.
+func WithApprovals(threshold float64, deadline time.Duration) Option {
+	return func(ts *TransferService) {
+		ts.approvals = &approvalQueue{
+			threshold: threshold,
+			deadline:  deadline,
+			approvals: make(map[string]*Approval),
+			pending:   make(map[string]*Approval),
+		}
+	}
+}
+
+// ApprovalsEnabled reports whether large transfers are held for approval
+func (ts *TransferService) ApprovalsEnabled() bool {
+	return ts.approvals != nil
+}
+
+// required reports whether a transfer of the amount needs approval
+func (q *approvalQueue) required(amount float64) bool {
+	return q != nil && amount > q.threshold
+}
+
+// newApprovalID returns a random approval ID
+func newApprovalID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "apr_" + hex.EncodeToString(b[:])
+}
+
+// snapshot copies an approval so callers cannot race with later changes
+func (a *Approval) snapshot() Approval {
+	c := *a
+	c.Trail = append([]ApprovalEvent(nil), a.Trail...)
+	c.Signers = append([]string(nil), a.Signers...)
+	return c
+}
+
+// submit queues a transfer whose funds have just been held. The caller sets
+// the request, maker, checker and signature requirements, and the risk
+// assessment that sent it to review, if any.
+func (q *approvalQueue) submit(approval *Approval, now time.Time) Approval {
+	approval.ID = newApprovalID()
+	approval.Status = ApprovalPending
+	approval.CreatedAt = now
+	approval.Deadline = now.Add(q.deadline)
+	approval.Trail = []ApprovalEvent{{At: now, Action: "submitted", Actor: approval.Maker}}
+	switch {
+	case approval.Risk != nil:
+		approval.Trail[0].Reason = fmt.Sprintf("risk review, score %d", approval.Risk.Score)
+	case approval.RequiredSignatures > 0:
+		approval.Trail[0].Reason = fmt.Sprintf("joint account, %d of %d signatures", len(approval.Signers), approval.RequiredSignatures)
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.approvals[approval.ID] = approval
+	q.order = append(q.order, approval.ID)
+	q.pending[approval.ID] = approval
+	return approval.snapshot()
+}
+
+// finished reports whether nothing more will happen to an approval: it was
+// turned down, or approved and its transfer has run
+func (a *Approval) finished() bool {
+	switch a.Status {
+	case ApprovalRejected, ApprovalExpired, ApprovalFailed:
+		return true
+	case ApprovalApproved:
+		return executed(*a)
+	}
+	return false
+}
+
+// settle updates the bookkeeping after an approval's status changed, and
+// retires the oldest finished approvals once there are too many. Approvals
+// funding escrows are kept for the escrow book. The caller must hold the
+// mutex.
+func (q *approvalQueue) settle(approval *Approval) {
+	if approval.Status != ApprovalPending {
+		delete(q.pending, approval.ID)
+	}
+	if !approval.finished() || approval.Request.escrow {
+		return
+	}
+	q.final++
+
+	// Retire in batches so each decision stays cheap on average
+	if q.final <= MaxDecidedApprovals+MaxDecidedApprovals/4 {
+		return
+	}
+	order := q.order[:0]
+	for _, id := range q.order {
+		old := q.approvals[id]
+		if q.final > MaxDecidedApprovals && old.finished() && !old.Request.escrow {
+			delete(q.approvals, id)
+			q.final--
+			continue
+		}
+		order = append(order, id)
+	}
+	clear(q.order[len(order):])
+	q.order = order
+}
+
+// decide moves a pending approval to the status, recording who decided
+func (q *approvalQueue) decide(id, actor string, status ApprovalStatus, reason string, now time.Time) (Approval, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	approval, ok := q.approvals[id]
+	switch {
+	case !ok:
+		return Approval{}, ErrApprovalNotFound
+	case approval.Status == ApprovalExpired:
+		return approval.snapshot(), ErrApprovalExpired
+	case approval.Status != ApprovalPending:
+		return approval.snapshot(), ErrApprovalClosed
+	case status == ApprovalApproved && actor == "":
+		return approval.snapshot(), ErrCheckerRequired
+	case status == ApprovalApproved && actor == approval.Maker:
+		return approval.snapshot(), ErrSelfApproval
+	case status == ApprovalApproved && len(approval.Signers) < approval.RequiredSignatures:
+		return approval.snapshot(), ErrSignaturesRequired
+	}
+
+	approval.Status = status
+	approval.Checker = actor
+	approval.Trail = append(approval.Trail, ApprovalEvent{At: now, Action: string(status), Actor: actor, Reason: reason})
+	q.settle(approval)
+	return approval.snapshot(), nil
+}
+
+// record appends an event, optionally changing the status
+func (q *approvalQueue) record(id string, status ApprovalStatus, event ApprovalEvent) Approval {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	approval := q.approvals[id]
+	if status != "" {
+		approval.Status = status
+	}
+	approval.Trail = append(approval.Trail, event)
+	snapshot := approval.snapshot()
+	q.settle(approval)
+	return snapshot
+}
+
+// lookup returns the approval with the given ID without expiring others
+// first. It reports false on a nil queue.
+func (q *approvalQueue) lookup(id string) (Approval, bool) {
+	if q == nil {
+		return Approval{}, false
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	approval, ok := q.approvals[id]
+	if !ok {
+		return Approval{}, false
+	}
+	return approval.snapshot(), true
+}
+
+// expire marks pending approvals past their deadline as expired and returns them
+func (q *approvalQueue) expire(now time.Time) []Approval {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var expired []Approval
+	for _, approval := range q.pending {
+		if now.After(approval.Deadline) {
+			approval.Status = ApprovalExpired
+			approval.Trail = append(approval.Trail, ApprovalEvent{At: now, Action: string(ApprovalExpired)})
+			expired = append(expired, approval.snapshot())
+			q.settle(approval)
+		}
+	}
+	return expired
+}
+
+// releaseHold returns the funds held for an approval to its source account
+func (ts *TransferService) releaseHold(approval Approval) {
+	if account, err := ts.accountManager.GetAccount(approval.Request.From); err == nil {
+		account.releaseHold(approval.Request.Amount, approval.Request.FromPocket)
+	}
+}
+
+// ExpireApprovals expires pending approvals past their deadline, releasing
+// their held funds, and returns how many expired
+func (ts *TransferService) ExpireApprovals() int {
+	if ts.approvals == nil {
+		return 0
+	}
+
+	expired := ts.approvals.expire(time.Now())
+	for _, approval := range expired {
+		ts.releaseHold(approval)
+		ts.audit(context.Background(), "approval.expired", map[string]interface{}{"approval_id": approval.ID})
+	}
+	return len(expired)
+}
+
+// StartApprovalExpirer expires overdue approvals every interval until the
+// returned stop function is called
+func (ts *TransferService) StartApprovalExpirer(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ts.ExpireApprovals()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// Approval returns the approval with the given ID, including its trail
+func (ts *TransferService) Approval(id string) (Approval, error) {
+	if ts.approvals == nil {
+		return Approval{}, ErrApprovalNotFound
+	}
+	ts.ExpireApprovals()
+
+	approval, ok := ts.approvals.lookup(id)
+	if !ok {
+		return Approval{}, ErrApprovalNotFound
+	}
+	return approval, nil
+}
+
+// Approvals returns approvals in submission order, only those with the status
+// unless it is empty
+func (ts *TransferService) Approvals(status ApprovalStatus) []Approval {
+	approvals := []Approval{}
+	if ts.approvals == nil {
+		return approvals
+	}
+	ts.ExpireApprovals()
+
+	ts.approvals.mutex.Lock()
+	defer ts.approvals.mutex.Unlock()
+
+	// Pending approvals are listed from the pending set
+	if status == ApprovalPending {
+		for _, approval := range ts.approvals.pending {
+			approvals = append(approvals, approval.snapshot())
+		}
+		sort.Slice(approvals, func(i, j int) bool {
+			return approvals[i].CreatedAt.Before(approvals[j].CreatedAt)
+		})
+		return approvals
+	}
+
+	for _, id := range ts.approvals.order {
+		approval := ts.approvals.approvals[id]
+		if status == "" || approval.Status == status {
+			approvals = append(approvals, approval.snapshot())
+		}
+	}
+	return approvals
+}
+
+// Approve executes a pending transfer on behalf of the actor in ctx, who must
+// not be the submitter. The held funds are spent even if the transfer fails,
+// for example because an account was frozen meanwhile.
+func (ts *TransferService) Approve(ctx context.Context, id, reason string) (*TransferResult, Approval, error) {
+	if ts.approvals == nil {
+		return nil, Approval{}, ErrApprovalNotFound
+	}
+	if ts.Draining() {
+		return nil, Approval{}, ErrShuttingDown
+	}
+	ts.ExpireApprovals()
+
+	approval, err := ts.approvals.decide(id, ActorFromContext(ctx), ApprovalApproved, reason, time.Now())
+	if err != nil {
+		return nil, approval, err
+	}
+
+	ts.audit(ctx, "approval.approved", map[string]interface{}{"approval_id": id, "reason": reason})
+	return ts.execute(ctx, approval)
+}
+
+// execute runs an approved transfer from its held funds. The held funds are
+// spent even if the transfer fails.
+func (ts *TransferService) execute(ctx context.Context, approval Approval) (*TransferResult, Approval, error) {
+	id := approval.ID
+	hold := &heldFunds{amount: approval.Request.Amount}
+	result, err := ts.run(ctx, approval.Request, hold)
+	if !hold.released {
+		ts.releaseHold(approval)
+	}
+
+	if err != nil {
+		approval = ts.approvals.record(id, ApprovalFailed, ApprovalEvent{At: time.Now(), Action: string(ApprovalFailed), Reason: err.Error()})
+		ts.audit(ctx, "approval.failed", map[string]interface{}{"approval_id": id, "error": err.Error()})
+		return result, approval, err
+	}
+	approval = ts.approvals.record(id, "", ApprovalEvent{At: time.Now(), Action: "executed"})
+	return result, approval, nil
+}
+
+// Reject cancels a pending transfer on behalf of the actor in ctx and
+// releases its held funds. A reason is required.
+func (ts *TransferService) Reject(ctx context.Context, id, reason string) (Approval, error) {
+	if ts.approvals == nil {
+		return Approval{}, ErrApprovalNotFound
+	}
+	if reason == "" {
+		return Approval{}, ErrReasonRequired
+	}
+	ts.ExpireApprovals()
+
+	approval, err := ts.approvals.decide(id, ActorFromContext(ctx), ApprovalRejected, reason, time.Now())
+	if err != nil {
+		return approval, err
+	}
+
+	ts.releaseHold(approval)
+	ts.audit(ctx, "approval.rejected", map[string]interface{}{"approval_id": id, "reason": reason})
+	return approval, nil
+}
@@ -0,0 +1,32 @@
+package service
+
+import "context"
+
+// requestIDKey is the context key for the request ID
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by the context, if any
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// actorKey is the context key for the authenticated caller
+type actorKey struct{}
+
+// ContextWithActor returns a context carrying the ID of the caller on whose
+// behalf the service acts, for approvals and audit records
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the caller carried by the context, if any
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,61 @@
+package service
+
+import "errors"
+
+// errorCodes maps service errors to stable machine-readable codes
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrInsufficientFunds, "insufficient_funds"},
+	{ErrAccountNotFound, "not_found"},
+	{ErrInvalidAmount, "invalid_amount"},
+	{ErrSameAccount, "same_account"},
+	{ErrAccountExists, "account_exists"},
+	{ErrAccountFrozen, "account_frozen"},
+	{ErrAccountClosed, "account_closed"},
+	{ErrCurrencyMismatch, "currency_mismatch"},
+	{ErrLimitExceeded, "limit_exceeded"},
+	{ErrShuttingDown, "shutting_down"},
+	{ErrApprovalRequired, "pending_approval"},
+	{ErrApprovalNotFound, "approval_not_found"},
+	{ErrApprovalClosed, "approval_closed"},
+	{ErrApprovalExpired, "approval_expired"},
+	{ErrSelfApproval, "self_approval"},
+	{ErrCheckerRequired, "checker_required"},
+	{ErrReasonRequired, "reason_required"},
+	{ErrTransferBlocked, "risk_blocked"},
+	{ErrSanctioned, "sanctioned"},
+	{ErrScreeningPending, "screening_review"},
+	{ErrSignaturesRequired, "signatures_required"},
+	{ErrSigningUnavailable, "signing_unavailable"},
+	{ErrNotSigner, "not_signer"},
+	{ErrAlreadySigned, "already_signed"},
+	{ErrPocketNotFound, "pocket_not_found"},
+	{ErrPocketExists, "pocket_exists"},
+	{ErrPocketLocked, "pocket_locked"},
+	{ErrTooManyPockets, "too_many_pockets"},
+	{ErrSamePocket, "same_pocket"},
+	{ErrInvalidPocketName, "invalid_pocket_name"},
+	{ErrEscrowNotFound, "escrow_not_found"},
+	{ErrEscrowState, "invalid_escrow_state"},
+	{ErrEscrowAccount, "escrow_account"},
+	{ErrNotArbiter, "not_arbiter"},
+	{ErrInvalidArbiter, "invalid_arbiter"},
+	{ErrInvalidSplit, "invalid_split"},
+}
+
+// ErrorCode returns a stable code for the error, "success" for nil and
+// "error" for errors the service does not define
+func ErrorCode(err error) string {
+	if err == nil {
+		return "success"
+	}
+
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			return ec.code
+		}
+	}
+	return "error"
+}
@@ -0,0 +1,581 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Escrow errors
+var (
+	ErrEscrowNotFound = errors.New("escrow not found")
+	ErrEscrowState    = errors.New("escrow does not allow this in its current state")
+	ErrEscrowAccount  = errors.New("the escrow account only takes part in funding and settling escrows")
+	ErrNotArbiter     = errors.New("only the escrow's arbiter can resolve its dispute")
+	ErrInvalidArbiter = errors.New("an escrow needs an arbiter other than its creator")
+	ErrInvalidSplit   = errors.New("payee amount must be between zero and the escrow amount")
+)
+
+// EscrowStatus is the state of an escrow
+type EscrowStatus string
+
+// Escrow statuses. Pending escrows wait for their funding transfer to be
+// approved; funded and disputed escrows hold money; the rest are final.
+const (
+	EscrowPending   EscrowStatus = "pending"
+	EscrowFunded    EscrowStatus = "funded"
+	EscrowDisputed  EscrowStatus = "disputed"
+	EscrowReleased  EscrowStatus = "released"
+	EscrowRefunded  EscrowStatus = "refunded"
+	EscrowSplit     EscrowStatus = "split"
+	EscrowCancelled EscrowStatus = "cancelled"
+	EscrowExpired   EscrowStatus = "expired"
+)
+
+// EscrowRequest asks to move Amount from Payer into escrow for Payee, with
+// Arbiter, an actor, deciding disputes
+type EscrowRequest struct {
+	Payer   string  `json:"payer"`
+	Payee   string  `json:"payee"`
+	Arbiter string  `json:"arbiter"`
+	Amount  float64 `json:"amount"`
+}
+
+// EscrowEvent is one entry in the escrow trail
+type EscrowEvent struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Escrow holds a payment in the escrow account until the payer confirms it,
+// the payee cancels it, the arbiter resolves a dispute or the deadline passes
+type Escrow struct {
+	ID        string       `json:"id"`
+	Payer     string       `json:"payer"`
+	Payee     string       `json:"payee"`
+	Arbiter   string       `json:"arbiter"`
+	Amount    float64      `json:"amount"`
+	Status    EscrowStatus `json:"status"`
+	CreatedBy string       `json:"created_by,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	// Deadline is when a funded escrow is refunded to the payer unless it is
+	// disputed; it is set once the escrow is funded
+	Deadline time.Time `json:"deadline"`
+	// FundingApprovalID is the approval the funding transfer was held for
+	FundingApprovalID string `json:"funding_approval_id,omitempty"`
+	// PaidToPayee and RefundedToPayer are set once the escrow is settled
+	PaidToPayee     float64       `json:"paid_to_payee,omitempty"`
+	RefundedToPayer float64       `json:"refunded_to_payer,omitempty"`
+	Trail           []EscrowEvent `json:"trail"`
+
+	// settling is set while the escrow is being paid out
+	settling bool
+}
+
+// escrowBook holds the escrows. An escrow is marked settling under the mutex
+// before it is paid out, so that it is paid out once without holding the
+// mutex across the payout.
+type escrowBook struct {
+	account string
+	timeout time.Duration
+
+	mutex   sync.Mutex
+	escrows map[string]*Escrow
+	order   []string
+}
+
+// WithEscrow holds escrowed payments in the named account, which ordinary
+// transfers cannot debit or credit. Funded escrows not settled or disputed within the
+// timeout are refunded.
+func WithEscrow(account string, timeout time.Duration) Option {
+	return func(ts *TransferService) {
+		ts.escrows = &escrowBook{account: account, timeout: timeout, escrows: make(map[string]*Escrow)}
+	}
+}
+
+// EscrowsEnabled reports whether escrows can be created
+func (ts *TransferService) EscrowsEnabled() bool {
+	return ts.escrows != nil
+}
+
+// IsEscrowAccount reports whether the username is the escrow account
+func (ts *TransferService) IsEscrowAccount(username string) bool {
+	return ts.escrows != nil && username == ts.escrows.account
+}
+
+// newEscrowID returns a random escrow ID
+func newEscrowID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "esc_" + hex.EncodeToString(b[:])
+}
+
+// snapshot copies an escrow so callers cannot race with later changes
+func (e *Escrow) snapshot() Escrow {
+	c := *e
+	c.Trail = append([]EscrowEvent(nil), e.Trail...)
+	return c
+}
+
+// fund marks the escrow as funded and starts its deadline. The caller must
+// hold the book mutex.
+func (b *escrowBook) fund(e *Escrow, now time.Time) {
+	e.Status = EscrowFunded
+	e.Deadline = now.Add(b.timeout)
+	e.Trail = append(e.Trail, EscrowEvent{At: now, Action: string(EscrowFunded)})
+}
+
+// CreateEscrow moves money from the payer into escrow on behalf of the actor
+// in ctx. The funding is an ordinary transfer to the escrow account, so it
+// may be held for approval or signatures; the escrow is then pending until
+// that transfer executes. The transfer result is returned as well.
+func (ts *TransferService) CreateEscrow(ctx context.Context, req EscrowRequest) (*TransferResult, Escrow, error) {
+	if ts.escrows == nil {
+		return nil, Escrow{}, ErrEscrowNotFound
+	}
+	req.Payer, req.Payee = ts.username(req.Payer), ts.username(req.Payee)
+	actor := ActorFromContext(ctx)
+	if req.Arbiter == "" || req.Arbiter == actor {
+		return nil, Escrow{}, ErrInvalidArbiter
+	}
+	if req.Payer == req.Payee {
+		return nil, Escrow{}, ErrSameAccount
+	}
+	if ts.IsEscrowAccount(req.Payer) || ts.IsEscrowAccount(req.Payee) {
+		return nil, Escrow{}, ErrEscrowAccount
+	}
+	payee, err := ts.accountManager.GetAccount(req.Payee)
+	if err != nil {
+		return nil, Escrow{}, err
+	}
+	payer, err := ts.accountManager.GetAccount(req.Payer)
+	if err != nil {
+		return nil, Escrow{}, err
+	}
+	source, err := ts.accountManager.GetAccount(ts.escrows.account)
+	if err != nil {
+		return nil, Escrow{}, err
+	}
+
+	// The escrow may pay either party, so all three accounts must hold the
+	// same currency
+	if !sameCurrency(payer, payee) || !sameCurrency(payer, source) || !sameCurrency(payee, source) {
+		return nil, Escrow{}, ErrCurrencyMismatch
+	}
+
+	result, err := ts.run(ctx, TransferRequest{From: req.Payer, To: ts.escrows.account, Amount: req.Amount, escrow: true}, nil)
+	held := errors.Is(err, ErrApprovalRequired) || errors.Is(err, ErrSignaturesRequired)
+	if err != nil && !held {
+		return result, Escrow{}, err
+	}
+
+	now := time.Now()
+	escrow := &Escrow{
+		ID:        newEscrowID(),
+		Payer:     req.Payer,
+		Payee:     req.Payee,
+		Arbiter:   req.Arbiter,
+		Amount:    req.Amount,
+		Status:    EscrowPending,
+		CreatedBy: actor,
+		CreatedAt: now,
+		Trail:     []EscrowEvent{{At: now, Action: "created", Actor: actor}},
+	}
+
+	b := ts.escrows
+	b.mutex.Lock()
+	if held {
+		escrow.FundingApprovalID = result.ApprovalID
+	} else {
+		b.fund(escrow, now)
+	}
+	b.escrows[escrow.ID] = escrow
+	b.order = append(b.order, escrow.ID)
+	snapshot := escrow.snapshot()
+	b.mutex.Unlock()
+
+	ts.audit(ctx, "escrow.created", map[string]interface{}{
+		"escrow_id": escrow.ID,
+		"payer":     req.Payer,
+		"payee":     req.Payee,
+		"arbiter":   req.Arbiter,
+		"amount":    req.Amount,
+		"status":    snapshot.Status,
+	})
+	return result, snapshot, nil
+}
+
+// Escrow returns the escrow with the given ID, including its trail
+func (ts *TransferService) Escrow(id string) (Escrow, error) {
+	if ts.escrows == nil {
+		return Escrow{}, ErrEscrowNotFound
+	}
+	ts.ExpireEscrows()
+
+	ts.escrows.mutex.Lock()
+	defer ts.escrows.mutex.Unlock()
+
+	escrow, ok := ts.escrows.escrows[id]
+	if !ok {
+		return Escrow{}, ErrEscrowNotFound
+	}
+	return escrow.snapshot(), nil
+}
+
+// Escrows returns escrows in creation order, only those with the status
+// unless it is empty
+func (ts *TransferService) Escrows(status EscrowStatus) []Escrow {
+	escrows := []Escrow{}
+	if ts.escrows == nil {
+		return escrows
+	}
+	ts.ExpireEscrows()
+
+	ts.escrows.mutex.Lock()
+	defer ts.escrows.mutex.Unlock()
+
+	for _, id := range ts.escrows.order {
+		escrow := ts.escrows.escrows[id]
+		if status == "" || escrow.Status == status {
+			escrows = append(escrows, escrow.snapshot())
+		}
+	}
+	return escrows
+}
+
+// Confirm releases the escrowed money to the payee. It is meant for the
+// payer, and settles disputed escrows too.
+func (ts *TransferService) Confirm(ctx context.Context, id, reason string) (Escrow, error) {
+	return ts.settleEscrow(ctx, id, reason, func(e *Escrow) (float64, EscrowStatus, error) {
+		return e.Amount, EscrowReleased, nil
+	})
+}
+
+// Cancel refunds the escrowed money to the payer. It is meant for the payee,
+// and settles disputed escrows too.
+func (ts *TransferService) Cancel(ctx context.Context, id, reason string) (Escrow, error) {
+	return ts.settleEscrow(ctx, id, reason, func(e *Escrow) (float64, EscrowStatus, error) {
+		return 0, EscrowRefunded, nil
+	})
+}
+
+// Resolve settles a disputed escrow on behalf of its arbiter, or of anyone
+// when the caller is unauthenticated, paying payeeAmount to the payee and
+// refunding the rest to the payer. A reason is required.
+func (ts *TransferService) Resolve(ctx context.Context, id string, payeeAmount float64, reason string) (Escrow, error) {
+	if reason == "" {
+		return Escrow{}, ErrReasonRequired
+	}
+	actor := ActorFromContext(ctx)
+
+	return ts.settleEscrow(ctx, id, reason, func(e *Escrow) (float64, EscrowStatus, error) {
+		switch {
+		case actor != "" && actor != e.Arbiter:
+			return 0, "", ErrNotArbiter
+		case e.Status != EscrowDisputed:
+			return 0, "", ErrEscrowState
+		case payeeAmount < 0 || payeeAmount > e.Amount:
+			return 0, "", ErrInvalidSplit
+		case payeeAmount == e.Amount:
+			return payeeAmount, EscrowReleased, nil
+		case payeeAmount == 0:
+			return 0, EscrowRefunded, nil
+		}
+		return payeeAmount, EscrowSplit, nil
+	})
+}
+
+// Dispute stops a funded escrow's deadline until its arbiter resolves it. It
+// is meant for the payer or payee. A reason is required.
+func (ts *TransferService) Dispute(ctx context.Context, id, reason string) (Escrow, error) {
+	if ts.escrows == nil {
+		return Escrow{}, ErrEscrowNotFound
+	}
+	if reason == "" {
+		return Escrow{}, ErrReasonRequired
+	}
+	ts.ExpireEscrows()
+
+	ts.escrows.mutex.Lock()
+	escrow, ok := ts.escrows.escrows[id]
+	if !ok {
+		ts.escrows.mutex.Unlock()
+		return Escrow{}, ErrEscrowNotFound
+	}
+	if escrow.Status != EscrowFunded || escrow.settling {
+		snapshot := escrow.snapshot()
+		ts.escrows.mutex.Unlock()
+		return snapshot, ErrEscrowState
+	}
+	escrow.Status = EscrowDisputed
+	escrow.Trail = append(escrow.Trail, EscrowEvent{At: time.Now(), Action: string(EscrowDisputed), Actor: ActorFromContext(ctx), Reason: reason})
+	snapshot := escrow.snapshot()
+	ts.escrows.mutex.Unlock()
+
+	ts.audit(ctx, "escrow.disputed", map[string]interface{}{"escrow_id": id, "reason": reason})
+	return snapshot, nil
+}
+
+// settleEscrow pays out a funded or disputed escrow. decide returns the
+// amount for the payee, the rest going back to the payer, and the final
+// status. The escrow is unchanged if the payout fails. The book mutex is not
+// held during the payout.
+func (ts *TransferService) settleEscrow(ctx context.Context, id, reason string, decide func(e *Escrow) (float64, EscrowStatus, error)) (Escrow, error) {
+	if ts.escrows == nil {
+		return Escrow{}, ErrEscrowNotFound
+	}
+	if ts.Draining() {
+		return Escrow{}, ErrShuttingDown
+	}
+	ts.ExpireEscrows()
+
+	b := ts.escrows
+	b.mutex.Lock()
+	escrow, ok := b.escrows[id]
+	if !ok {
+		b.mutex.Unlock()
+		return Escrow{}, ErrEscrowNotFound
+	}
+	if (escrow.Status != EscrowFunded && escrow.Status != EscrowDisputed) || escrow.settling {
+		snapshot := escrow.snapshot()
+		b.mutex.Unlock()
+		return snapshot, ErrEscrowState
+	}
+	payeeAmount, status, err := decide(escrow)
+	if err != nil {
+		snapshot := escrow.snapshot()
+		b.mutex.Unlock()
+		return snapshot, err
+	}
+	escrow.settling = true
+	b.mutex.Unlock()
+
+	err = ts.payout(ctx, escrow, payeeAmount)
+
+	b.mutex.Lock()
+	escrow.settling = false
+	if err == nil {
+		b.settled(escrow, status, payeeAmount, EscrowEvent{At: time.Now(), Action: string(status), Actor: ActorFromContext(ctx), Reason: reason})
+	}
+	snapshot := escrow.snapshot()
+	b.mutex.Unlock()
+	if err != nil {
+		return snapshot, err
+	}
+
+	ts.audit(ctx, "escrow."+string(status), map[string]interface{}{
+		"escrow_id":         id,
+		"paid_to_payee":     snapshot.PaidToPayee,
+		"refunded_to_payer": snapshot.RefundedToPayer,
+		"reason":            reason,
+	})
+	return snapshot, nil
+}
+
+// settled records a payout. The caller must hold the book mutex.
+func (b *escrowBook) settled(e *Escrow, status EscrowStatus, payeeAmount float64, event EscrowEvent) {
+	e.Status = status
+	e.PaidToPayee = payeeAmount
+	e.RefundedToPayer = e.Amount - payeeAmount
+	e.Trail = append(e.Trail, event)
+}
+
+// payout moves an escrow's money out of the escrow account, payeeAmount to
+// the payee and the rest to the payer. It reads only the escrow's parties and
+// amount, which never change, so the book mutex need not be held. Like transfers, it takes the account
+// locks in username order, with credits to hot accounts taken last, and
+// refuses frozen, closed or listed parties.
+func (ts *TransferService) payout(ctx context.Context, e *Escrow, payeeAmount float64) error {
+	if !ts.begin() {
+		return ErrShuttingDown
+	}
+	defer ts.end()
+
+	ctx, span := ts.tracer.Start(ctx, "TransferService.Payout")
+	defer span.End()
+	span.SetAttribute("escrow.id", e.ID)
+
+	source, err := ts.getAccount(ctx, ts.escrows.account)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	credits := make(map[*Account]float64)
+	for _, leg := range []struct {
+		username string
+		amount   float64
+	}{{e.Payee, payeeAmount}, {e.Payer, e.Amount - payeeAmount}} {
+		if leg.amount <= 0 {
+			continue
+		}
+		account, err := ts.getAccount(ctx, leg.username)
+		if err == nil {
+			err = ts.screen(ctx, TransferRequest{From: source.Username, To: leg.username, Amount: leg.amount})
+		}
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+		credits[account] = leg.amount
+	}
+
+	locked := []*Account{source}
+	for account := range credits {
+		if !account.IsHot() {
+			locked = append(locked, account)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool {
+		return strings.Compare(locked[i].Username, locked[j].Username) < 0
+	})
+	for _, account := range locked {
+		ts.lock(ctx, account)
+		defer account.Unlock()
+	}
+
+	if err := source.checkActive(); err != nil {
+		return err
+	}
+	for account := range credits {
+		if err := account.checkActive(); err != nil {
+			return err
+		}
+		if !sameCurrency(source, account) {
+			return ErrCurrencyMismatch
+		}
+		for other := range credits {
+			if !sameCurrency(account, other) {
+				return ErrCurrencyMismatch
+			}
+		}
+	}
+	source.consolidateLocked()
+	if source.availableLocked() < e.Amount {
+		return ErrInsufficientFunds
+	}
+
+	source.Balance -= e.Amount
+	for account, amount := range credits {
+		if account.IsHot() {
+			account.credit(amount)
+		} else {
+			account.Balance += amount
+		}
+	}
+	return nil
+}
+
+// ExpireEscrows settles escrows whose state has moved on without them:
+// pending escrows whose funding transfer executed or was turned down, and
+// funded escrows past their deadline, which are refunded. It returns how many
+// escrows it settled.
+func (ts *TransferService) ExpireEscrows() int {
+	if ts.escrows == nil {
+		return 0
+	}
+
+	// Expire approvals once rather than on every lookup below
+	ts.ExpireApprovals()
+
+	// Pick the escrows to settle under the book mutex, then look up their
+	// approvals and pay them out without it
+	b := ts.escrows
+	now := time.Now()
+	var pending, overdue []*Escrow
+	b.mutex.Lock()
+	for _, id := range b.order {
+		escrow := b.escrows[id]
+		switch {
+		case escrow.settling:
+		case escrow.Status == EscrowPending:
+			pending = append(pending, escrow)
+		case escrow.Status == EscrowFunded && now.After(escrow.Deadline):
+			escrow.settling = true
+			overdue = append(overdue, escrow)
+		}
+	}
+	b.mutex.Unlock()
+
+	ctx := context.Background()
+	settled := 0
+	for _, escrow := range pending {
+		approval, found := ts.approvals.lookup(escrow.FundingApprovalID)
+
+		var action EscrowStatus
+		b.mutex.Lock()
+		switch {
+		case escrow.Status != EscrowPending:
+		case found && approval.Status == ApprovalApproved && executed(approval):
+			b.fund(escrow, now)
+			action = EscrowFunded
+		case !found || (approval.Status != ApprovalPending && approval.Status != ApprovalApproved):
+			escrow.Status = EscrowCancelled
+			escrow.Trail = append(escrow.Trail, EscrowEvent{At: now, Action: string(EscrowCancelled), Reason: "funding transfer was not executed"})
+			action = EscrowCancelled
+		}
+		b.mutex.Unlock()
+
+		if action != "" {
+			ts.audit(ctx, "escrow."+string(action), map[string]interface{}{"escrow_id": escrow.ID, "approval_id": escrow.FundingApprovalID})
+			settled++
+		}
+	}
+
+	for _, escrow := range overdue {
+		err := ts.payout(ctx, escrow, 0)
+
+		b.mutex.Lock()
+		escrow.settling = false
+		if err == nil {
+			b.settled(escrow, EscrowExpired, 0, EscrowEvent{At: now, Action: string(EscrowExpired)})
+		}
+		b.mutex.Unlock()
+
+		// On failure try again on the next pass, for example once the payer
+		// is unfrozen
+		if err == nil {
+			ts.audit(ctx, "escrow.expired", map[string]interface{}{"escrow_id": escrow.ID, "refunded_to_payer": escrow.Amount})
+			settled++
+		}
+	}
+	return settled
+}
+
+// executed reports whether an approved transfer has executed
+func executed(approval Approval) bool {
+	for _, event := range approval.Trail {
+		if event.Action == "executed" {
+			return true
+		}
+	}
+	return false
+}
+
+// StartEscrowExpirer settles pending and overdue escrows every interval
+// until the returned stop function is called
+func (ts *TransferService) StartEscrowExpirer(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ts.ExpireEscrows()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
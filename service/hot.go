@@ -0,0 +1,124 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// creditStripe is one internal sub-balance of a hot account
+type creditStripe struct {
+	mutex  sync.Mutex
+	amount float64
+	// pad keeps neighbouring stripes on separate cache lines
+	_ [48]byte
+}
+
+// hotCredits spreads incoming credits across several stripes so concurrent
+// transfers into the same account do not serialize on the account mutex
+type hotCredits struct {
+	stripes []creditStripe
+	next    uint32
+}
+
+// EnableHotCredits marks the account as hot, spreading credits across the
+// given number of sub-balances. Debits still take the account mutex and
+// consolidate the sub-balances first, so they remain overdraft-safe.
+// Calling it on an account that is already hot has no effect.
+func (a *Account) EnableHotCredits(stripes int) {
+	if stripes < 1 {
+		stripes = 1
+	}
+
+	a.hot.CompareAndSwap(nil, &hotCredits{stripes: make([]creditStripe, stripes)})
+}
+
+// IsHot reports whether credits to the account are spread across sub-balances
+func (a *Account) IsHot() bool {
+	return a.hot.Load() != nil
+}
+
+// Consolidate folds all hot sub-balances into the main balance. It is safe to
+// call at any time, for example periodically from a background goroutine.
+func (a *Account) Consolidate() {
+	if !a.IsHot() {
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.consolidateLocked()
+}
+
+// credit adds the amount to the next sub-balance of a hot account.
+// It must only be called on hot accounts and never takes the account mutex.
+func (a *Account) credit(amount float64) {
+	hc := a.hot.Load()
+	i := atomic.AddUint32(&hc.next, 1) % uint32(len(hc.stripes))
+
+	stripe := &hc.stripes[i]
+	stripe.mutex.Lock()
+	stripe.amount += amount
+	stripe.mutex.Unlock()
+}
+
+// consolidateLocked drains the sub-balances into Balance.
+// The caller must hold the account mutex.
+func (a *Account) consolidateLocked() {
+	hc := a.hot.Load()
+	if hc == nil {
+		return
+	}
+
+	for i := range hc.stripes {
+		stripe := &hc.stripes[i]
+		stripe.mutex.Lock()
+		a.Balance += stripe.amount
+		stripe.amount = 0
+		stripe.mutex.Unlock()
+	}
+}
+
+// pendingCredits returns the sum of unconsolidated sub-balances.
+// The caller must hold the account mutex.
+func (a *Account) pendingCredits() float64 {
+	hc := a.hot.Load()
+	if hc == nil {
+		return 0
+	}
+
+	var total float64
+	for i := range hc.stripes {
+		stripe := &hc.stripes[i]
+		stripe.mutex.Lock()
+		total += stripe.amount
+		stripe.mutex.Unlock()
+	}
+
+	return total
+}
+
+// StartConsolidator periodically consolidates every hot account managed by
+// the account manager. The returned function stops the background goroutine.
+func StartConsolidator(accountManager AccountManager, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				for _, account := range accountManager.ListAccounts() {
+					account.Consolidate()
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
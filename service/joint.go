@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Joint account errors
+var (
+	ErrSignaturesRequired = errors.New("transfer requires more owner signatures")
+	ErrSigningUnavailable = errors.New("transfers needing several signatures require approvals to be enabled")
+	ErrNotSigner          = errors.New("only an owner of the account can sign its transfers")
+	ErrAlreadySigned      = errors.New("owner has already signed this transfer")
+)
+
+// SigningRule requires Signatures owners to authorize transfers of at least
+// MinAmount
+type SigningRule struct {
+	MinAmount  float64 `json:"min_amount"`
+	Signatures int     `json:"signatures"`
+}
+
+// SigningPolicy makes an account joint: it lists the actors who own it and
+// how many of them must sign a transfer from it
+type SigningPolicy struct {
+	Owners []string      `json:"owners"`
+	Rules  []SigningRule `json:"rules,omitempty"`
+}
+
+// Validate checks that the owners are distinct and every rule can be met
+func (p *SigningPolicy) Validate() error {
+	if len(p.Owners) == 0 {
+		return errors.New("a joint account needs at least one owner")
+	}
+	seen := make(map[string]bool)
+	for _, owner := range p.Owners {
+		if owner == "" || seen[owner] {
+			return fmt.Errorf("owner %q is empty or listed twice", owner)
+		}
+		seen[owner] = true
+	}
+	for _, rule := range p.Rules {
+		if rule.MinAmount < 0 {
+			return errors.New("signing rule min_amount cannot be negative")
+		}
+		if rule.Signatures < 1 || rule.Signatures > len(p.Owners) {
+			return fmt.Errorf("signing rule needs 1 to %d signatures, got %d", len(p.Owners), rule.Signatures)
+		}
+	}
+	return nil
+}
+
+// Required returns how many owners must sign a transfer of the amount: the
+// most any applicable rule asks for, and one if none applies
+func (p *SigningPolicy) Required(amount float64) int {
+	required := 1
+	for _, rule := range p.Rules {
+		if amount >= rule.MinAmount {
+			required = max(required, rule.Signatures)
+		}
+	}
+	return required
+}
+
+// IsOwner reports whether the actor owns the account
+func (p *SigningPolicy) IsOwner(actor string) bool {
+	for _, owner := range p.Owners {
+		if actor != "" && owner == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// SigningPolicy returns a copy of the account's signing policy, or nil if it
+// is not a joint account
+func (a *Account) SigningPolicy() *SigningPolicy {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.signingLocked()
+}
+
+// signingLocked copies the signing policy. The caller must hold the account
+// lock.
+func (a *Account) signingLocked() *SigningPolicy {
+	if a.Signing == nil {
+		return nil
+	}
+	return &SigningPolicy{
+		Owners: append([]string(nil), a.Signing.Owners...),
+		Rules:  append([]SigningRule(nil), a.Signing.Rules...),
+	}
+}
+
+// SetSigningPolicy makes the account joint, or a single-owner account again
+// if policy is nil. Transfers already awaiting signatures keep the number
+// they were submitted with.
+func (a *Account) SetSigningPolicy(policy *SigningPolicy) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.Signing = policy
+}
+
+// Sign adds the signature of the actor in ctx, who must own the source
+// account, to a transfer awaiting signatures. The transfer executes once it
+// has enough signatures, unless it also waits for a checker's approval.
+func (ts *TransferService) Sign(ctx context.Context, id, reason string) (*TransferResult, Approval, error) {
+	if ts.approvals == nil {
+		return nil, Approval{}, ErrApprovalNotFound
+	}
+	if ts.Draining() {
+		return nil, Approval{}, ErrShuttingDown
+	}
+
+	approval, err := ts.Approval(id)
+	if err != nil {
+		return nil, approval, err
+	}
+	actor := ActorFromContext(ctx)
+	account, err := ts.accountManager.GetAccount(approval.Request.From)
+	if err != nil {
+		return nil, approval, err
+	}
+	if policy := account.SigningPolicy(); policy == nil || !policy.IsOwner(actor) {
+		return nil, approval, ErrNotSigner
+	}
+
+	approval, ready, err := ts.approvals.sign(id, actor, reason, time.Now())
+	if err != nil {
+		return nil, approval, err
+	}
+	ts.audit(ctx, "approval.signed", map[string]interface{}{
+		"approval_id": id,
+		"signatures":  len(approval.Signers),
+		"required":    approval.RequiredSignatures,
+	})
+
+	if !ready {
+		return nil, approval, nil
+	}
+	return ts.execute(ctx, approval)
+}
+
+// sign records an owner's signature and reports whether the approval now
+// has every signature and needs no checker, in which case it is approved
+func (q *approvalQueue) sign(id, actor, reason string, now time.Time) (Approval, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	approval, ok := q.approvals[id]
+	switch {
+	case !ok:
+		return Approval{}, false, ErrApprovalNotFound
+	case approval.Status == ApprovalExpired:
+		return approval.snapshot(), false, ErrApprovalExpired
+	case approval.Status != ApprovalPending:
+		return approval.snapshot(), false, ErrApprovalClosed
+	}
+	for _, signer := range approval.Signers {
+		if signer == actor {
+			return approval.snapshot(), false, ErrAlreadySigned
+		}
+	}
+
+	approval.Signers = append(approval.Signers, actor)
+	approval.Trail = append(approval.Trail, ApprovalEvent{At: now, Action: "signed", Actor: actor, Reason: reason})
+
+	ready := len(approval.Signers) >= approval.RequiredSignatures && !approval.CheckerRequired
+	if ready {
+		approval.Status = ApprovalApproved
+		q.settle(approval)
+	}
+	return approval.snapshot(), ready, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"log/slog"
+	"time"
+
+	"money-transfer-system/tracing"
+)
+
+// Account tiers used when reporting lock contention
+const (
+	TierStandard = "standard"
+	TierHot      = "hot"
+)
+
+// TransferObserver receives measurements from the transfer service
+type TransferObserver interface {
+	// TransferCompleted is called once per transfer with its outcome code
+	TransferCompleted(outcome string, duration time.Duration)
+
+	// LockAcquired is called for every account lock a transfer acquires
+	LockAcquired(tier string, wait time.Duration)
+}
+
+// nopObserver discards all measurements
+type nopObserver struct{}
+
+func (nopObserver) TransferCompleted(string, time.Duration) {}
+func (nopObserver) LockAcquired(string, time.Duration)      {}
+
+// Option configures optional TransferService behaviour
+type Option func(*TransferService)
+
+// WithObserver reports transfer measurements to the observer
+func WithObserver(observer TransferObserver) Option {
+	return func(ts *TransferService) {
+		ts.observer = observer
+	}
+}
+
+// WithLogger logs every transfer with its request ID and outcome
+func WithLogger(logger *slog.Logger) Option {
+	return func(ts *TransferService) {
+		ts.logger = logger
+	}
+}
+
+// WithTracer records spans for transfers, account lookups and lock acquisitions
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(ts *TransferService) {
+		ts.tracer = tracer
+	}
+}
+
+// WithAuditor records completed and held transfers and approval decisions
+func WithAuditor(auditor Auditor) Option {
+	return func(ts *TransferService) {
+		ts.auditor = auditor
+	}
+}
+
+// tier returns the contention tier of the account
+func (a *Account) tier() string {
+	if a.IsHot() {
+		return TierHot
+	}
+	return TierStandard
+}
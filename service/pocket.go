@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"time"
+)
+
+// Pocket errors
+var (
+	ErrPocketNotFound    = errors.New("pocket not found")
+	ErrPocketExists      = errors.New("pocket already exists")
+	ErrPocketLocked      = errors.New("pocket does not allow direct debits")
+	ErrTooManyPockets    = errors.New("account has too many pockets")
+	ErrSamePocket        = errors.New("cannot move money to the same pocket")
+	ErrInvalidPocketName = errors.New("invalid pocket name")
+)
+
+// Pocket bounds
+const (
+	MaxPockets          = 20
+	MaxPocketNameLength = 32
+)
+
+// Pocket earmarks part of an account's balance, such as savings for rent.
+// Pocket balances are included in the account balance but cannot be spent
+// by ordinary transfers.
+type Pocket struct {
+	Name    string  `json:"name"`
+	Balance float64 `json:"balance"`
+	// Goal is the amount the holder is saving towards; zero means none
+	Goal float64 `json:"goal,omitempty"`
+	// DirectDebit lets transfers naming the pocket spend it directly
+	DirectDebit bool      `json:"direct_debit"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ValidPocketName reports whether a pocket name is 1 to MaxPocketNameLength
+// characters in the format of a username
+func ValidPocketName(name string) bool {
+	return len(name) <= MaxPocketNameLength && validName(name)
+}
+
+// Pockets returns copies of the account's pockets in creation order
+func (a *Account) Pockets() []Pocket {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.pocketsLocked()
+}
+
+// pocketsLocked copies the pockets. The caller must hold the account lock.
+func (a *Account) pocketsLocked() []Pocket {
+	pockets := make([]Pocket, len(a.pockets))
+	for i, pocket := range a.pockets {
+		pockets[i] = *pocket
+	}
+	return pockets
+}
+
+// pocketLocked finds a pocket by name. The caller must hold the account lock.
+func (a *Account) pocketLocked(name string) (*Pocket, error) {
+	for _, pocket := range a.pockets {
+		if pocket.Name == name {
+			return pocket, nil
+		}
+	}
+	return nil, ErrPocketNotFound
+}
+
+// earmarkedLocked returns the total balance of the pockets. The caller must
+// hold the account lock.
+func (a *Account) earmarkedLocked() float64 {
+	total := 0.0
+	for _, pocket := range a.pockets {
+		total += pocket.Balance
+	}
+	return total
+}
+
+// CreatePocket adds an empty pocket
+func (a *Account) CreatePocket(name string, goal float64, directDebit bool) (Pocket, error) {
+	if !ValidPocketName(name) {
+		return Pocket{}, ErrInvalidPocketName
+	}
+	if goal < 0 {
+		return Pocket{}, ErrInvalidAmount
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if _, err := a.pocketLocked(name); err == nil {
+		return Pocket{}, ErrPocketExists
+	}
+	if len(a.pockets) >= MaxPockets {
+		return Pocket{}, ErrTooManyPockets
+	}
+
+	pocket := &Pocket{Name: name, Goal: goal, DirectDebit: directDebit, CreatedAt: time.Now().UTC()}
+	a.pockets = append(a.pockets, pocket)
+	return *pocket, nil
+}
+
+// UpdatePocket changes a pocket's goal and whether transfers may debit it
+func (a *Account) UpdatePocket(name string, goal float64, directDebit bool) (Pocket, error) {
+	if goal < 0 {
+		return Pocket{}, ErrInvalidAmount
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	pocket, err := a.pocketLocked(name)
+	if err != nil {
+		return Pocket{}, err
+	}
+	pocket.Goal = goal
+	pocket.DirectDebit = directDebit
+	return *pocket, nil
+}
+
+// DeletePocket removes a pocket, returning its balance to the main balance,
+// and reports how much was returned
+func (a *Account) DeletePocket(name string) (float64, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	for i, pocket := range a.pockets {
+		if pocket.Name == name {
+			a.pockets = append(a.pockets[:i], a.pockets[i+1:]...)
+			return pocket.Balance, nil
+		}
+	}
+	return 0, ErrPocketNotFound
+}
+
+// MovePocket moves money between two pockets of the account, where an empty
+// name is the main balance. The account balance is unchanged. Frozen and
+// closed accounts cannot move money.
+func (a *Account) MovePocket(from, to string, amount float64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if from == to {
+		return ErrSamePocket
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if err := a.checkActive(); err != nil {
+		return err
+	}
+
+	var source, destination *Pocket
+	var err error
+	if from != "" {
+		if source, err = a.pocketLocked(from); err != nil {
+			return err
+		}
+	}
+	if to != "" {
+		if destination, err = a.pocketLocked(to); err != nil {
+			return err
+		}
+	}
+
+	// Moving out of the main balance may use credits not yet consolidated
+	if source == nil {
+		a.consolidateLocked()
+		if a.availableLocked() < amount {
+			return ErrInsufficientFunds
+		}
+	} else if source.Balance < amount {
+		return ErrInsufficientFunds
+	}
+
+	if source != nil {
+		source.Balance -= amount
+	}
+	if destination != nil {
+		destination.Balance += amount
+	}
+	return nil
+}
+
+// spendableLocked returns what a transfer may debit: the named pocket if it
+// allows direct debits, or else the main balance. The caller must hold the
+// account lock.
+func (a *Account) spendableLocked(pocket string) (float64, error) {
+	if pocket == "" {
+		return a.availableLocked(), nil
+	}
+
+	p, err := a.pocketLocked(pocket)
+	if err != nil {
+		return 0, err
+	}
+	if !p.DirectDebit {
+		return 0, ErrPocketLocked
+	}
+	return p.Balance, nil
+}
+
+// debitLocked takes the amount from the balance and, if named, the pocket.
+// The caller must hold the account lock and have checked spendableLocked.
+func (a *Account) debitLocked(amount float64, pocket string) {
+	if p, err := a.pocketLocked(pocket); err == nil {
+		p.Balance -= amount
+	}
+	a.Balance -= amount
+}
+
+// holdLocked reserves the amount for a transfer awaiting approval, taking it
+// out of the named pocket if any. The caller must hold the account lock.
+func (a *Account) holdLocked(amount float64, pocket string) {
+	if p, err := a.pocketLocked(pocket); err == nil {
+		p.Balance -= amount
+	}
+	a.held += amount
+}
+
+// unholdLocked returns held funds to the pocket they were taken from, or to
+// the main balance if it no longer exists. The caller must hold the account
+// lock.
+func (a *Account) unholdLocked(amount float64, pocket string) {
+	a.held -= amount
+	if p, err := a.pocketLocked(pocket); err == nil {
+		p.Balance += amount
+	}
+}
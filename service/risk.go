@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTransferBlocked is returned for transfers the risk engine refuses
+var ErrTransferBlocked = errors.New("transfer blocked by risk checks")
+
+// RiskDecision is what the risk engine decided for a transfer
+type RiskDecision string
+
+// Risk decisions
+const (
+	RiskAllow RiskDecision = "allow"
+	// RiskReview sends the transfer to the approval queue
+	RiskReview RiskDecision = "review"
+	RiskBlock  RiskDecision = "block"
+)
+
+// RuleHit is a risk rule that matched a transfer
+type RuleHit struct {
+	Rule   string `json:"rule"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// RiskAssessment is the risk engine's verdict on a transfer
+type RiskAssessment struct {
+	Score    int          `json:"score"`
+	Decision RiskDecision `json:"decision"`
+	Rules    []RuleHit    `json:"rules,omitempty"`
+}
+
+// RiskEngine scores transfers before money moves
+type RiskEngine interface {
+	// Assess scores a transfer that is about to execute or be held
+	Assess(ctx context.Context, req TransferRequest) RiskAssessment
+
+	// Record adds a completed transfer to the history the rules look at
+	Record(ctx context.Context, req TransferRequest)
+}
+
+// WithRiskEngine scores every new transfer. Transfers the engine sends to
+// review need approval, so they are blocked unless approvals are enabled.
+// Approved transfers are not scored again.
+func WithRiskEngine(engine RiskEngine) Option {
+	return func(ts *TransferService) {
+		ts.risk = engine
+	}
+}
+
+// assess scores a transfer, returning nil if no risk engine is configured
+func (ts *TransferService) assess(ctx context.Context, req TransferRequest) *RiskAssessment {
+	if ts.risk == nil {
+		return nil
+	}
+
+	_, span := ts.tracer.Start(ctx, "RiskEngine.Assess")
+	defer span.End()
+
+	assessment := ts.risk.Assess(ctx, req)
+	span.SetAttribute("risk.score", assessment.Score)
+	span.SetAttribute("risk.decision", string(assessment.Decision))
+
+	// Review needs someone to review; without approvals it fails closed
+	if assessment.Decision == RiskReview && ts.approvals == nil {
+		assessment.Decision = RiskBlock
+	}
+	return &assessment
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// Screening errors
+var (
+	ErrSanctioned       = errors.New("party matches a sanctions watchlist entry")
+	ErrScreeningPending = errors.New("party is awaiting sanctions screening review")
+)
+
+// Screener checks transfer parties against a sanctions watchlist
+type Screener interface {
+	// Screen returns ErrSanctioned for a party that matches the watchlist and
+	// ErrScreeningPending for a potential match, which it queues for review
+	Screen(ctx context.Context, party string) error
+}
+
+// WithScreener screens both parties of every transfer, including approved
+// ones, since the watchlist may have matched while they were pending
+func WithScreener(screener Screener) Option {
+	return func(ts *TransferService) {
+		ts.screener = screener
+	}
+}
+
+// screen checks both parties of a transfer
+func (ts *TransferService) screen(ctx context.Context, req TransferRequest) error {
+	if ts.screener == nil {
+		return nil
+	}
+
+	_, span := ts.tracer.Start(ctx, "Screener.Screen")
+	defer span.End()
+
+	for _, party := range []string{req.From, req.To} {
+		if err := ts.screener.Screen(ctx, party); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+	return nil
+}
@@ -1,13 +1,74 @@
 package service
 
+import "context"
+
 // AccountManager defines the interface for account management operations
 type AccountManager interface {
 	// GetAccount retrieves an account by username
 	GetAccount(username string) (*Account, error)
-	
+
+	// GetAccountByID retrieves an account by its immutable ID
+	GetAccountByID(id string) (*Account, error)
+
 	// ListAccounts returns all accounts
 	ListAccounts() []*Account
-	
+
 	// CreateAccount creates a new account with the given username and initial balance
 	CreateAccount(username string, initialBalance float64) (*Account, error)
-} 
\ No newline at end of file
+}
+
+// ContextAccountCreator is implemented by account managers that record who
+// created an account, such as an audited account manager
+type ContextAccountCreator interface {
+	// CreateAccountContext creates an account on behalf of the actor in ctx
+	CreateAccountContext(ctx context.Context, username string, initialBalance float64) (*Account, error)
+}
+
+// ProfileManager is implemented by account managers that check or record
+// the holder's profile, such as a screening account manager
+type ProfileManager interface {
+	// CreateAccountWithProfile creates an account for the holder on behalf
+	// of the actor in ctx
+	CreateAccountWithProfile(ctx context.Context, username string, initialBalance float64, profile Profile) (*Account, error)
+
+	// UpdateProfile replaces the holder's profile on behalf of the actor in
+	// ctx
+	UpdateProfile(ctx context.Context, account *Account, profile Profile) error
+}
+
+// CreateAccountWithProfile creates an account with the holder's profile
+// through the most capable interface accountManager implements
+func CreateAccountWithProfile(ctx context.Context, accountManager AccountManager, username string, initialBalance float64, profile Profile) (*Account, error) {
+	if manager, ok := accountManager.(ProfileManager); ok {
+		return manager.CreateAccountWithProfile(ctx, username, initialBalance, profile)
+	}
+
+	var account *Account
+	var err error
+	if creator, ok := accountManager.(ContextAccountCreator); ok {
+		account, err = creator.CreateAccountContext(ctx, username, initialBalance)
+	} else {
+		account, err = accountManager.CreateAccount(username, initialBalance)
+	}
+	if err != nil {
+		return nil, err
+	}
+	account.SetProfile(profile)
+	return account, nil
+}
+
+// UpdateProfile replaces the holder's profile through accountManager if it
+// checks or records profiles
+func UpdateProfile(ctx context.Context, accountManager AccountManager, account *Account, profile Profile) error {
+	if manager, ok := accountManager.(ProfileManager); ok {
+		return manager.UpdateProfile(ctx, account, profile)
+	}
+	account.SetProfile(profile)
+	return nil
+}
+
+// Auditor records state-changing actions in an audit trail. The actor and
+// request ID are taken from ctx.
+type Auditor interface {
+	Audit(ctx context.Context, action string, details map[string]interface{})
+}
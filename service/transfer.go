@@ -1,15 +1,30 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"money-transfer-system/tracing"
 )
 
+// ErrShuttingDown is returned for transfers submitted while the service drains
+var ErrShuttingDown = errors.New("service is shutting down")
+
 // TransferResult represents the result of a transfer operation
 type TransferResult struct {
 	Success bool     `json:"success"`
 	Message string   `json:"message"`
 	From    *Account `json:"from,omitempty"`
 	To      *Account `json:"to,omitempty"`
+	// ApprovalID is set when the transfer is held for approval
+	ApprovalID string `json:"approval_id,omitempty"`
+	// Risk is the risk engine's assessment, if one is configured
+	Risk *RiskAssessment `json:"risk,omitempty"`
 }
 
 // TransferRequest represents a request to transfer money between accounts
@@ -17,23 +32,127 @@ type TransferRequest struct {
 	From   string  `json:"from"`
 	To     string  `json:"to"`
 	Amount float64 `json:"amount"`
+	// FromPocket debits a pocket of the source account that allows direct
+	// debits instead of its main balance
+	FromPocket string `json:"from_pocket,omitempty"`
+
+	// escrow is set on transfers funding an escrow, the only transfers the
+	// escrow account may receive
+	escrow bool
 }
 
 // TransferService handles money transfers between accounts
 type TransferService struct {
 	accountManager AccountManager
+	observer       TransferObserver
+	logger         *slog.Logger
+	tracer         *tracing.Tracer
+	approvals      *approvalQueue
+	auditor        Auditor
+	risk           RiskEngine
+	screener       Screener
+	escrows        *escrowBook
+
+	// inFlight counts running transfers without a shared lock; drained is
+	// closed once draining has started and the count reaches zero
+	inFlight    atomic.Int64
+	draining    atomic.Bool
+	drained     chan struct{}
+	drainedOnce sync.Once
 }
 
 // NewTransferService creates a new transfer service with the provided account manager
-func NewTransferService(accountManager AccountManager) *TransferService {
-	return &TransferService{
+func NewTransferService(accountManager AccountManager, opts ...Option) *TransferService {
+	ts := &TransferService{
 		accountManager: accountManager,
+		observer:       nopObserver{},
+		drained:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(ts)
 	}
+
+	return ts
 }
 
 // Transfer performs a money transfer between two accounts
 // To prevent deadlocks, locks are acquired in a consistent order (alphabetically by username)
 func (ts *TransferService) Transfer(req TransferRequest) (*TransferResult, error) {
+	return ts.TransferContext(context.Background(), req)
+}
+
+// TransferContext performs a transfer on behalf of the request carried by ctx,
+// so that service logs can be correlated with the originating request
+func (ts *TransferService) TransferContext(ctx context.Context, req TransferRequest) (*TransferResult, error) {
+	return ts.run(ctx, req, nil)
+}
+
+// run performs a transfer and records its span, metrics and log line. The
+// parties may be given by account ID.
+func (ts *TransferService) run(ctx context.Context, req TransferRequest, hold *heldFunds) (*TransferResult, error) {
+	req.From, req.To = ts.username(req.From), ts.username(req.To)
+
+	ctx, span := ts.tracer.Start(ctx, "TransferService.Transfer")
+	defer span.End()
+
+	start := time.Now()
+	result, err := ts.transfer(ctx, req, hold)
+	duration := time.Since(start)
+	outcome := ErrorCode(err)
+
+	span.SetAttribute("transfer.from", req.From)
+	span.SetAttribute("transfer.to", req.To)
+	span.SetAttribute("transfer.amount", req.Amount)
+	span.SetAttribute("transfer.outcome", outcome)
+	span.RecordError(err)
+
+	ts.observer.TransferCompleted(outcome, duration)
+
+	// Record transfers that moved or held money, and those refused by risk
+	// or screening checks
+	details := map[string]interface{}{"from": req.From, "to": req.To, "amount": req.Amount}
+	if result != nil && result.Risk != nil {
+		details["risk"] = result.Risk
+	}
+	switch {
+	case err == nil:
+		ts.audit(ctx, "transfer.completed", details)
+	case errors.Is(err, ErrApprovalRequired), errors.Is(err, ErrSignaturesRequired):
+		details["approval_id"] = result.ApprovalID
+		ts.audit(ctx, "transfer.held", details)
+	case errors.Is(err, ErrTransferBlocked), errors.Is(err, ErrSanctioned), errors.Is(err, ErrScreeningPending):
+		details["reason"] = outcome
+		ts.audit(ctx, "transfer.blocked", details)
+	}
+
+	if ts.logger != nil {
+		level := slog.LevelInfo
+		if err != nil {
+			level = slog.LevelWarn
+		}
+		ts.logger.LogAttrs(ctx, level, "transfer processed",
+			slog.String("request_id", RequestIDFromContext(ctx)),
+			slog.String("from", req.From),
+			slog.String("to", req.To),
+			slog.Float64("amount", req.Amount),
+			slog.String("outcome", outcome),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+		)
+	}
+
+	return result, err
+}
+
+// transfer performs the transfer. ctx carries tracing state and the actor;
+// hold is set when executing an approved transfer whose funds are held.
+func (ts *TransferService) transfer(ctx context.Context, req TransferRequest, hold *heldFunds) (*TransferResult, error) {
+	// Refuse new work once draining has started
+	if !ts.begin() {
+		return &TransferResult{Success: false, Message: ErrShuttingDown.Error()}, ErrShuttingDown
+	}
+	defer ts.end()
+
 	// Validate request
 	if req.Amount <= 0 {
 		return &TransferResult{Success: false, Message: ErrInvalidAmount.Error()}, ErrInvalidAmount
@@ -44,41 +163,146 @@ func (ts *TransferService) Transfer(req TransferRequest) (*TransferResult, error
 		return &TransferResult{Success: false, Message: ErrSameAccount.Error()}, ErrSameAccount
 	}
 
+	// Escrowed money enters the escrow account only by funding an escrow and
+	// leaves it only when an escrow settles
+	if ts.IsEscrowAccount(req.From) || (ts.IsEscrowAccount(req.To) && !req.escrow) {
+		return &TransferResult{Success: false, Message: ErrEscrowAccount.Error()}, ErrEscrowAccount
+	}
+
 	// Get accounts
-	fromAccount, err := ts.accountManager.GetAccount(req.From)
+	fromAccount, err := ts.getAccount(ctx, req.From)
 	if err != nil {
 		return &TransferResult{Success: false, Message: "Source account not found"}, err
 	}
 
-	toAccount, err := ts.accountManager.GetAccount(req.To)
+	toAccount, err := ts.getAccount(ctx, req.To)
 	if err != nil {
 		return &TransferResult{Success: false, Message: "Destination account not found"}, err
 	}
 
-	// To prevent deadlocks, always acquire locks in the same order (by username alphabetically)
-	first, second := fromAccount, toAccount
-	if strings.Compare(fromAccount.Username, toAccount.Username) > 0 {
-		first, second = toAccount, fromAccount
+	// Both accounts must hold the same currency
+	if !sameCurrency(fromAccount, toAccount) {
+		return &TransferResult{Success: false, Message: ErrCurrencyMismatch.Error()}, ErrCurrencyMismatch
+	}
+
+	// Refuse transfers to or from listed parties
+	if err := ts.screen(ctx, req); err != nil {
+		return &TransferResult{Success: false, Message: err.Error()}, err
+	}
+
+	// Score new transfers before taking any locks; approved ones were reviewed
+	var assessment *RiskAssessment
+	if hold == nil {
+		assessment = ts.assess(ctx, req)
+	}
+	if assessment != nil && assessment.Decision == RiskBlock {
+		return &TransferResult{Success: false, Message: ErrTransferBlocked.Error(), Risk: assessment}, ErrTransferBlocked
+	}
+
+	// Credits to a hot account go to one of its sub-balances, so only the
+	// source account needs its mutex. Stripe locks are always taken last.
+	if toAccount.IsHot() {
+		ts.lock(ctx, fromAccount)
+		defer fromAccount.Unlock()
+	} else {
+		// To prevent deadlocks, always acquire locks in the same order (by username alphabetically)
+		first, second := fromAccount, toAccount
+		if strings.Compare(fromAccount.Username, toAccount.Username) > 0 {
+			first, second = toAccount, fromAccount
+		}
+
+		// Acquire locks in order
+		ts.lock(ctx, first)
+		defer first.Unlock()
+
+		ts.lock(ctx, second)
+		defer second.Unlock()
+	}
+
+	// An approved transfer spends the funds held for it, which go back where
+	// they came from to be debited as usual
+	if hold != nil {
+		fromAccount.unholdLocked(hold.amount, req.FromPocket)
+		hold.released = true
+	}
+
+	// Frozen or closed accounts can neither send nor receive
+	for _, account := range []*Account{fromAccount, toAccount} {
+		if err := account.checkActive(); err != nil {
+			return &TransferResult{Success: false, Message: err.Error()}, err
+		}
 	}
 
-	// Acquire locks in order
-	first.Lock()
-	defer first.Unlock()
-	
-	second.Lock()
-	defer second.Unlock()
+	// Enforce the source account's per-transfer limit
+	if limit := fromAccount.Limits.MaxTransfer; limit > 0 && req.Amount > limit {
+		return &TransferResult{Success: false, Message: ErrLimitExceeded.Error()}, ErrLimitExceeded
+	}
+
+	// Fold any hot sub-balances into the source before checking funds
+	fromAccount.consolidateLocked()
 
-	// Check if source has sufficient funds
-	if fromAccount.Balance < req.Amount {
+	// Check if source has sufficient funds that are neither held nor
+	// earmarked, or enough in the pocket it debits
+	spendable, err := fromAccount.spendableLocked(req.FromPocket)
+	if err != nil {
+		return &TransferResult{Success: false, Message: err.Error()}, err
+	}
+	if spendable < req.Amount {
 		return &TransferResult{
 			Success: false,
 			Message: ErrInsufficientFunds.Error(),
 		}, ErrInsufficientFunds
 	}
 
+	// Large or risky transfers wait for a second person, and transfers from
+	// joint accounts for enough owners to sign; the funds are held meanwhile
+	if hold == nil {
+		pending := &Approval{Request: req, Maker: ActorFromContext(ctx)}
+		if assessment != nil && assessment.Decision == RiskReview {
+			pending.Risk = assessment
+		}
+		pending.CheckerRequired = pending.Risk != nil || ts.approvals.required(req.Amount)
+
+		// The owner submitting a transfer signs it
+		if signing := fromAccount.signingLocked(); signing != nil {
+			pending.RequiredSignatures = signing.Required(req.Amount)
+			if signing.IsOwner(pending.Maker) {
+				pending.Signers = []string{pending.Maker}
+			}
+		}
+		unsigned := len(pending.Signers) < pending.RequiredSignatures
+
+		if unsigned && ts.approvals == nil {
+			return &TransferResult{Success: false, Message: ErrSigningUnavailable.Error()}, ErrSigningUnavailable
+		}
+		if pending.CheckerRequired || unsigned {
+			err := ErrApprovalRequired
+			if unsigned {
+				err = ErrSignaturesRequired
+			}
+			fromAccount.holdLocked(req.Amount, req.FromPocket)
+			approval := ts.approvals.submit(pending, time.Now())
+			return &TransferResult{
+				Success:    false,
+				Message:    err.Error(),
+				ApprovalID: approval.ID,
+				Risk:       assessment,
+			}, err
+		}
+	}
+
 	// Perform transfer (no need to use Deposit/Withdraw as we already have the locks)
-	fromAccount.Balance -= req.Amount
-	toAccount.Balance += req.Amount
+	fromAccount.debitLocked(req.Amount, req.FromPocket)
+	if toAccount.IsHot() {
+		toAccount.credit(req.Amount)
+	} else {
+		toAccount.Balance += req.Amount
+	}
+
+	// Let history-based risk rules see the transfer
+	if ts.risk != nil {
+		ts.risk.Record(ctx, req)
+	}
 
 	// Prepare success result
 	result := &TransferResult{
@@ -86,7 +310,93 @@ func (ts *TransferService) Transfer(req TransferRequest) (*TransferResult, error
 		Message: "Transfer completed successfully",
 		From:    fromAccount,
 		To:      toAccount,
+		Risk:    assessment,
 	}
 
 	return result, nil
-} 
\ No newline at end of file
+}
+
+// audit records an action if an auditor is configured
+func (ts *TransferService) audit(ctx context.Context, action string, details map[string]interface{}) {
+	if ts.auditor != nil {
+		ts.auditor.Audit(ctx, action, details)
+	}
+}
+
+// getAccount looks up an account inside its own trace span
+func (ts *TransferService) getAccount(ctx context.Context, username string) (*Account, error) {
+	_, span := ts.tracer.Start(ctx, "AccountManager.GetAccount")
+	defer span.End()
+
+	span.SetAttribute("account.username", username)
+	account, err := ts.accountManager.GetAccount(username)
+	span.RecordError(err)
+
+	return account, err
+}
+
+// username returns the username of the account ref identifies by ID, or
+// ref itself, so the rest of a transfer works with usernames
+func (ts *TransferService) username(ref string) string {
+	if !IsAccountID(ref) {
+		return ref
+	}
+	if account, err := ts.accountManager.GetAccountByID(ref); err == nil {
+		return account.Username
+	}
+	return ref
+}
+
+// lock acquires the account lock and reports how long it waited
+func (ts *TransferService) lock(ctx context.Context, account *Account) {
+	_, span := ts.tracer.Start(ctx, "Account.Lock")
+	defer span.End()
+
+	start := time.Now()
+	account.Lock()
+	wait := time.Since(start)
+
+	ts.observer.LockAcquired(account.tier(), wait)
+	span.SetAttribute("account.username", account.Username)
+	span.SetAttribute("account.tier", account.tier())
+	span.SetAttribute("lock.wait_ms", float64(wait.Microseconds())/1000)
+}
+
+// begin registers an in-flight transfer, or reports false if draining
+func (ts *TransferService) begin() bool {
+	// Count first so that Drain either sees this transfer or we see it
+	ts.inFlight.Add(1)
+	if ts.draining.Load() {
+		ts.end()
+		return false
+	}
+	return true
+}
+
+// end marks an in-flight transfer as finished
+func (ts *TransferService) end() {
+	if ts.inFlight.Add(-1) == 0 && ts.draining.Load() {
+		ts.drainedOnce.Do(func() { close(ts.drained) })
+	}
+}
+
+// Drain stops the service from accepting new transfers and waits until all
+// in-flight transfers have finished or the context is done
+func (ts *TransferService) Drain(ctx context.Context) error {
+	ts.draining.Store(true)
+	if ts.inFlight.Load() == 0 {
+		ts.drainedOnce.Do(func() { close(ts.drained) })
+	}
+
+	select {
+	case <-ts.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Draining reports whether Drain has been called
+func (ts *TransferService) Draining() bool {
+	return ts.draining.Load()
+}
@@ -0,0 +1,326 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"money-transfer-system/service"
+)
+
+// AccountFixture describes an account created at startup
+type AccountFixture struct {
+	Username   string                `json:"username"`
+	Balance    float64               `json:"balance"`
+	Currency   string                `json:"currency,omitempty"`
+	Status     service.AccountStatus `json:"status,omitempty"`
+	Limits     service.Limits        `json:"limits"`
+	HotStripes int                   `json:"hot_stripes,omitempty"`
+
+	DisplayName string              `json:"display_name,omitempty"`
+	Type        service.AccountType `json:"type,omitempty"`
+	Contact     service.Contact     `json:"contact"`
+
+	// Signing makes the account joint; it can only be set in JSON fixtures
+	Signing *service.SigningPolicy `json:"signing,omitempty"`
+
+	// line is the line in the fixture file where the account is defined
+	line int
+}
+
+// FixtureError reports a problem with one entry of a fixture file
+type FixtureError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e FixtureError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// FixtureErrors lists every problem found in a fixture file
+type FixtureErrors []FixtureError
+
+func (e FixtureErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// csvColumns are the columns accepted in CSV fixtures
+var csvColumns = map[string]bool{
+	"username": true, "balance": true, "currency": true,
+	"status": true, "max_transfer": true, "hot_stripes": true,
+	"display_name": true, "type": true, "email": true, "phone": true,
+}
+
+// LoadFixtureFile reads and validates accounts from a JSON or CSV fixture.
+// JSON fixtures are an array of account objects; CSV fixtures need a header
+// row naming the columns. All validation errors are reported together.
+func LoadFixtureFile(path string) ([]AccountFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []AccountFixture
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		fixtures, err = parseJSONFixture(path, data)
+	case ".csv":
+		fixtures, err = parseCSVFixture(path, data)
+	default:
+		return nil, fmt.Errorf("unsupported fixture file extension %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if errs := validateFixtures(path, fixtures); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return fixtures, nil
+}
+
+// lineAt returns the 1-based line number of the byte offset
+func lineAt(data []byte, offset int64) int {
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// parseJSONFixture decodes the array one element at a time so each account
+// can be tagged with the line it starts on
+func parseJSONFixture(path string, data []byte) ([]AccountFixture, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+		return nil, FixtureError{path, 1, "expected a JSON array of accounts"}
+	}
+
+	var fixtures []AccountFixture
+	for decoder.More() {
+		// Skip the separator so the offset points at the element itself
+		offset := decoder.InputOffset()
+		for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+			offset++
+		}
+		line := lineAt(data, offset)
+
+		var fixture AccountFixture
+		if err := decoder.Decode(&fixture); err != nil {
+			return nil, FixtureError{path, line, err.Error()}
+		}
+		fixture.line = line
+		fixtures = append(fixtures, fixture)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, FixtureError{path, lineAt(data, decoder.InputOffset()), err.Error()}
+	}
+
+	return fixtures, nil
+}
+
+// parseCSVFixture reads accounts from CSV with a header row
+func parseCSVFixture(path string, data []byte) ([]AccountFixture, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, FixtureError{path, 1, "missing header row"}
+	}
+	for _, column := range header {
+		if !csvColumns[column] {
+			return nil, FixtureError{path, 1, fmt.Sprintf("unknown column %q", column)}
+		}
+	}
+
+	var fixtures []AccountFixture
+	var errs FixtureErrors
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, FixtureError{path, lineAt(data, reader.InputOffset()), err.Error()}
+		}
+
+		line, _ := reader.FieldPos(0)
+		fixture := AccountFixture{line: line}
+		for i, column := range header {
+			if err := setCSVField(&fixture, column, strings.TrimSpace(record[i])); err != nil {
+				errs = append(errs, FixtureError{path, line, err.Error()})
+			}
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return fixtures, nil
+}
+
+// setCSVField parses a single CSV cell into the fixture
+func setCSVField(fixture *AccountFixture, column, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	var err error
+	switch column {
+	case "username":
+		fixture.Username = value
+	case "balance":
+		fixture.Balance, err = strconv.ParseFloat(value, 64)
+	case "currency":
+		fixture.Currency = value
+	case "status":
+		fixture.Status = service.AccountStatus(value)
+	case "max_transfer":
+		fixture.Limits.MaxTransfer, err = strconv.ParseFloat(value, 64)
+	case "hot_stripes":
+		fixture.HotStripes, err = strconv.Atoi(value)
+	case "display_name":
+		fixture.DisplayName = value
+	case "type":
+		fixture.Type = service.AccountType(value)
+	case "email":
+		fixture.Contact.Email = value
+	case "phone":
+		fixture.Contact.Phone = value
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", column, value)
+	}
+	return nil
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateFixtures checks every account and reports all problems
+func validateFixtures(path string, fixtures []AccountFixture) FixtureErrors {
+	var errs FixtureErrors
+	seen := make(map[string]int)
+
+	for _, f := range fixtures {
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, FixtureError{path, f.line, fmt.Sprintf(format, args...)})
+		}
+
+		if f.Username == "" {
+			fail("username is required")
+		} else if service.IsAccountID(f.Username) {
+			fail("username %q must not start with %q", f.Username, service.AccountIDPrefix)
+		} else if !service.ValidUsername(f.Username) {
+			fail("username %q must be 1 to %d letters, digits, dots, underscores or hyphens, starting with a letter or digit", f.Username, service.MaxUsernameLength)
+		} else if first, dup := seen[f.Username]; dup {
+			fail("duplicate username %q (first defined on line %d)", f.Username, first)
+		} else {
+			seen[f.Username] = f.line
+		}
+
+		if f.Balance < 0 || math.IsInf(f.Balance, 0) || math.IsNaN(f.Balance) {
+			fail("balance must be a non-negative number")
+		}
+
+		if f.Currency != "" && !isCurrencyCode(f.Currency) {
+			fail("currency %q must be a three-letter ISO 4217 code", f.Currency)
+		}
+
+		if f.Status != "" && !f.Status.Valid() {
+			fail("unknown status %q", f.Status)
+		}
+
+		if f.Limits.MaxTransfer < 0 {
+			fail("max_transfer cannot be negative")
+		}
+
+		if f.HotStripes < 0 {
+			fail("hot_stripes cannot be negative")
+		}
+
+		if f.Type != "" && !f.Type.Valid() {
+			fail("unknown account type %q", f.Type)
+		}
+
+		if !service.ValidDisplayName(f.DisplayName) {
+			fail("display_name must be at most %d printable characters", service.MaxDisplayNameLength)
+		}
+		if f.Contact.Email != "" && !service.ValidEmail(f.Contact.Email) {
+			fail("email %q must be an email address", f.Contact.Email)
+		}
+		if f.Contact.Phone != "" && !service.ValidPhone(f.Contact.Phone) {
+			fail("phone %q must be an E.164 number such as +14155550123", f.Contact.Phone)
+		}
+
+		if f.Signing != nil {
+			if err := f.Signing.Validate(); err != nil {
+				fail("signing: %v", err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// Seed creates the given accounts in the account manager, with their
+// holders' profiles so that a screening manager checks them like any other
+// new holder
+func Seed(accountManager service.AccountManager, fixtures []AccountFixture) error {
+	for _, f := range fixtures {
+		profile := service.Profile{DisplayName: f.DisplayName, Type: f.Type, Contact: f.Contact}
+		if profile.Type == "" {
+			profile.Type = service.TypePersonal
+		}
+
+		account, err := service.CreateAccountWithProfile(context.Background(), accountManager, f.Username, f.Balance, profile)
+		if err != nil {
+			return fmt.Errorf("seeding account %q: %w", f.Username, err)
+		}
+
+		account.Lock()
+		account.Currency = f.Currency
+		account.Limits = f.Limits
+		account.Signing = f.Signing
+		account.Unlock()
+
+		// An account frozen by screening stays frozen until its hit is
+		// reviewed
+		if f.Status != "" && !(f.Status == service.StatusActive && account.Status() == service.StatusFrozen) {
+			account.SetStatus(f.Status)
+		}
+
+		if f.HotStripes > 0 {
+			account.EnableHotCredits(f.HotStripes)
+		}
+	}
+
+	return nil
+}
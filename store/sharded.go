@@ -0,0 +1,132 @@
+package store
+
+import (
+	"sync"
+
+	"money-transfer-system/service"
+)
+
+// DefaultShardCount is the number of shards used when none is specified
+const DefaultShardCount = 64
+
+// shard is a single lock-striped partition of the account map
+type shard struct {
+	mutex    sync.RWMutex
+	accounts map[string]*service.Account
+}
+
+// ShardedStore is an in-memory account store that partitions accounts across
+// independently locked shards. Operations on usernames that hash to different
+// shards never contend, so account creation does not block unrelated lookups.
+type ShardedStore struct {
+	shards []*shard
+	// ids indexes accounts by their immutable ID; IDs are written once, so
+	// a sync.Map keeps ID lookups off the shard locks
+	ids sync.Map
+}
+
+// NewShardedStore creates a sharded store with the given number of shards.
+// A non-positive shard count falls back to DefaultShardCount.
+func NewShardedStore(shardCount int) *ShardedStore {
+	if shardCount <= 0 {
+		shardCount = DefaultShardCount
+	}
+
+	shards := make([]*shard, shardCount)
+	for i := range shards {
+		shards[i] = &shard{accounts: make(map[string]*service.Account)}
+	}
+
+	return &ShardedStore{shards: shards}
+}
+
+// ShardCount returns the number of shards in the store
+func (s *ShardedStore) ShardCount() int {
+	return len(s.shards)
+}
+
+// shardFor returns the shard responsible for the given username.
+// FNV-1a is computed inline to avoid allocating a hasher per lookup.
+func (s *ShardedStore) shardFor(username string) *shard {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	hash := uint32(offset32)
+	for i := 0; i < len(username); i++ {
+		hash ^= uint32(username[i])
+		hash *= prime32
+	}
+
+	return s.shards[hash%uint32(len(s.shards))]
+}
+
+// GetAccount retrieves an account by username
+func (s *ShardedStore) GetAccount(username string) (*service.Account, error) {
+	sh := s.shardFor(username)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	account, exists := sh.accounts[username]
+	if !exists {
+		return nil, service.ErrAccountNotFound
+	}
+
+	return account, nil
+}
+
+// GetAccountByID retrieves an account by ID
+func (s *ShardedStore) GetAccountByID(id string) (*service.Account, error) {
+	account, exists := s.ids.Load(id)
+	if !exists {
+		return nil, service.ErrAccountNotFound
+	}
+
+	return account.(*service.Account), nil
+}
+
+// ListAccounts returns all accounts. Each shard is read under its own lock,
+// so the result is not a single atomic snapshot across shards.
+func (s *ShardedStore) ListAccounts() []*service.Account {
+	accounts := make([]*service.Account, 0, s.Len())
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for _, acc := range sh.accounts {
+			accounts = append(accounts, acc)
+		}
+		sh.mutex.RUnlock()
+	}
+
+	return accounts
+}
+
+// CreateAccount creates a new account with the given username and initial balance
+func (s *ShardedStore) CreateAccount(username string, initialBalance float64) (*service.Account, error) {
+	sh := s.shardFor(username)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	// Check if account already exists
+	if _, exists := sh.accounts[username]; exists {
+		return nil, service.ErrAccountExists
+	}
+
+	account := service.NewAccount(username, initialBalance)
+	sh.accounts[username] = account
+	s.ids.Store(account.ID, account)
+
+	return account, nil
+}
+
+// Len returns the total number of accounts across all shards
+func (s *ShardedStore) Len() int {
+	total := 0
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		total += len(sh.accounts)
+		sh.mutex.RUnlock()
+	}
+
+	return total
+}
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"errors"
 	"sync"
 
 	"money-transfer-system/service"
@@ -10,13 +9,16 @@ import (
 // InMemoryStore represents an in-memory implementation of the account store
 type InMemoryStore struct {
 	accounts map[string]*service.Account
-	mutex    sync.RWMutex
+	// byID indexes the same accounts by their immutable ID
+	byID  map[string]*service.Account
+	mutex sync.RWMutex
 }
 
 // NewInMemoryStore creates a new in-memory store
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
 		accounts: make(map[string]*service.Account),
+		byID:     make(map[string]*service.Account),
 	}
 }
 
@@ -33,6 +35,19 @@ func (s *InMemoryStore) GetAccount(username string) (*service.Account, error) {
 	return account, nil
 }
 
+// GetAccountByID retrieves an account by ID
+func (s *InMemoryStore) GetAccountByID(id string) (*service.Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	account, exists := s.byID[id]
+	if !exists {
+		return nil, service.ErrAccountNotFound
+	}
+
+	return account, nil
+}
+
 // ListAccounts returns all accounts
 func (s *InMemoryStore) ListAccounts() []*service.Account {
 	s.mutex.RLock()
@@ -53,19 +68,13 @@ func (s *InMemoryStore) CreateAccount(username string, initialBalance float64) (
 
 	// Check if account already exists
 	if _, exists := s.accounts[username]; exists {
-		return nil, errors.New("account already exists")
+		return nil, service.ErrAccountExists
 	}
 
 	// Create new account
 	account := service.NewAccount(username, initialBalance)
 	s.accounts[username] = account
+	s.byID[account.ID] = account
 
 	return account, nil
 }
-
-// Setup initializes the store with default accounts
-func (s *InMemoryStore) Setup() {
-	s.CreateAccount("Mark", 100)
-	s.CreateAccount("Jane", 50)
-	s.CreateAccount("Adam", 0)
-} 
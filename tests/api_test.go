@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"money-transfer-system/api"
+	"money-transfer-system/auth"
 	"money-transfer-system/service"
 	"money-transfer-system/store"
 )
@@ -174,3 +175,48 @@ func TestTransferInsufficientFunds(t *testing.T) {
 		t.Errorf("Expected error message '%v', got '%v'", service.ErrInsufficientFunds.Error(), result.Message)
 	}
 } 
+
+func TestCreateAccountHandler(t *testing.T) {
+	// Setup
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+
+	// Create a new account
+	rr := doAuth(router, "POST", "/accounts", admin, `{"username": "Eve", "balance": 20}`)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %v", rr.Code)
+	}
+
+	var account service.Account
+	if err := json.Unmarshal(rr.Body.Bytes(), &account); err != nil {
+		t.Errorf("Failed to parse response: %v", err)
+	}
+
+	if account.Username != "Eve" || account.Balance != 20 {
+		t.Errorf("Expected Eve with balance 20, got %v with %v", account.Username, account.Balance)
+	}
+
+	// Creating it again conflicts
+	rr = doAuth(router, "POST", "/accounts", admin, `{"username": "Eve"}`)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %v", rr.Code)
+	}
+
+	var errResp api.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil {
+		t.Errorf("Failed to parse response: %v", err)
+	}
+
+	if errResp.Error.Code != "account_exists" {
+		t.Errorf("Expected error code account_exists, got %v", errResp.Error.Code)
+	}
+
+	// Without authentication anyone could open accounts, so the route is
+	// not registered
+	unauthenticated := api.NewAPI(service.NewTransferService(store.NewInMemoryStore()), store.NewInMemoryStore(), api.WithAccountCreation(true))
+	if rr := doAuth(unauthenticated.SetupRoutes(), "POST", "/accounts", "", `{"username": "Eve"}`); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected no account creation without authentication, got %v", rr.Code)
+	}
+}
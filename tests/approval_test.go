@@ -0,0 +1,294 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// setupApprovals creates a service that holds transfers above 100
+func setupApprovals(deadline time.Duration) (*service.TransferService, *store.InMemoryStore) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 500)
+	accountStore.CreateAccount("Jane", 50)
+
+	return service.NewTransferService(accountStore, service.WithApprovals(100, deadline)), accountStore
+}
+
+// as returns a context acting on behalf of the actor
+func as(actor string) context.Context {
+	return service.ContextWithActor(context.Background(), actor)
+}
+
+// balances returns the balance and held amount of an account
+func balances(t *testing.T, accountStore service.AccountManager, username string) (float64, float64) {
+	t.Helper()
+
+	account, err := accountStore.GetAccount(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account.GetBalance(), account.Held()
+}
+
+func TestApprovalHoldsAndExecutes(t *testing.T) {
+	transferService, accountStore := setupApprovals(time.Hour)
+
+	// Small transfers go straight through
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 50}); err != nil {
+		t.Fatalf("Expected a transfer below the threshold to execute, got %v", err)
+	}
+
+	result, err := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 200})
+	if !errors.Is(err, service.ErrApprovalRequired) || result.ApprovalID == "" {
+		t.Fatalf("Expected the transfer to await approval, got %v (%+v)", err, result)
+	}
+
+	// The funds are held but not moved
+	if balance, held := balances(t, accountStore, "Mark"); balance != 450 || held != 200 {
+		t.Errorf("Expected Mark to have 450 with 200 held, got %v with %v held", balance, held)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 99}); err != nil {
+			t.Errorf("Expected unheld funds to remain available, got %v", err)
+		}
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 99}); !errors.Is(err, service.ErrInsufficientFunds) {
+		t.Errorf("Expected held funds to be unavailable, got %v", err)
+	}
+
+	// The submitter cannot approve their own transfer
+	if _, _, err := transferService.Approve(as("alice"), result.ApprovalID, ""); !errors.Is(err, service.ErrSelfApproval) {
+		t.Errorf("Expected self-approval to be refused, got %v", err)
+	}
+	// Nor can an anonymous caller, who might be the submitter
+	if _, _, err := transferService.Approve(context.Background(), result.ApprovalID, ""); !errors.Is(err, service.ErrCheckerRequired) {
+		t.Errorf("Expected an approval without a checker to be refused, got %v", err)
+	}
+
+	_, approval, err := transferService.Approve(as("bob"), result.ApprovalID, "invoice checked")
+	if err != nil {
+		t.Fatalf("Expected approval to execute the transfer, got %v", err)
+	}
+	if approval.Status != service.ApprovalApproved || approval.Maker != "alice" || approval.Checker != "bob" {
+		t.Errorf("Unexpected approval %+v", approval)
+	}
+	if balance, held := balances(t, accountStore, "Mark"); balance != 52 || held != 0 {
+		t.Errorf("Expected Mark to have 52 with nothing held, got %v with %v held", balance, held)
+	}
+	if balance, _ := balances(t, accountStore, "Jane"); balance != 498 {
+		t.Errorf("Expected Jane to have 498, got %v", balance)
+	}
+
+	// The trail records every step, and the decision is final
+	var actions []string
+	for _, event := range approval.Trail {
+		actions = append(actions, event.Action)
+	}
+	if len(actions) != 3 || actions[0] != "submitted" || actions[1] != "approved" || actions[2] != "executed" {
+		t.Errorf("Unexpected trail %v", actions)
+	}
+	if _, _, err := transferService.Approve(as("carol"), result.ApprovalID, ""); !errors.Is(err, service.ErrApprovalClosed) {
+		t.Errorf("Expected a second approval to be refused, got %v", err)
+	}
+}
+
+func TestApprovalRejectReleasesHold(t *testing.T) {
+	transferService, accountStore := setupApprovals(time.Hour)
+
+	result, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 300})
+
+	if _, err := transferService.Reject(as("bob"), result.ApprovalID, ""); !errors.Is(err, service.ErrReasonRequired) {
+		t.Errorf("Expected rejection without a reason to be refused, got %v", err)
+	}
+
+	approval, err := transferService.Reject(as("bob"), result.ApprovalID, "unknown payee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approval.Status != service.ApprovalRejected || approval.Trail[1].Reason != "unknown payee" {
+		t.Errorf("Unexpected approval %+v", approval)
+	}
+	if balance, held := balances(t, accountStore, "Mark"); balance != 500 || held != 0 {
+		t.Errorf("Expected Mark's hold to be released, got %v with %v held", balance, held)
+	}
+}
+
+func TestApprovalExpiry(t *testing.T) {
+	transferService, accountStore := setupApprovals(time.Millisecond)
+
+	result, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 300})
+	time.Sleep(5 * time.Millisecond)
+
+	if n := transferService.ExpireApprovals(); n != 1 {
+		t.Errorf("Expected 1 approval to expire, got %d", n)
+	}
+	if _, held := balances(t, accountStore, "Mark"); held != 0 {
+		t.Errorf("Expected the hold to be released on expiry, got %v held", held)
+	}
+	if _, _, err := transferService.Approve(as("bob"), result.ApprovalID, ""); !errors.Is(err, service.ErrApprovalExpired) {
+		t.Errorf("Expected approval after the deadline to be refused, got %v", err)
+	}
+}
+
+func TestApprovalFailsWhenAccountFrozen(t *testing.T) {
+	transferService, accountStore := setupApprovals(time.Hour)
+
+	result, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 300})
+	mark, _ := accountStore.GetAccount("Mark")
+	mark.SetStatus(service.StatusFrozen)
+
+	_, approval, err := transferService.Approve(as("bob"), result.ApprovalID, "")
+	if !errors.Is(err, service.ErrAccountFrozen) {
+		t.Fatalf("Expected the approved transfer to fail, got %v", err)
+	}
+	if approval.Status != service.ApprovalFailed {
+		t.Errorf("Expected status failed, got %s", approval.Status)
+	}
+	if balance, held := balances(t, accountStore, "Mark"); balance != 500 || held != 0 {
+		t.Errorf("Expected Mark's funds to be released, got %v with %v held", balance, held)
+	}
+}
+
+func TestConcurrentApprovalsExecuteOnce(t *testing.T) {
+	transferService, accountStore := setupApprovals(time.Hour)
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		result, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 101})
+		ids = append(ids, result.ApprovalID)
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		for _, checker := range []string{"bob", "carol", "dave"} {
+			wg.Add(1)
+			go func(id, checker string) {
+				defer wg.Done()
+				transferService.Approve(as(checker), id, "")
+			}(id, checker)
+		}
+	}
+	wg.Wait()
+
+	if balance, held := balances(t, accountStore, "Mark"); balance != 96 || held != 0 {
+		t.Errorf("Expected each approval to execute exactly once, Mark has %v with %v held", balance, held)
+	}
+	if balance, _ := balances(t, accountStore, "Jane"); balance != 454 {
+		t.Errorf("Expected Jane to have 454, got %v", balance)
+	}
+}
+
+func TestApprovalAPI(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 500)
+	accountStore.CreateAccount("Jane", 50)
+
+	keys := auth.NewKeyStore()
+	customer, _, _ := keys.Issue(auth.Key{ID: "mark", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Mark"}})
+	other, _, _ := keys.Issue(auth.Key{ID: "jane", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Jane"}})
+	treasury, _, _ := keys.Issue(auth.Key{ID: "treasurer", Roles: []auth.Role{auth.RoleTreasury}})
+
+	transferService := service.NewTransferService(accountStore, service.WithApprovals(100, time.Hour))
+	router := api.NewAPI(transferService, accountStore, api.WithKeyStore(keys)).SetupRoutes()
+
+	rr := doAuth(router, "POST", "/transfer", customer, `{"from": "Mark", "to": "Jane", "amount": 250}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var result service.TransferResult
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if rr.Header().Get("Location") != "/approvals/"+result.ApprovalID {
+		t.Errorf("Expected Location header for approval %s, got %q", result.ApprovalID, rr.Header().Get("Location"))
+	}
+
+	// Customers see the approvals of their own accounts but cannot decide them
+	var own []service.Approval
+	json.Unmarshal(doAuth(router, "GET", "/approvals", customer, "").Body.Bytes(), &own)
+	if len(own) != 1 || own[0].ID != result.ApprovalID {
+		t.Errorf("Expected the customer to see their approval, got %+v", own)
+	}
+	if rr := doAuth(router, "GET", "/approvals/"+result.ApprovalID, customer, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 reading their approval, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "GET", "/approvals", other, ""); rr.Code != http.StatusOK || rr.Body.String() != "[]\n" {
+		t.Errorf("Expected another customer to see no approvals, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "GET", "/approvals/"+result.ApprovalID, other, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 reading someone else's approval, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", "/approvals/"+result.ApprovalID+"/approve", customer, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 approving as a customer, got %v", rr.Code)
+	}
+
+	var pending []service.Approval
+	json.Unmarshal(doAuth(router, "GET", "/approvals?status=pending", treasury, "").Body.Bytes(), &pending)
+	if len(pending) != 1 || pending[0].ID != result.ApprovalID || pending[0].Maker != "mark" {
+		t.Fatalf("Expected one pending approval from mark, got %+v", pending)
+	}
+
+	rr = doAuth(router, "POST", "/approvals/"+result.ApprovalID+"/approve", treasury, `{"reason": "verified by phone", "reson": "typo"}`)
+	if rr.Code != http.StatusBadRequest || fieldCodes(t, rr.Body.Bytes())["reson"] != "unknown_field" {
+		t.Errorf("Expected an unknown decision field to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAuth(router, "POST", "/approvals/"+result.ApprovalID+"/approve", treasury, `{"reason": "verified by phone"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var decision api.DecisionResponse
+	json.Unmarshal(rr.Body.Bytes(), &decision)
+	if decision.Result == nil || !decision.Result.Success || decision.Approval.Checker != "treasurer" {
+		t.Errorf("Unexpected decision %+v", decision)
+	}
+
+	rr = doAuth(router, "POST", "/approvals/"+result.ApprovalID+"/reject", treasury, `{"reason": "too late"}`)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != "approval_closed" {
+		t.Errorf("Expected status 409 approval_closed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "GET", "/approvals/apr_missing", treasury, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %v", rr.Code)
+	}
+}
+
+func TestApprovalsRetireOldDecisions(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 1000)
+	accountStore.CreateAccount("Jane", 0)
+	transferService := service.NewTransferService(accountStore, service.WithApprovals(0, time.Hour))
+
+	var first, last string
+	for i := 0; i <= service.MaxDecidedApprovals+service.MaxDecidedApprovals/4; i++ {
+		result, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 1})
+		if _, err := transferService.Reject(as("bob"), result.ApprovalID, "no"); err != nil {
+			t.Fatal(err)
+		}
+		if first == "" {
+			first = result.ApprovalID
+		}
+		last = result.ApprovalID
+	}
+	pending, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Mark", To: "Jane", Amount: 1})
+
+	if approvals := transferService.Approvals(""); len(approvals) != service.MaxDecidedApprovals+1 {
+		t.Errorf("Expected %d decided approvals and one pending, got %d", service.MaxDecidedApprovals, len(approvals))
+	}
+	if _, err := transferService.Approval(first); !errors.Is(err, service.ErrApprovalNotFound) {
+		t.Errorf("Expected the oldest decision to be retired, got %v", err)
+	}
+	if _, err := transferService.Approval(last); err != nil {
+		t.Errorf("Expected the latest decision to be kept, got %v", err)
+	}
+	if approvals := transferService.Approvals(service.ApprovalPending); len(approvals) != 1 || approvals[0].ID != pending.ApprovalID {
+		t.Errorf("Expected only the new approval to be pending, got %d", len(approvals))
+	}
+}
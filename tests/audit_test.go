@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/audit"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// writeAuditLog appends n records to a new log and returns its lines
+func writeAuditLog(t *testing.T, n int) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	auditLog := audit.NewLog(&buf)
+	for i := 0; i < n; i++ {
+		if _, err := auditLog.Append("test.action", "alice", "", map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// verifyLines verifies a log made of the given lines
+func verifyLines(lines []string, anchors ...string) (audit.Result, error) {
+	return audit.Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), anchors...)
+}
+
+// auditActions returns the actions recorded in a log
+func auditActions(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record audit.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, record.Action)
+	}
+	return actions
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	lines := writeAuditLog(t, 5)
+
+	result, err := verifyLines(lines)
+	if err != nil {
+		t.Fatalf("Expected an untouched log to verify, got %v", err)
+	}
+	if result.Records != 5 || result.Head == "" {
+		t.Errorf("Expected 5 records and a head hash, got %+v", result)
+	}
+}
+
+func TestAuditDetectsTampering(t *testing.T) {
+	lines := writeAuditLog(t, 5)
+
+	edited := append([]string(nil), lines...)
+	edited[2] = strings.Replace(edited[2], `"n":2`, `"n":20`, 1)
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"edited", edited, "edited"},
+		{"deleted", append(append([]string(nil), lines[:2]...), lines[3:]...), "deleted"},
+		{"reordered", []string{lines[0], lines[2], lines[1], lines[3], lines[4]}, "deleted"},
+		{"duplicated", append(append([]string(nil), lines...), lines[4]), "reordered or duplicated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyLines(tt.lines)
+			var verifyErr *audit.VerifyError
+			if !errors.As(err, &verifyErr) || !strings.Contains(verifyErr.Reason, tt.want) {
+				t.Fatalf("Expected a verification error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestAuditAnchorDetectsTruncation(t *testing.T) {
+	lines := writeAuditLog(t, 4)
+	head, err := verifyLines(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifyLines(lines, head.Head); err != nil {
+		t.Errorf("Expected the anchored head to be found, got %v", err)
+	}
+	if _, err := verifyLines(lines[:3], head.Head); !errors.Is(err, audit.ErrAnchorNotFound) {
+		t.Errorf("Expected a truncated log to miss the anchor, got %v", err)
+	}
+}
+
+func TestAuditOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog.Append("first", "", "", nil)
+	auditLog.Close()
+
+	auditLog, err = audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := auditLog.Append("second", "", "", nil)
+	auditLog.Close()
+	if record.Seq != 2 {
+		t.Errorf("Expected the reopened log to continue at seq 2, got %d", record.Seq)
+	}
+
+	result, err := audit.VerifyFile(path)
+	if err != nil || result.Records != 2 {
+		t.Fatalf("Expected 2 verified records, got %+v, %v", result, err)
+	}
+
+	// A tampered log is not reopened
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(data, []byte("first"), []byte("First"), 1), 0o600)
+	if _, err := audit.Open(path); err == nil {
+		t.Error("Expected a tampered log to be refused")
+	}
+}
+
+func TestAuditRecordsActions(t *testing.T) {
+	var buf bytes.Buffer
+	auditLog := audit.NewLog(&buf)
+
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 500)
+	keys := auth.NewKeyStore()
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+
+	transferService := service.NewTransferService(accountStore, service.WithAuditor(auditLog), service.WithApprovals(100, time.Hour))
+	router := api.NewAPI(transferService, audit.NewAccountManager(accountStore, auditLog),
+		api.WithKeyStore(keys), api.WithAuditor(auditLog), api.WithAccountCreation(true)).SetupRoutes()
+
+	requests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/accounts", `{"username":"Jane","balance":10}`, http.StatusCreated},
+		{"POST", "/transfer", `{"from":"Mark","to":"Jane","amount":50}`, http.StatusOK},
+		{"POST", "/transfer", `{"from":"Mark","to":"Jane","amount":999}`, http.StatusBadRequest},
+		{"POST", "/transfer", `{"from":"Mark","to":"Jane","amount":200}`, http.StatusAccepted},
+		{"POST", "/accounts/Jane/freeze", "", http.StatusOK},
+		{"PUT", "/accounts/Mark/limits", `{"max_transfer":10}`, http.StatusOK},
+		{"PUT", "/accounts/Jane/profile", `{"display_name":"Jane Doe"}`, http.StatusOK},
+		{"DELETE", "/admin/keys/admin", "", http.StatusNoContent},
+	}
+	for _, req := range requests {
+		if rr := doAuth(router, req.method, req.path, admin, req.body); rr.Code != req.status {
+			t.Fatalf("%s %s: expected %d, got %d: %s", req.method, req.path, req.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Failed transfers change no state and are not recorded
+	want := []string{"account.created", "transfer.completed", "transfer.held", "account.frozen", "account.limits_changed", "account.profile_changed", "key.revoked"}
+	if got := auditActions(t, buf.Bytes()); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected actions %v, got %v", want, got)
+	}
+
+	var record audit.Record
+	json.Unmarshal([]byte(strings.SplitN(buf.String(), "\n", 2)[0]), &record)
+	if record.Actor != "admin" || record.RequestID == "" {
+		t.Errorf("Expected the actor and request ID to be recorded, got %+v", record)
+	}
+
+	if _, err := audit.Verify(&buf); err != nil {
+		t.Errorf("Expected the recorded log to verify, got %v", err)
+	}
+}
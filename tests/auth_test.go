@@ -0,0 +1,259 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// setupAuthAPI creates a router that requires API keys from the returned store
+func setupAuthAPI(t *testing.T) (http.Handler, *auth.KeyStore) {
+	t.Helper()
+
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	keys := auth.NewKeyStore()
+	transferService := service.NewTransferService(accountStore)
+	router := api.NewAPI(transferService, accountStore, api.WithKeyStore(keys), api.WithAccountCreation(true)).SetupRoutes()
+	return router, keys
+}
+
+// createKey issues a key or fails the test
+func createKey(t *testing.T, keys *auth.KeyStore, id string, scopes ...auth.Scope) string {
+	t.Helper()
+
+	secret, _, err := keys.Create(id, scopes, nil)
+	if err != nil {
+		t.Fatalf("Failed to create key %s: %v", id, err)
+	}
+	return secret
+}
+
+// doAuth sends a request with the API key in the X-API-Key header
+func doAuth(router http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(api.APIKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// errorCode decodes the error envelope of a response
+func errorCode(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var resp api.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode error envelope %q: %v", rr.Body.String(), err)
+	}
+	return resp.Error.Code
+}
+
+func TestAuthRequiresKey(t *testing.T) {
+	router, _ := setupAuthAPI(t)
+
+	for _, key := range []string{"", "mts_not-a-real-key"} {
+		rr := doAuth(router, "POST", "/transfer", key, `{"from": "Mark", "to": "Jane", "amount": 10}`)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 for key %q, got %v", key, rr.Code)
+		}
+		if code := errorCode(t, rr); code != "unauthenticated" {
+			t.Errorf("Expected error code unauthenticated, got %s", code)
+		}
+		if rr.Header().Get("WWW-Authenticate") == "" {
+			t.Error("Expected a WWW-Authenticate header")
+		}
+	}
+
+	// Health checks stay open for load balancers and orchestrators
+	if rr := doAuth(router, "GET", "/healthz", "", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to be reachable without a key, got %v", rr.Code)
+	}
+}
+
+func TestAuthScopes(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	reader, _, _ := keys.Issue(auth.Key{ID: "reader", Scopes: []auth.Scope{auth.ScopeRead}, Accounts: []string{"Mark"}})
+	payer, _, _ := keys.Issue(auth.Key{ID: "payer", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeTransfer}, Accounts: []string{"Mark"}})
+
+	if rr := doAuth(router, "GET", "/accounts/Mark", reader, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected read key to read accounts, got %v", rr.Code)
+	}
+
+	rr := doAuth(router, "POST", "/transfer", reader, `{"from": "Mark", "to": "Jane", "amount": 10}`)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a read key, got %v", rr.Code)
+	}
+	if code := errorCode(t, rr); code != "forbidden" {
+		t.Errorf("Expected error code forbidden, got %s", code)
+	}
+
+	// Bearer credentials are accepted too
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"from": "Mark", "to": "Jane", "amount": 10}`))
+	req.Header.Set("Authorization", "Bearer "+payer)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected transfer key to transfer, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "POST", "/accounts", payer, `{"username": "Eve"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected account creation to require the admin scope, got %v", rr.Code)
+	}
+}
+
+func TestAuthKeyWithoutAccountsOwnsNone(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	customer, _, _ := keys.Issue(auth.Key{ID: "customer", Roles: []auth.Role{auth.RoleCustomer}})
+
+	if rr := doAuth(router, "POST", "/transfer", customer, `{"from": "Mark", "to": "Jane", "amount": 10}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a customer key without accounts to be refused, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "GET", "/accounts/Mark", customer, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a customer key without accounts to be unable to read, got %v", rr.Code)
+	}
+
+	if _, _, err := keys.Issue(auth.Key{ID: "wide", Roles: []auth.Role{auth.RoleCustomer}, AllAccounts: true}); err == nil {
+		t.Error("Expected all_accounts to be refused for a customer key")
+	}
+}
+
+func TestAuthAdminKeyManagement(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+
+	// Create a key over the API
+	rr := doAuth(router, "POST", "/admin/keys", admin, `{"id": "ci", "scopes": ["read"]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var created api.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.Secret == "" {
+		t.Fatal("Expected the new secret in the response")
+	}
+	if rr := doAuth(router, "GET", "/accounts", created.Secret, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected new key to work, got %v", rr.Code)
+	}
+
+	if rr := doAuth(router, "POST", "/admin/keys", admin, `{"id": "ci", "scopes": ["read"]}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate key, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", "/admin/keys", admin, `{"id": "bad", "scopes": ["root"]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown scope, got %v", rr.Code)
+	}
+
+	// Listing never exposes secrets
+	rr = doAuth(router, "GET", "/admin/keys", admin, "")
+	var listed []api.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &listed)
+	if len(listed) != 2 || listed[0].Secret != "" || listed[1].Secret != "" {
+		t.Errorf("Expected two keys without secrets, got %+v", listed)
+	}
+
+	// Revoke
+	if rr := doAuth(router, "DELETE", "/admin/keys/ci", admin, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "GET", "/accounts", created.Secret, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked key to be rejected, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "DELETE", "/admin/keys/ci", admin, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing key, got %v", rr.Code)
+	}
+}
+
+func TestAuthKeyRotationOverlap(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+	old := createKey(t, keys, "ci", auth.ScopeRead)
+
+	// During the overlap both secrets work
+	rr := doAuth(router, "POST", "/admin/keys/ci/rotate", admin, `{"overlap": "1h"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var rotated api.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &rotated)
+	if rotated.PreviousExpiresAt == nil {
+		t.Error("Expected the previous secret's expiry in the response")
+	}
+
+	for name, key := range map[string]string{"old": old, "new": rotated.Secret} {
+		if rr := doAuth(router, "GET", "/accounts", key, ""); rr.Code != http.StatusOK {
+			t.Errorf("Expected %s secret to work during the overlap, got %v", name, rr.Code)
+		}
+	}
+
+	// Rotating again without overlap cuts off everything but the newest secret
+	rr = doAuth(router, "POST", "/admin/keys/ci/rotate", admin, `{"overlap": "0s"}`)
+	var newest api.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &newest)
+
+	for name, key := range map[string]string{"old": old, "rotated": rotated.Secret} {
+		if rr := doAuth(router, "GET", "/accounts", key, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s secret to be rejected, got %v", name, rr.Code)
+		}
+	}
+	if rr := doAuth(router, "GET", "/accounts", newest.Secret, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected newest secret to work, got %v", rr.Code)
+	}
+}
+
+func TestAuthExpiredKey(t *testing.T) {
+	keys := auth.NewKeyStore()
+	past := time.Now().Add(-time.Minute)
+	secret, _, err := keys.Create("old", []auth.Scope{auth.ScopeRead}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keys.Authenticate(secret); err != auth.ErrUnauthenticated {
+		t.Errorf("Expected expired key to be rejected, got %v", err)
+	}
+}
+
+func TestKeyStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	keys, err := auth.OpenKeyStore(path)
+	if err != nil {
+		t.Fatalf("Expected a missing key file to give an empty store, got %v", err)
+	}
+	secret := createKey(t, keys, "ops", auth.ScopeRead, auth.ScopeTransfer)
+
+	reopened, err := auth.OpenKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := reopened.Authenticate(secret)
+	if err != nil {
+		t.Fatalf("Expected key to survive a reload, got %v", err)
+	}
+	if principal.ID != "ops" || !principal.HasScope(auth.ScopeTransfer) || principal.HasScope(auth.ScopeAdmin) {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	// Files with unknown scopes or malformed hashes are rejected
+	for _, content := range []string{
+		`[{"id": "x", "hash": "abc", "scopes": ["read"]}]`,
+		`[{"id": "x", "hash": "` + auth.HashKey("s") + `", "scopes": ["root"]}]`,
+	} {
+		if _, err := auth.OpenKeyStore(writeTempFile(t, "bad.json", content)); err == nil {
+			t.Errorf("Expected %s to be rejected", content)
+		}
+	}
+}
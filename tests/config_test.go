@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"money-transfer-system/config"
+)
+
+// writeTempFile writes content to a file with the given name in a temp dir
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// envFrom returns a LookupEnv function backed by a map
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	result, err := config.Load(config.Options{LookupEnv: envFrom(nil)})
+	if err != nil {
+		t.Fatalf("Expected defaults to load, got error: %v", err)
+	}
+
+	cfg := result.Config
+	if cfg.Server.Addr != ":8081" {
+		t.Errorf("Expected addr :8081, got %v", cfg.Server.Addr)
+	}
+
+	if time.Duration(cfg.Server.ReadTimeout) != 10*time.Second {
+		t.Errorf("Expected read timeout 10s, got %v", time.Duration(cfg.Server.ReadTimeout))
+	}
+
+	if cfg.Store.Backend != config.BackendMemory {
+		t.Errorf("Expected memory backend, got %v", cfg.Store.Backend)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeTempFile(t, "config.json", `{
+		"server": {"addr": ":9000", "read_timeout": "5s"},
+		"store": {"backend": "sharded", "shards": 8}
+	}`)
+
+	env := envFrom(map[string]string{
+		"MTS_CONFIG":       path,
+		"MTS_ADDR":         ":9001",
+		"MTS_STORE_SHARDS": "16",
+	})
+
+	result, err := config.Load(config.Options{
+		Args:      []string{"-addr", ":9002"},
+		LookupEnv: env,
+	})
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+
+	cfg := result.Config
+
+	// Flag beats environment beats file
+	if cfg.Server.Addr != ":9002" {
+		t.Errorf("Expected flag addr :9002, got %v", cfg.Server.Addr)
+	}
+
+	// Environment beats file
+	if cfg.Store.Shards != 16 {
+		t.Errorf("Expected env shards 16, got %v", cfg.Store.Shards)
+	}
+
+	// File beats defaults
+	if time.Duration(cfg.Server.ReadTimeout) != 5*time.Second {
+		t.Errorf("Expected file read timeout 5s, got %v", time.Duration(cfg.Server.ReadTimeout))
+	}
+
+	if cfg.Store.Backend != config.BackendSharded {
+		t.Errorf("Expected file backend sharded, got %v", cfg.Store.Backend)
+	}
+}
+
+func TestConfigYAMLFile(t *testing.T) {
+	path := writeTempFile(t, "config.yaml", `
+# Server settings
+server:
+  addr: "127.0.0.1:8443"
+  idle_timeout: 1m
+store:
+  backend: sharded   # lock-striped store
+  shards: 32
+features:
+  account_creation: true
+`)
+
+	result, err := config.Load(config.Options{Args: []string{"-config", path}, LookupEnv: envFrom(nil)})
+	if err != nil {
+		t.Fatalf("Expected YAML config to load, got error: %v", err)
+	}
+
+	cfg := result.Config
+	if cfg.Server.Addr != "127.0.0.1:8443" || cfg.Store.Shards != 32 || !cfg.Features.AccountCreation {
+		t.Errorf("YAML values not applied: %+v", cfg)
+	}
+
+	if time.Duration(cfg.Server.IdleTimeout) != time.Minute {
+		t.Errorf("Expected idle timeout 1m, got %v", time.Duration(cfg.Server.IdleTimeout))
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, err := config.Load(config.Options{
+		Args:      []string{"-addr", "nonsense", "-store-backend", "disk", "-read-timeout", "0s", "-tls-cert-file", "cert.pem", "-tracing-exporter", "file", "-ratelimit-transfer-rate", "5", "-ratelimit-transfer-burst", "0", "-screening-watchlist-file", "list.json", "-screening-review-threshold", "1.5", "-escrow-account", "escrow", "-escrow-timeout", "0s"},
+		LookupEnv: envFrom(nil),
+	})
+
+	verr, ok := err.(config.ValidationError)
+	if !ok {
+		t.Fatalf("Expected ValidationError, got: %v", err)
+	}
+
+	for _, want := range []string{"server.addr", "store.backend", "server.read_timeout", "tls.cert_file", "tracing.file", "rate_limit.transfer_burst", "screening.review_threshold", "escrow.timeout"} {
+		if !strings.Contains(verr.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, verr)
+		}
+	}
+}
+
+func TestConfigRejectsUnknownFileFields(t *testing.T) {
+	path := writeTempFile(t, "config.json", `{"server": {"port": 8080}}`)
+
+	if _, err := config.Load(config.Options{Args: []string{"-config", path}, LookupEnv: envFrom(nil)}); err == nil {
+		t.Errorf("Expected unknown field to be rejected")
+	}
+}
+
+func TestConfigPrintConfig(t *testing.T) {
+	result, err := config.Load(config.Options{Args: []string{"-print-config"}, LookupEnv: envFrom(nil)})
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+
+	if !result.PrintConfig {
+		t.Errorf("Expected PrintConfig to be set")
+	}
+
+	var out strings.Builder
+	result.Config.Print(&out)
+	if !strings.Contains(out.String(), `"read_timeout": "10s"`) {
+		t.Errorf("Expected durations to print as strings, got:\n%s", out.String())
+	}
+}
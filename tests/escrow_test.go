@@ -0,0 +1,273 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// setupEscrow creates a buyer with 1000, a seller and an empty escrow
+// account, and a service whose escrows time out after the timeout
+func setupEscrow(timeout time.Duration, opts ...service.Option) (*service.TransferService, *store.InMemoryStore) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Buyer", 1000)
+	accountStore.CreateAccount("Seller", 0)
+	accountStore.CreateAccount("escrow", 0)
+
+	opts = append(opts, service.WithEscrow("escrow", timeout))
+	return service.NewTransferService(accountStore, opts...), accountStore
+}
+
+// fundEscrow escrows 300 from Buyer to Seller with arbiter as the arbiter
+func fundEscrow(t *testing.T, transferService *service.TransferService) service.Escrow {
+	t.Helper()
+
+	_, escrow, err := transferService.CreateEscrow(as("buyer"), service.EscrowRequest{Payer: "Buyer", Payee: "Seller", Arbiter: "arbiter", Amount: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return escrow
+}
+
+func TestEscrowConfirmReleasesToPayee(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Hour)
+
+	escrow := fundEscrow(t, transferService)
+	if escrow.Status != service.EscrowFunded || escrow.Deadline.IsZero() {
+		t.Fatalf("Expected a funded escrow with a deadline, got %+v", escrow)
+	}
+	if balance, _ := balances(t, accountStore, "escrow"); balance != 300 {
+		t.Errorf("Expected 300 in the escrow account, got %v", balance)
+	}
+
+	// Escrowed money cannot leave or enter the escrow account by transfer
+	for _, req := range []service.TransferRequest{{From: "escrow", To: "Buyer", Amount: 300}, {From: "Buyer", To: "escrow", Amount: 10}} {
+		if _, err := transferService.Transfer(req); !errors.Is(err, service.ErrEscrowAccount) {
+			t.Errorf("%s to %s: expected ErrEscrowAccount, got %v", req.From, req.To, err)
+		}
+	}
+	router := api.NewAPI(transferService, accountStore).SetupRoutes()
+	if rr := doAuth(router, "POST", "/accounts/escrow/pockets", "", `{"name": "float"}`); rr.Code != http.StatusBadRequest || errorCode(t, rr) != "escrow_account" {
+		t.Errorf("Expected the escrow account to have no pockets, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	escrow, err := transferService.Confirm(as("buyer"), escrow.ID, "goods received")
+	if err != nil || escrow.Status != service.EscrowReleased || escrow.PaidToPayee != 300 {
+		t.Fatalf("Expected the escrow to be released, got %+v, %v", escrow, err)
+	}
+	if balance, _ := balances(t, accountStore, "Seller"); balance != 300 {
+		t.Errorf("Expected Seller to receive 300, got %v", balance)
+	}
+	if _, err := transferService.Cancel(as("seller"), escrow.ID, ""); !errors.Is(err, service.ErrEscrowState) {
+		t.Errorf("Expected a released escrow to be final, got %v", err)
+	}
+}
+
+func TestEscrowCancelRefundsPayer(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Hour)
+
+	escrow := fundEscrow(t, transferService)
+	if escrow, err := transferService.Cancel(as("seller"), escrow.ID, "out of stock"); err != nil || escrow.Status != service.EscrowRefunded {
+		t.Fatalf("Expected the escrow to be refunded, got %+v, %v", escrow, err)
+	}
+	if balance, _ := balances(t, accountStore, "Buyer"); balance != 1000 {
+		t.Errorf("Expected Buyer to get 1000 back, got %v", balance)
+	}
+}
+
+func TestEscrowDisputeSplitByArbiter(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Hour)
+
+	escrow := fundEscrow(t, transferService)
+	if _, err := transferService.Resolve(as("arbiter"), escrow.ID, 100, "early"); !errors.Is(err, service.ErrEscrowState) {
+		t.Errorf("Expected an undisputed escrow to refuse resolution, got %v", err)
+	}
+	if _, err := transferService.Dispute(as("buyer"), escrow.ID, "damaged"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := transferService.Resolve(as("buyer"), escrow.ID, 0, "mine"); !errors.Is(err, service.ErrNotArbiter) {
+		t.Errorf("Expected ErrNotArbiter, got %v", err)
+	}
+	if _, err := transferService.Resolve(as("arbiter"), escrow.ID, 301, "too much"); !errors.Is(err, service.ErrInvalidSplit) {
+		t.Errorf("Expected ErrInvalidSplit, got %v", err)
+	}
+
+	escrow, err := transferService.Resolve(as("arbiter"), escrow.ID, 100, "partly damaged")
+	if err != nil || escrow.Status != service.EscrowSplit || escrow.PaidToPayee != 100 || escrow.RefundedToPayer != 200 {
+		t.Fatalf("Expected a 100/200 split, got %+v, %v", escrow, err)
+	}
+	buyer, _ := balances(t, accountStore, "Buyer")
+	seller, _ := balances(t, accountStore, "Seller")
+	held, _ := balances(t, accountStore, "escrow")
+	if buyer != 900 || seller != 100 || held != 0 {
+		t.Errorf("Expected 900, 100 and 0, got %v, %v and %v", buyer, seller, held)
+	}
+}
+
+func TestEscrowFailedPayoutKeepsFunds(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Hour)
+
+	escrow := fundEscrow(t, transferService)
+	seller, _ := accountStore.GetAccount("Seller")
+	seller.SetStatus(service.StatusFrozen)
+
+	if _, err := transferService.Confirm(as("buyer"), escrow.ID, ""); !errors.Is(err, service.ErrAccountFrozen) {
+		t.Fatalf("Expected the frozen payee to refuse the payout, got %v", err)
+	}
+	if escrow, _ := transferService.Escrow(escrow.ID); escrow.Status != service.EscrowFunded {
+		t.Errorf("Expected the escrow to stay funded, got %q", escrow.Status)
+	}
+	if balance, _ := balances(t, accountStore, "escrow"); balance != 300 {
+		t.Errorf("Expected 300 to stay in escrow, got %v", balance)
+	}
+}
+
+func TestEscrowCurrencyMismatch(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Hour)
+	for _, username := range []string{"Buyer", "escrow"} {
+		account, _ := accountStore.GetAccount(username)
+		account.Currency = "USD"
+	}
+	seller, _ := accountStore.GetAccount("Seller")
+	seller.Currency = "EUR"
+
+	_, _, err := transferService.CreateEscrow(as("buyer"), service.EscrowRequest{Payer: "Buyer", Payee: "Seller", Arbiter: "arbiter", Amount: 300})
+	if !errors.Is(err, service.ErrCurrencyMismatch) {
+		t.Fatalf("Expected a payee in another currency to be refused, got %v", err)
+	}
+	if balance, _ := balances(t, accountStore, "Buyer"); balance != 1000 {
+		t.Errorf("Expected nothing to be escrowed, got %v left", balance)
+	}
+
+	// The payout checks again in case the currency changed after funding
+	seller.Currency = "USD"
+	escrow := fundEscrow(t, transferService)
+	seller.Lock()
+	seller.Currency = "EUR"
+	seller.Unlock()
+	if _, err := transferService.Confirm(as("buyer"), escrow.ID, ""); !errors.Is(err, service.ErrCurrencyMismatch) {
+		t.Fatalf("Expected the payout to be refused, got %v", err)
+	}
+	if balance, _ := balances(t, accountStore, "escrow"); balance != 300 {
+		t.Errorf("Expected 300 to stay in escrow, got %v", balance)
+	}
+}
+
+func TestEscrowTimeout(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Millisecond)
+
+	refunded := fundEscrow(t, transferService)
+	disputed := fundEscrow(t, transferService)
+	if _, err := transferService.Dispute(as("seller"), disputed.ID, "shipped"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if n := transferService.ExpireEscrows(); n != 1 {
+		t.Errorf("Expected one escrow to expire, got %d", n)
+	}
+	if escrow, _ := transferService.Escrow(refunded.ID); escrow.Status != service.EscrowExpired || escrow.RefundedToPayer != 300 {
+		t.Errorf("Expected the escrow to be refunded on expiry, got %+v", escrow)
+	}
+	if escrow, _ := transferService.Escrow(disputed.ID); escrow.Status != service.EscrowDisputed {
+		t.Errorf("Expected a disputed escrow not to expire, got %q", escrow.Status)
+	}
+	if balance, _ := balances(t, accountStore, "Buyer"); balance != 700 {
+		t.Errorf("Expected 700 after one refund, got %v", balance)
+	}
+}
+
+func TestEscrowFundedAfterApproval(t *testing.T) {
+	transferService, accountStore := setupEscrow(time.Hour, service.WithApprovals(100, time.Hour))
+
+	result, escrow, err := transferService.CreateEscrow(as("buyer"), service.EscrowRequest{Payer: "Buyer", Payee: "Seller", Arbiter: "arbiter", Amount: 300})
+	if err != nil || escrow.Status != service.EscrowPending || escrow.FundingApprovalID != result.ApprovalID {
+		t.Fatalf("Expected a pending escrow awaiting approval, got %+v, %v", escrow, err)
+	}
+	if _, err := transferService.Confirm(as("buyer"), escrow.ID, ""); !errors.Is(err, service.ErrEscrowState) {
+		t.Errorf("Expected a pending escrow to refuse release, got %v", err)
+	}
+
+	if _, _, err := transferService.Approve(as("checker"), result.ApprovalID, "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if escrow, _ := transferService.Escrow(escrow.ID); escrow.Status != service.EscrowFunded {
+		t.Errorf("Expected the escrow to be funded once approved, got %q", escrow.Status)
+	}
+
+	// A rejected funding transfer cancels its escrow
+	result, escrow, _ = transferService.CreateEscrow(as("buyer"), service.EscrowRequest{Payer: "Buyer", Payee: "Seller", Arbiter: "arbiter", Amount: 200})
+	transferService.Reject(as("checker"), result.ApprovalID, "no")
+	if escrow, _ := transferService.Escrow(escrow.ID); escrow.Status != service.EscrowCancelled {
+		t.Errorf("Expected the escrow to be cancelled, got %q", escrow.Status)
+	}
+	if balance, held := balances(t, accountStore, "Buyer"); balance != 700 || held != 0 {
+		t.Errorf("Expected 700 with nothing held, got %v with %v held", balance, held)
+	}
+}
+
+func TestEscrowAPI(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Buyer", 1000)
+	accountStore.CreateAccount("Seller", 0)
+	accountStore.CreateAccount("escrow", 0)
+
+	keys := auth.NewKeyStore()
+	buyer, _, _ := keys.Issue(auth.Key{ID: "buyer", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Buyer"}})
+	seller, _, _ := keys.Issue(auth.Key{ID: "seller", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Seller"}})
+	arbiter, _, _ := keys.Issue(auth.Key{ID: "arbiter", Roles: []auth.Role{auth.RoleCustomer}})
+
+	transferService := service.NewTransferService(accountStore, service.WithEscrow("escrow", time.Hour))
+	router := api.NewAPI(transferService, accountStore, api.WithKeyStore(keys)).SetupRoutes()
+
+	if rr := doAuth(router, "POST", "/escrows", seller, `{"payer": "Buyer", "payee": "Seller", "arbiter": "arbiter", "amount": 300}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected the payee to be unable to fund from the payer, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", "/escrows", buyer, `{"payer": "Buyer", "payee": "Seller", "amount": 300}`); rr.Code != http.StatusBadRequest || fieldCodes(t, rr.Body.Bytes())["arbiter"] != "required" {
+		t.Errorf("Expected the arbiter to be required, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := doAuth(router, "POST", "/escrows", buyer, `{"payer": "Buyer", "payee": "Seller", "arbiter": "arbiter", "amount": 300}`)
+	var created api.EscrowResponse
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != "/escrows/"+created.Escrow.ID {
+		t.Fatalf("Expected status 201 with the escrow location, got %v: %s", rr.Code, rr.Body.String())
+	}
+	path := "/escrows/" + created.Escrow.ID
+
+	if rr := doAuth(router, "GET", path, arbiter, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the arbiter to see the escrow, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", path+"/confirm", seller, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected the payee to be unable to confirm, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", path+"/dispute", seller, `{"reason": "buyer silent"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the payee to dispute, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", path+"/resolve", buyer, `{"payee_amount": 0, "reason": "mine"}`); rr.Code != http.StatusForbidden || errorCode(t, rr) != "not_arbiter" {
+		t.Errorf("Expected the payer to be unable to resolve, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", path+"/resolve", arbiter, `{"payee_amount": 300, "reason": "delivered"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the arbiter to resolve, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if balance, _ := balances(t, accountStore, "Seller"); balance != 300 {
+		t.Errorf("Expected Seller to receive 300, got %v", balance)
+	}
+
+	rr = doAuth(router, "GET", "/escrows?status=released", seller, "")
+	var escrows []service.Escrow
+	if json.Unmarshal(rr.Body.Bytes(), &escrows); len(escrows) != 1 {
+		t.Errorf("Expected one released escrow, got %s", rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", path+"/cancel", seller, ""); rr.Code != http.StatusConflict || errorCode(t, rr) != "invalid_escrow_state" {
+		t.Errorf("Expected status 409 for a settled escrow, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+func TestLoadJSONFixture(t *testing.T) {
+	path := writeTempFile(t, "accounts.json", `[
+  {"username": "Mark", "balance": 100, "currency": "USD"},
+  {"username": "Shop", "balance": 0, "currency": "USD", "hot_stripes": 4,
+   "limits": {"max_transfer": 500}},
+  {"username": "Old", "balance": 5, "status": "closed"}
+]`)
+
+	fixtures, err := store.LoadFixtureFile(path)
+	if err != nil {
+		t.Fatalf("Expected fixture to load, got error: %v", err)
+	}
+
+	accountStore := store.NewInMemoryStore()
+	if err := store.Seed(accountStore, fixtures); err != nil {
+		t.Fatalf("Expected fixtures to seed, got error: %v", err)
+	}
+
+	shop, _ := accountStore.GetAccount("Shop")
+	if !shop.IsHot() || shop.Currency != "USD" || shop.Limits.MaxTransfer != 500 {
+		t.Errorf("Fixture fields not applied to Shop: hot=%v currency=%v limits=%+v", shop.IsHot(), shop.Currency, shop.Limits)
+	}
+
+	old, _ := accountStore.GetAccount("Old")
+	if old.Status() != service.StatusClosed {
+		t.Errorf("Expected Old to be closed, got %v", old.Status())
+	}
+}
+
+func TestLoadCSVFixture(t *testing.T) {
+	path := writeTempFile(t, "accounts.csv", `username,balance,currency,status,max_transfer
+Mark,100,USD,,
+Jane,50,USD,frozen,20
+`)
+
+	fixtures, err := store.LoadFixtureFile(path)
+	if err != nil {
+		t.Fatalf("Expected fixture to load, got error: %v", err)
+	}
+
+	if len(fixtures) != 2 || fixtures[1].Status != service.StatusFrozen || fixtures[1].Limits.MaxTransfer != 20 {
+		t.Errorf("Unexpected fixtures: %+v", fixtures)
+	}
+}
+
+func TestFixtureValidationReportsLines(t *testing.T) {
+	path := writeTempFile(t, "accounts.json", `[
+  {"username": "Mark", "balance": 100},
+  {"username": "", "balance": 10},
+  {"username": "Mark", "balance": -1, "currency": "usd"}
+]`)
+
+	_, err := store.LoadFixtureFile(path)
+	errs, ok := err.(store.FixtureErrors)
+	if !ok {
+		t.Fatalf("Expected FixtureErrors, got: %v", err)
+	}
+
+	expected := []string{
+		"accounts.json:3: username is required",
+		"accounts.json:4: duplicate username",
+		"accounts.json:4: balance must be a non-negative number",
+		"accounts.json:4: currency",
+	}
+	for _, want := range expected {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("Expected error containing %q, got:\n%v", want, errs)
+		}
+	}
+
+	csvPath := writeTempFile(t, "accounts.csv", "username,balance\nMark,100\nJane,lots\n")
+	if _, err := store.LoadFixtureFile(csvPath); err == nil || !strings.Contains(err.Error(), "accounts.csv:3: invalid balance") {
+		t.Errorf("Expected CSV error on line 3, got: %v", err)
+	}
+}
+
+func TestTransferEnforcesFixtureRules(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	store.Seed(accountStore, []store.AccountFixture{
+		{Username: "Mark", Balance: 100, Currency: "USD", Limits: service.Limits{MaxTransfer: 30}},
+		{Username: "Jane", Balance: 50, Currency: "USD"},
+		{Username: "Hans", Balance: 50, Currency: "EUR"},
+		{Username: "Ice", Balance: 50, Currency: "USD", Status: service.StatusFrozen},
+	})
+	transferService := service.NewTransferService(accountStore)
+
+	cases := []struct {
+		req      service.TransferRequest
+		expected error
+	}{
+		{service.TransferRequest{From: "Mark", To: "Jane", Amount: 31}, service.ErrLimitExceeded},
+		{service.TransferRequest{From: "Jane", To: "Hans", Amount: 5}, service.ErrCurrencyMismatch},
+		{service.TransferRequest{From: "Jane", To: "Ice", Amount: 5}, service.ErrAccountFrozen},
+		{service.TransferRequest{From: "Ice", To: "Jane", Amount: 5}, service.ErrAccountFrozen},
+		{service.TransferRequest{From: "Mark", To: "Jane", Amount: 30}, nil},
+	}
+
+	for _, c := range cases {
+		if _, err := transferService.Transfer(c.req); err != c.expected {
+			t.Errorf("Transfer %+v: expected %v, got %v", c.req, c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/health"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// brokenManager fails every lookup, simulating an unavailable store
+type brokenManager struct {
+	service.AccountManager
+}
+
+func (m brokenManager) GetAccount(username string) (*service.Account, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func serveHealth(t *testing.T, router http.Handler, path string) (int, health.Report) {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", path, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var report health.Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse health report: %v", err)
+	}
+	return rr.Code, report
+}
+
+func TestHealthzDetectsStuckLocks(t *testing.T) {
+	// Setup
+	accountStore := store.NewInMemoryStore()
+	mark, _ := accountStore.CreateAccount("Mark", 100)
+	router := api.NewAPI(service.NewTransferService(accountStore), accountStore,
+		api.WithLivenessChecks(health.LockCheck(accountStore, 10*time.Millisecond))).SetupRoutes()
+
+	if code, _ := serveHealth(t, router, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected 200 with no locks held, got %v", code)
+	}
+
+	// Hold Mark's lock past the threshold
+	mark.Lock()
+	time.Sleep(20 * time.Millisecond)
+	code, report := serveHealth(t, router, "/healthz")
+	mark.Unlock()
+
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with a stuck lock, got %v", code)
+	}
+
+	if !strings.Contains(report.Checks["locks"], "Mark") {
+		t.Errorf("Expected locks check to name Mark, got %q", report.Checks["locks"])
+	}
+
+	if code, _ := serveHealth(t, router, "/healthz"); code != http.StatusOK || mark.LockHeldFor() != 0 {
+		t.Errorf("Expected 200 after unlock, got %v", code)
+	}
+}
+
+func TestReadyzChecksStore(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	transferService := service.NewTransferService(accountStore)
+
+	healthy := api.NewAPI(transferService, accountStore,
+		api.WithReadinessChecks(health.StoreCheck(accountStore))).SetupRoutes()
+	if code, report := serveHealth(t, healthy, "/readyz"); code != http.StatusOK || report.Checks["store"] != "ok" {
+		t.Errorf("Expected ready store, got %v %+v", code, report)
+	}
+
+	broken := api.NewAPI(transferService, accountStore,
+		api.WithReadinessChecks(health.StoreCheck(brokenManager{accountStore}))).SetupRoutes()
+	if code, report := serveHealth(t, broken, "/readyz"); code != http.StatusServiceUnavailable || report.Checks["store"] != "store unavailable" {
+		t.Errorf("Expected unavailable store, got %v %+v", code, report)
+	}
+}
+
+func TestWritableCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := health.WritableCheck("journal", filepath.Join(dir, "journal.log")).Run(context.Background()); err != nil {
+		t.Errorf("Expected writable directory, got: %v", err)
+	}
+
+	if err := health.WritableCheck("journal", filepath.Join(dir, "missing", "journal.log")).Run(context.Background()); err == nil {
+		t.Errorf("Expected missing directory to fail")
+	}
+}
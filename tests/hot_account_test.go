@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+func TestHotAccountConcurrentCredits(t *testing.T) {
+	// Setup
+	accountStore := store.NewInMemoryStore()
+	merchant, _ := accountStore.CreateAccount("Merchant", 0)
+	merchant.EnableHotCredits(8)
+
+	numCustomers := 50
+	for i := 0; i < numCustomers; i++ {
+		accountStore.CreateAccount(fmt.Sprintf("Customer%d", i), 100)
+	}
+
+	transferService := service.NewTransferService(accountStore)
+
+	// Every customer pays the merchant 10 times concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < numCustomers; i++ {
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				transferService.Transfer(service.TransferRequest{
+					From:   fmt.Sprintf("Customer%d", i),
+					To:     "Merchant",
+					Amount: 1,
+				})
+			}(i)
+		}
+	}
+	wg.Wait()
+
+	// The aggregate balance includes unconsolidated sub-balances
+	if merchant.GetBalance() != float64(numCustomers*10) {
+		t.Errorf("Expected merchant balance=%d, got %v", numCustomers*10, merchant.GetBalance())
+	}
+
+	// Consolidation moves everything into the main balance without changing the total
+	merchant.Consolidate()
+	if merchant.Balance != float64(numCustomers*10) || merchant.GetBalance() != float64(numCustomers*10) {
+		t.Errorf("Expected consolidated balance=%d, got %v", numCustomers*10, merchant.Balance)
+	}
+}
+
+func TestHotAccountDebitIsOverdraftSafe(t *testing.T) {
+	// Setup
+	accountStore := store.NewInMemoryStore()
+	merchant, _ := accountStore.CreateAccount("Merchant", 0)
+	merchant.EnableHotCredits(4)
+	accountStore.CreateAccount("Customer", 100)
+	accountStore.CreateAccount("Supplier", 0)
+
+	transferService := service.NewTransferService(accountStore)
+
+	// Credits land in sub-balances only
+	for i := 0; i < 5; i++ {
+		transferService.Transfer(service.TransferRequest{From: "Customer", To: "Merchant", Amount: 10})
+	}
+
+	// Concurrent debits of the unconsolidated credits must never overdraw
+	var wg sync.WaitGroup
+	wg.Add(20)
+	for i := 0; i < 20; i++ {
+		go func() {
+			defer wg.Done()
+			transferService.Transfer(service.TransferRequest{From: "Merchant", To: "Supplier", Amount: 5})
+		}()
+	}
+	wg.Wait()
+
+	supplier, _ := accountStore.GetAccount("Supplier")
+	if merchant.GetBalance() != 0 {
+		t.Errorf("Expected merchant balance=0, got %v", merchant.GetBalance())
+	}
+
+	if supplier.GetBalance() != 50 {
+		t.Errorf("Expected supplier balance=50, got %v", supplier.GetBalance())
+	}
+
+	// Withdrawing more than the aggregate balance fails
+	merchant.Deposit(10)
+	if err := merchant.Withdraw(20); err != service.ErrInsufficientFunds {
+		t.Errorf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+}
+
+func TestHotAccountJSONReportsAggregateBalance(t *testing.T) {
+	merchant := service.NewAccount("Merchant", 10)
+	merchant.EnableHotCredits(4)
+	merchant.Deposit(15)
+
+	data, err := json.Marshal(merchant)
+	if err != nil {
+		t.Fatalf("Failed to marshal account: %v", err)
+	}
+
+	var decoded service.Account
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to parse account: %v", err)
+	}
+
+	if decoded.Balance != 25 {
+		t.Errorf("Expected balance 25, got %v", decoded.Balance)
+	}
+}
+
+func BenchmarkHotAccountCredits(b *testing.B) {
+	for _, stripes := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("stripes=%d", stripes), func(b *testing.B) {
+			accountStore := store.NewInMemoryStore()
+			merchant, _ := accountStore.CreateAccount("Merchant", 0)
+			if stripes > 0 {
+				merchant.EnableHotCredits(stripes)
+			}
+			for i := 0; i < 64; i++ {
+				accountStore.CreateAccount(fmt.Sprintf("Customer%d", i), float64(b.N))
+			}
+			transferService := service.NewTransferService(accountStore)
+
+			var next int64
+			var mu sync.Mutex
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				mu.Lock()
+				from := fmt.Sprintf("Customer%d", next%64)
+				next++
+				mu.Unlock()
+
+				for pb.Next() {
+					transferService.Transfer(service.TransferRequest{From: from, To: "Merchant", Amount: 1})
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// setupJoint creates a service holding transfers above 1000 for a checker,
+// with a joint account owned by alice, bob and carol needing one signature
+// below 100 and two from 100
+func setupJoint() (*service.TransferService, *store.InMemoryStore) {
+	accountStore := store.NewInMemoryStore()
+	household, _ := accountStore.CreateAccount("Household", 5000)
+	accountStore.CreateAccount("Shop", 0)
+	household.SetSigningPolicy(&service.SigningPolicy{
+		Owners: []string{"alice", "bob", "carol"},
+		Rules:  []service.SigningRule{{MinAmount: 100, Signatures: 2}},
+	})
+
+	return service.NewTransferService(accountStore, service.WithApprovals(1000, time.Hour)), accountStore
+}
+
+func TestSigningPolicy(t *testing.T) {
+	policy := &service.SigningPolicy{
+		Owners: []string{"alice", "bob", "carol"},
+		Rules:  []service.SigningRule{{MinAmount: 100, Signatures: 2}, {MinAmount: 1000, Signatures: 3}},
+	}
+	for amount, want := range map[float64]int{50: 1, 100: 2, 999: 2, 1000: 3} {
+		if got := policy.Required(amount); got != want {
+			t.Errorf("Required(%v) = %d, expected %d", amount, got, want)
+		}
+	}
+
+	for _, bad := range []service.SigningPolicy{
+		{},
+		{Owners: []string{"alice", "alice"}},
+		{Owners: []string{"alice"}, Rules: []service.SigningRule{{MinAmount: 0, Signatures: 2}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", bad)
+		}
+	}
+}
+
+func TestJointOneSignatureExecutes(t *testing.T) {
+	transferService, _ := setupJoint()
+
+	if _, err := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Household", To: "Shop", Amount: 50}); err != nil {
+		t.Errorf("Expected an owner's small transfer to execute, got %v", err)
+	}
+}
+
+func TestJointPendingUntilSigned(t *testing.T) {
+	transferService, accountStore := setupJoint()
+
+	result, err := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Household", To: "Shop", Amount: 300})
+	if !errors.Is(err, service.ErrSignaturesRequired) || result.ApprovalID == "" {
+		t.Fatalf("Expected the transfer to await a second signature, got %v", err)
+	}
+	if balance, held := balances(t, accountStore, "Household"); balance != 5000 || held != 300 {
+		t.Errorf("Expected 300 held and nothing moved, got %v with %v held", balance, held)
+	}
+
+	// Checkers cannot stand in for owners, and owners sign once
+	if _, _, err := transferService.Approve(as("checker"), result.ApprovalID, "ok"); !errors.Is(err, service.ErrSignaturesRequired) {
+		t.Errorf("Expected approval without signatures to be refused, got %v", err)
+	}
+	if _, _, err := transferService.Sign(as("alice"), result.ApprovalID, ""); !errors.Is(err, service.ErrAlreadySigned) {
+		t.Errorf("Expected a second signature from alice to be refused, got %v", err)
+	}
+	if _, _, err := transferService.Sign(as("mallory"), result.ApprovalID, ""); !errors.Is(err, service.ErrNotSigner) {
+		t.Errorf("Expected a non-owner's signature to be refused, got %v", err)
+	}
+
+	transfer, approval, err := transferService.Sign(as("bob"), result.ApprovalID, "agreed")
+	if err != nil || transfer == nil || !transfer.Success {
+		t.Fatalf("Expected the second signature to execute the transfer, got %v", err)
+	}
+	if approval.Status != service.ApprovalApproved || len(approval.Signers) != 2 {
+		t.Errorf("Unexpected approval %+v", approval)
+	}
+	if balance, held := balances(t, accountStore, "Household"); balance != 4700 || held != 0 {
+		t.Errorf("Expected 4700 with nothing held, got %v with %v held", balance, held)
+	}
+}
+
+func TestJointLargeTransferNeedsChecker(t *testing.T) {
+	transferService, _ := setupJoint()
+
+	result, _ := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Household", To: "Shop", Amount: 2000})
+	transfer, approval, err := transferService.Sign(as("carol"), result.ApprovalID, "")
+	if err != nil || transfer != nil || approval.Status != service.ApprovalPending || !approval.CheckerRequired {
+		t.Fatalf("Expected the signed transfer to wait for a checker, got %+v, %v", approval, err)
+	}
+
+	if _, approval, err := transferService.Approve(as("checker"), result.ApprovalID, "reviewed"); err != nil || approval.Status != service.ApprovalApproved {
+		t.Errorf("Expected the checker to execute the transfer, got %v", err)
+	}
+}
+
+func TestJointNonOwnerNeedsAllSignatures(t *testing.T) {
+	transferService, _ := setupJoint()
+
+	// A treasury operator debiting the account contributes no signature
+	result, err := transferService.TransferContext(as("treasury"), service.TransferRequest{From: "Household", To: "Shop", Amount: 10})
+	if !errors.Is(err, service.ErrSignaturesRequired) {
+		t.Fatalf("Expected a non-owner's transfer to await a signature, got %v", err)
+	}
+	if transfer, _, err := transferService.Sign(as("bob"), result.ApprovalID, ""); err != nil || !transfer.Success {
+		t.Errorf("Expected one owner signature to execute the transfer, got %v", err)
+	}
+}
+
+func TestJointWithoutApprovalsIsRefused(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	household, _ := accountStore.CreateAccount("Household", 500)
+	accountStore.CreateAccount("Shop", 0)
+	household.SetSigningPolicy(&service.SigningPolicy{Owners: []string{"alice", "bob"}, Rules: []service.SigningRule{{MinAmount: 0, Signatures: 2}}})
+
+	transferService := service.NewTransferService(accountStore)
+	if _, err := transferService.TransferContext(as("alice"), service.TransferRequest{From: "Household", To: "Shop", Amount: 10}); !errors.Is(err, service.ErrSigningUnavailable) {
+		t.Errorf("Expected the transfer to be refused without approvals, got %v", err)
+	}
+}
+
+func TestJointAPI(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Household", 500)
+	accountStore.CreateAccount("Shop", 0)
+
+	keys := auth.NewKeyStore()
+	treasury, _, _ := keys.Issue(auth.Key{ID: "treasury", Roles: []auth.Role{auth.RoleTreasury}})
+	alice, _, _ := keys.Issue(auth.Key{ID: "alice", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Household"}})
+	bob, _, _ := keys.Issue(auth.Key{ID: "bob", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Household"}})
+	carol, _, _ := keys.Issue(auth.Key{ID: "carol", Roles: []auth.Role{auth.RoleCustomer}})
+
+	transferService := service.NewTransferService(accountStore, service.WithApprovals(1000, time.Hour))
+	router := api.NewAPI(transferService, accountStore, api.WithKeyStore(keys)).SetupRoutes()
+
+	if rr := doAuth(router, "PUT", "/accounts/Household/signing", treasury, `{"owners": ["alice"], "rules": [{"min_amount": 0, "signatures": 2}]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unsatisfiable policy to be rejected, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "PUT", "/accounts/Household/signing", treasury, `{"owners": ["alice", "bob", "carol"], "rules": [{"min_amount": 0, "signatures": 2}]}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the signing policy to be set, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := doAuth(router, "POST", "/transfer", alice, `{"from": "Household", "to": "Shop", "amount": 20}`)
+	var result service.TransferResult
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if rr.Code != http.StatusAccepted || rr.Header().Get("Location") != "/approvals/"+result.ApprovalID {
+		t.Fatalf("Expected status 202 with the approval location, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	// Joint owners see the transfers waiting for their signature, even
+	// without access to the account
+	var pending []service.Approval
+	json.Unmarshal(doAuth(router, "GET", "/approvals?status=pending", carol, "").Body.Bytes(), &pending)
+	if len(pending) != 1 || pending[0].ID != result.ApprovalID {
+		t.Errorf("Expected carol to see the transfer to sign, got %+v", pending)
+	}
+
+	path := "/approvals/" + result.ApprovalID + "/sign"
+	if rr := doAuth(router, "POST", path, treasury, ""); rr.Code != http.StatusForbidden || errorCode(t, rr) != "not_signer" {
+		t.Errorf("Expected a non-owner to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", path, bob, `{"reason": "fine"}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected bob's signature to execute the transfer, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if balance, _ := balances(t, accountStore, "Shop"); balance != 20 {
+		t.Errorf("Expected Shop to receive 20, got %v", balance)
+	}
+}
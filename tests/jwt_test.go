@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+// signJWT builds a token signed with an HMAC secret or RSA private key
+func signJWT(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+
+	segment := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// userClaims returns valid claims for a subject with the given scopes
+func userClaims(subject, scope string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   subject,
+		"scope": scope,
+		"iss":   "https://idp.example",
+		"aud":   "mts",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// hs256 signs claims with the test HMAC secret
+func hs256(t *testing.T, claims map[string]interface{}) string {
+	return signJWT(t, map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims, []byte(testHMACSecret))
+}
+
+// setupJWTAPI creates a router that accepts HS256 tokens with the test secret
+func setupJWTAPI(t *testing.T) http.Handler {
+	t.Helper()
+
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	verifier := auth.NewJWTVerifier("https://idp.example", "mts")
+	if err := verifier.LoadHMACKeyFile(writeTempFile(t, "hmac.key", testHMACSecret+"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	transferService := service.NewTransferService(accountStore)
+	return api.NewAPI(transferService, accountStore, api.WithJWTVerifier(verifier)).SetupRoutes()
+}
+
+// doBearer sends a request with a bearer token
+func doBearer(router http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestJWTOwnership(t *testing.T) {
+	router := setupJWTAPI(t)
+	mark := hs256(t, userClaims("Mark", "read transfer"))
+
+	// Mark can read and debit his own account
+	if rr := doBearer(router, "GET", "/accounts/Mark", mark, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected Mark to read his account, got %v", rr.Code)
+	}
+	if rr := doBearer(router, "POST", "/transfer", mark, `{"from": "Mark", "to": "Jane", "amount": 10}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected Mark to debit his account, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	// ...but not Jane's
+	if rr := doBearer(router, "GET", "/accounts/Jane", mark, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 reading Jane's account, got %v", rr.Code)
+	}
+	rr := doBearer(router, "POST", "/transfer", mark, `{"from": "Jane", "to": "Mark", "amount": 10}`)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 debiting Jane's account, got %v", rr.Code)
+	}
+	if code := errorCode(t, rr); code != "forbidden" {
+		t.Errorf("Expected error code forbidden, got %s", code)
+	}
+
+	// Listing only shows owned accounts
+	var accounts []map[string]interface{}
+	json.Unmarshal(doBearer(router, "GET", "/accounts", mark, "").Body.Bytes(), &accounts)
+	if len(accounts) != 1 || accounts[0]["username"] != "Mark" {
+		t.Errorf("Expected only Mark's account, got %v", accounts)
+	}
+}
+
+func TestJWTAdminSeesEverything(t *testing.T) {
+	router := setupJWTAPI(t)
+	admin := hs256(t, userClaims("ops", "admin"))
+
+	var accounts []map[string]interface{}
+	json.Unmarshal(doBearer(router, "GET", "/accounts", admin, "").Body.Bytes(), &accounts)
+	if len(accounts) != 2 {
+		t.Errorf("Expected admin to see both accounts, got %v", accounts)
+	}
+	if rr := doBearer(router, "POST", "/transfer", admin, `{"from": "Jane", "to": "Mark", "amount": 5}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected admin to debit any account, got %v", rr.Code)
+	}
+}
+
+func TestJWTRejectsInvalidTokens(t *testing.T) {
+	router := setupJWTAPI(t)
+
+	expired := userClaims("Mark", "read")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAudience := userClaims("Mark", "read")
+	wrongAudience["aud"] = []string{"other"}
+	noExpiry := userClaims("Mark", "read")
+	delete(noExpiry, "exp")
+
+	valid := hs256(t, userClaims("Mark", "read"))
+	parts := strings.Split(valid, ".")
+
+	tokens := map[string]string{
+		"expired":        hs256(t, expired),
+		"wrong audience": hs256(t, wrongAudience),
+		"no expiry":      hs256(t, noExpiry),
+		"wrong secret":   signJWT(t, map[string]interface{}{"alg": "HS256"}, userClaims("Mark", "read"), []byte("another secret of thirty-two bytes")),
+		"alg none":       signJWT(t, map[string]interface{}{"alg": "none"}, userClaims("Mark", "read"), []byte(testHMACSecret)),
+		"tampered":       parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"Jane","scope":"read","exp":9999999999}`)) + "." + parts[2],
+	}
+	for name, token := range tokens {
+		if rr := doBearer(router, "GET", "/accounts/Mark", token, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s token to be rejected, got %v", name, rr.Code)
+		}
+	}
+
+	// Without the transfer scope the token can only read
+	if rr := doBearer(router, "POST", "/transfer", valid, `{"from": "Mark", "to": "Jane", "amount": 1}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without the transfer scope, got %v", rr.Code)
+	}
+}
+
+func TestJWTRS256WithKeyFileAndJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pemFile := writeTempFile(t, "public.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "2024-01",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+	}}})
+	jwksFile := writeTempFile(t, "jwks.json", string(jwks))
+
+	fromPEM := auth.NewJWTVerifier("", "")
+	if err := fromPEM.LoadRSAKeyFile(pemFile); err != nil {
+		t.Fatal(err)
+	}
+	fromJWKS := auth.NewJWTVerifier("", "")
+	if err := fromJWKS.LoadJWKSFile(jwksFile); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := userClaims("Mark", "read")
+	claims["accounts"] = []string{"Mark", "Mark-savings"}
+	token := signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "2024-01"}, claims, key)
+
+	for name, verifier := range map[string]*auth.JWTVerifier{"PEM": fromPEM, "JWKS": fromJWKS} {
+		principal, err := verifier.Authenticate(token)
+		if err != nil {
+			t.Fatalf("Expected %s verifier to accept the token, got %v", name, err)
+		}
+		if !principal.CanAccess("Mark-savings") || principal.CanAccess("Jane") {
+			t.Errorf("Expected %s principal to own the accounts claim, got %v", name, principal.Accounts)
+		}
+	}
+
+	// An RS256 verifier must not accept HS256 tokens signed with the public key
+	forged := signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, der)
+	if _, err := fromPEM.Authenticate(forged); err == nil {
+		t.Error("Expected algorithm confusion to be rejected")
+	}
+}
+
+func TestJWTOwnersFile(t *testing.T) {
+	owners, err := auth.LoadOwnersFile(writeTempFile(t, "owners.json", `{"user-123": ["Mark", "Shop"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := auth.NewJWTVerifier("", "")
+	verifier.AddHMACKey("", []byte(testHMACSecret))
+	verifier.SetOwners(owners)
+
+	// The mapping overrides any accounts claim in the token
+	claims := userClaims("user-123", "read")
+	claims["accounts"] = []string{"Jane"}
+	principal, err := verifier.Authenticate(hs256(t, claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.CanAccess("Shop") || principal.CanAccess("Jane") {
+		t.Errorf("Expected owners file to decide ownership, got %v", principal.Accounts)
+	}
+
+	// Unmapped subjects own nothing
+	principal, _ = verifier.Authenticate(hs256(t, userClaims("stranger", "read")))
+	if principal.CanAccess("stranger") {
+		t.Error("Expected an unmapped subject to own no accounts")
+	}
+}
+
+func TestAPIKeyRestrictedToAccounts(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	secret, _, err := keys.Issue(auth.Key{ID: "mark-app", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeTransfer}, Accounts: []string{"Mark"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := doAuth(router, "POST", "/transfer", secret, `{"from": "Mark", "to": "Jane", "amount": 1}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected key to debit Mark, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", "/transfer", secret, `{"from": "Jane", "to": "Mark", "amount": 1}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected key not to debit Jane, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,285 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// bankOpKind distinguishes the client operations recorded in a history
+type bankOpKind int
+
+const (
+	bankGet bankOpKind = iota
+	bankTransfer
+)
+
+// bankOp is one client operation with its invocation and response times.
+// For reads Balance holds the observed balance; for transfers OK records
+// whether the server reported success.
+type bankOp struct {
+	Client  int
+	Kind    bankOpKind
+	From    string
+	To      string
+	Amount  float64
+	Call    time.Duration
+	Return  time.Duration
+	Balance float64
+	OK      bool
+}
+
+func (op bankOp) String() string {
+	if op.Kind == bankGet {
+		return fmt.Sprintf("client %d: get(%s)=%v [%v, %v]", op.Client, op.From, op.Balance, op.Call, op.Return)
+	}
+	return fmt.Sprintf("client %d: transfer(%s->%s, %v)=%v [%v, %v]", op.Client, op.From, op.To, op.Amount, op.OK, op.Call, op.Return)
+}
+
+// bankModel is the sequential specification of the bank
+type bankModel map[string]float64
+
+// step applies the operation to a copy of the model and reports whether
+// the observed output is allowed by the sequential specification
+func (m bankModel) step(op bankOp) (bankModel, bool) {
+	switch op.Kind {
+	case bankGet:
+		return m, m[op.From] == op.Balance
+	default:
+		canTransfer := op.Amount > 0 && op.From != op.To && m[op.From] >= op.Amount
+		if canTransfer != op.OK {
+			return m, false
+		}
+		if !op.OK {
+			return m, true
+		}
+
+		next := make(bankModel, len(m))
+		for k, v := range m {
+			next[k] = v
+		}
+		next[op.From] -= op.Amount
+		next[op.To] += op.Amount
+		return next, true
+	}
+}
+
+// key returns a canonical encoding of the model for memoization
+func (m bankModel) key() string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%v;", name, m[name])
+	}
+	return b.String()
+}
+
+// checkLinearizable searches for a sequential ordering of the history that
+// respects real-time order and the bank model (Wing & Gong with memoization).
+// It returns the linearization found, or ok=false if none exists.
+func checkLinearizable(initial bankModel, history []bankOp) (order []bankOp, ok bool) {
+	if len(history) > 64 {
+		panic("checkLinearizable supports at most 64 operations")
+	}
+
+	full := uint64(1)<<uint(len(history)) - 1
+	failed := make(map[string]bool)
+
+	var search func(done uint64, model bankModel) bool
+	search = func(done uint64, model bankModel) bool {
+		if done == full {
+			return true
+		}
+
+		memo := fmt.Sprintf("%x|%s", done, model.key())
+		if failed[memo] {
+			return false
+		}
+
+		// Any pending operation invoked before the earliest pending response
+		// may take effect next without violating real-time order
+		minReturn := time.Duration(1<<63 - 1)
+		for i, op := range history {
+			if done&(1<<uint(i)) == 0 && op.Return < minReturn {
+				minReturn = op.Return
+			}
+		}
+
+		for i, op := range history {
+			if done&(1<<uint(i)) != 0 || op.Call > minReturn {
+				continue
+			}
+
+			next, allowed := model.step(op)
+			if !allowed {
+				continue
+			}
+
+			order = append(order, op)
+			if search(done|1<<uint(i), next) {
+				return true
+			}
+			order = order[:len(order)-1]
+		}
+
+		failed[memo] = true
+		return false
+	}
+
+	return order, search(0, initial)
+}
+
+// recordHistory runs concurrent clients against the server and records
+// every operation with its invocation and response times
+func recordHistory(t *testing.T, serverURL string, users []string, clients, opsPerClient int, seed int64) []bankOp {
+	t.Helper()
+
+	start := time.Now()
+	var (
+		mu      sync.Mutex
+		history []bankOp
+		wg      sync.WaitGroup
+	)
+
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(c)))
+
+			for i := 0; i < opsPerClient; i++ {
+				op := bankOp{Client: c, From: users[rng.Intn(len(users))]}
+				if rng.Intn(2) == 0 {
+					op.Kind = bankGet
+				} else {
+					op.Kind = bankTransfer
+					op.To = users[rng.Intn(len(users))]
+					op.Amount = float64(10 * (1 + rng.Intn(5)))
+				}
+
+				op.Call = time.Since(start)
+				if err := invokeBankOp(serverURL, &op); err != nil {
+					t.Errorf("client %d: %v", c, err)
+					return
+				}
+				op.Return = time.Since(start)
+
+				mu.Lock()
+				history = append(history, op)
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return history
+}
+
+// invokeBankOp performs the HTTP call for the operation and stores its output
+func invokeBankOp(serverURL string, op *bankOp) error {
+	if op.Kind == bankGet {
+		resp, err := http.Get(serverURL + "/accounts/" + op.From)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var account service.Account
+		if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+			return err
+		}
+		op.Balance = account.Balance
+		return nil
+	}
+
+	body, _ := json.Marshal(service.TransferRequest{From: op.From, To: op.To, Amount: op.Amount})
+	resp, err := http.Post(serverURL+"/transfer", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result service.TransferResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	op.OK = result.Success
+	return nil
+}
+
+func TestTransferAPILinearizable(t *testing.T) {
+	initial := bankModel{"Mark": 100, "Jane": 50, "Adam": 0}
+
+	for seed := int64(1); seed <= 10; seed++ {
+		accountStore := store.NewInMemoryStore()
+		for name, balance := range initial {
+			accountStore.CreateAccount(name, balance)
+		}
+		apiHandler := api.NewAPI(service.NewTransferService(accountStore), accountStore)
+		server := httptest.NewServer(apiHandler.SetupRoutes())
+
+		history := recordHistory(t, server.URL, []string{"Mark", "Jane", "Adam"}, 4, 6, seed)
+		server.Close()
+
+		if _, ok := checkLinearizable(initial, history); !ok {
+			sort.Slice(history, func(i, j int) bool { return history[i].Call < history[j].Call })
+			var lines []string
+			for _, op := range history {
+				lines = append(lines, op.String())
+			}
+			t.Fatalf("seed %d: history is not linearizable:\n  %s", seed, strings.Join(lines, "\n  "))
+		}
+	}
+}
+
+func TestLinearizabilityCheckerRejectsStaleRead(t *testing.T) {
+	initial := bankModel{"Mark": 100, "Jane": 50}
+
+	// The transfer completes before the read starts, yet the read observes
+	// the old balance, so no valid linearization exists
+	history := []bankOp{
+		{Client: 0, Kind: bankTransfer, From: "Mark", To: "Jane", Amount: 25, OK: true, Call: 0, Return: 10},
+		{Client: 1, Kind: bankGet, From: "Mark", Balance: 100, Call: 20, Return: 30},
+	}
+
+	if _, ok := checkLinearizable(initial, history); ok {
+		t.Errorf("Expected stale read to be rejected")
+	}
+
+	// If the operations overlap, the read may be ordered first
+	history[1].Call = 5
+	if _, ok := checkLinearizable(initial, history); !ok {
+		t.Errorf("Expected overlapping read to be accepted")
+	}
+}
+
+func TestLinearizabilityCheckerRejectsOverdraft(t *testing.T) {
+	initial := bankModel{"Mark": 30, "Jane": 0}
+
+	// Two concurrent transfers of 20 cannot both succeed from a balance of 30
+	history := []bankOp{
+		{Client: 0, Kind: bankTransfer, From: "Mark", To: "Jane", Amount: 20, OK: true, Call: 0, Return: 10},
+		{Client: 1, Kind: bankTransfer, From: "Mark", To: "Jane", Amount: 20, OK: true, Call: 1, Return: 11},
+	}
+
+	if _, ok := checkLinearizable(initial, history); ok {
+		t.Errorf("Expected double spend to be rejected")
+	}
+}
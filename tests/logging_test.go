@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"money-transfer-system/api"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// logLines parses JSON log output into one map per line
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestRequestLoggingWithRequestID(t *testing.T) {
+	// Setup
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+	transferService := service.NewTransferService(accountStore, service.WithLogger(logger))
+	router := api.NewAPI(transferService, accountStore, api.WithLogger(logger)).SetupRoutes()
+
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"from": "Mark", "to": "Jane", "amount": 500}`))
+	req.Header.Set(api.RequestIDHeader, "req-42")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get(api.RequestIDHeader); got != "req-42" {
+		t.Errorf("Expected request ID to be echoed, got %q", got)
+	}
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("Expected service and request log lines, got %d:\n%s", len(lines), buf.String())
+	}
+
+	// Service log is correlated with the request
+	serviceLine, requestLine := lines[0], lines[1]
+	if serviceLine["msg"] != "transfer processed" || serviceLine["request_id"] != "req-42" {
+		t.Errorf("Unexpected service log line: %v", serviceLine)
+	}
+
+	expected := map[string]interface{}{
+		"msg":        "http request",
+		"request_id": "req-42",
+		"method":     "POST",
+		"route":      "/transfer",
+		"status":     float64(400),
+		"from":       "Mark",
+		"to":         "Jane",
+		"amount":     float64(500),
+		"outcome":    "insufficient_funds",
+	}
+	for key, value := range expected {
+		if requestLine[key] != value {
+			t.Errorf("Expected %s=%v in request log, got %v", key, value, requestLine[key])
+		}
+	}
+
+	if _, ok := requestLine["latency_ms"]; !ok {
+		t.Errorf("Expected latency_ms in request log: %v", requestLine)
+	}
+}
+
+func TestRequestIDIsGeneratedWhenMissingOrInvalid(t *testing.T) {
+	router := setupTestAPI().SetupRoutes()
+
+	for _, incoming := range []string{"", "bad id with spaces", strings.Repeat("x", 200)} {
+		req, _ := http.NewRequest("GET", "/accounts/Mark", nil)
+		if incoming != "" {
+			req.Header.Set(api.RequestIDHeader, incoming)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		got := rr.Header().Get(api.RequestIDHeader)
+		if len(got) != 32 || got == incoming {
+			t.Errorf("Expected a generated request ID for %q, got %q", incoming, got)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"money-transfer-system/api"
+	"money-transfer-system/metrics"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+func TestTransferMetricsByOutcome(t *testing.T) {
+	// Setup
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	registry := metrics.NewRegistry()
+	transferMetrics := metrics.NewTransferMetrics(registry)
+	transferService := service.NewTransferService(accountStore, service.WithObserver(transferMetrics))
+
+	transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 10})
+	transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 1000})
+	transferService.Transfer(service.TransferRequest{From: "Mark", To: "Nobody", Amount: 10})
+	transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: -1})
+
+	for outcome, expected := range map[string]float64{
+		"success":            1,
+		"insufficient_funds": 1,
+		"not_found":          1,
+		"invalid_amount":     1,
+	} {
+		if got := transferMetrics.Transfers(outcome); got != expected {
+			t.Errorf("Expected %v %s transfers, got %v", expected, outcome, got)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	// Setup
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	registry := metrics.NewRegistry()
+	metrics.RegisterAccountGauges(registry, accountStore)
+	transferService := service.NewTransferService(accountStore, service.WithObserver(metrics.NewTransferMetrics(registry)))
+	router := api.NewAPI(transferService, accountStore, api.WithMetrics(registry)).SetupRoutes()
+
+	// Generate some traffic
+	for _, path := range []string{"/accounts/Mark", "/accounts/Jane"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"from": "Mark", "to": "Jane", "amount": 5}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Scrape
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", rr.Code)
+	}
+
+	body := rr.Body.String()
+	expected := []string{
+		"# TYPE mts_transfers_total counter",
+		`mts_transfers_total{outcome="success"} 1`,
+		`mts_transfer_duration_seconds_count{outcome="success"} 1`,
+		`mts_account_lock_wait_seconds_count{tier="standard"} 2`,
+		`mts_http_requests_total{method="GET",route="/accounts/{username}",code="200"} 2`,
+		`mts_http_requests_total{method="POST",route="/transfer",code="200"} 1`,
+		`mts_http_request_duration_seconds_bucket{method="POST",route="/transfer",le="+Inf"} 1`,
+		"mts_accounts 2",
+		"mts_balance_total 150",
+	}
+	for _, want := range expected {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// setupPockets creates Mark with 1000, 600 of it in a rent pocket that
+// allows direct debits and 200 in a locked savings pocket
+func setupPockets(t *testing.T, opts ...service.Option) (*service.TransferService, *store.InMemoryStore, *service.Account) {
+	t.Helper()
+
+	accountStore := store.NewInMemoryStore()
+	mark, _ := accountStore.CreateAccount("Mark", 1000)
+	accountStore.CreateAccount("Landlord", 0)
+	if _, err := mark.CreatePocket("rent", 600, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mark.CreatePocket("savings", 5000, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := mark.MovePocket("", "rent", 600); err != nil {
+		t.Fatal(err)
+	}
+	if err := mark.MovePocket("", "savings", 200); err != nil {
+		t.Fatal(err)
+	}
+
+	return service.NewTransferService(accountStore, opts...), accountStore, mark
+}
+
+// pocketBalance returns the balance of one of the account's pockets
+func pocketBalance(t *testing.T, account *service.Account, name string) float64 {
+	t.Helper()
+
+	for _, pocket := range account.Pockets() {
+		if pocket.Name == name {
+			return pocket.Balance
+		}
+	}
+	t.Fatalf("pocket %q not found", name)
+	return 0
+}
+
+func TestPocketRules(t *testing.T) {
+	_, _, mark := setupPockets(t)
+
+	if _, err := mark.CreatePocket("rent", 0, false); !errors.Is(err, service.ErrPocketExists) {
+		t.Errorf("Expected ErrPocketExists, got %v", err)
+	}
+	if _, err := mark.CreatePocket("no spaces", 0, false); !errors.Is(err, service.ErrInvalidPocketName) {
+		t.Errorf("Expected ErrInvalidPocketName, got %v", err)
+	}
+	if err := mark.MovePocket("", "rent", 201); !errors.Is(err, service.ErrInsufficientFunds) {
+		t.Errorf("Expected moving more than the main balance to fail, got %v", err)
+	}
+	if err := mark.MovePocket("rent", "rent", 1); !errors.Is(err, service.ErrSamePocket) {
+		t.Errorf("Expected ErrSamePocket, got %v", err)
+	}
+	if err := mark.MovePocket("savings", "rent", 50); err != nil {
+		t.Errorf("Expected a move between pockets to succeed, got %v", err)
+	}
+	if rent, savings := pocketBalance(t, mark, "rent"), pocketBalance(t, mark, "savings"); rent != 650 || savings != 150 {
+		t.Errorf("Expected 650 in rent and 150 in savings, got %v and %v", rent, savings)
+	}
+
+	mark.SetStatus(service.StatusFrozen)
+	if err := mark.MovePocket("rent", "", 1); !errors.Is(err, service.ErrAccountFrozen) {
+		t.Errorf("Expected a frozen account to refuse moves, got %v", err)
+	}
+}
+
+func TestTransferCannotSpendPockets(t *testing.T) {
+	transferService, accountStore, _ := setupPockets(t)
+
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Landlord", Amount: 201}); !errors.Is(err, service.ErrInsufficientFunds) {
+		t.Errorf("Expected earmarked money to be unavailable, got %v", err)
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Landlord", Amount: 200}); err != nil {
+		t.Errorf("Expected the main balance to be spendable, got %v", err)
+	}
+	if balance, _ := balances(t, accountStore, "Mark"); balance != 800 {
+		t.Errorf("Expected the balance to include pockets, got %v", balance)
+	}
+}
+
+func TestTransferFromPocket(t *testing.T) {
+	transferService, accountStore, mark := setupPockets(t)
+
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Landlord", Amount: 50, FromPocket: "savings"}); !errors.Is(err, service.ErrPocketLocked) {
+		t.Errorf("Expected a pocket without direct debits to be refused, got %v", err)
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Landlord", Amount: 700, FromPocket: "rent"}); !errors.Is(err, service.ErrInsufficientFunds) {
+		t.Errorf("Expected a pocket to be limited to its own balance, got %v", err)
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Landlord", Amount: 600, FromPocket: "rent"}); err != nil {
+		t.Fatalf("Expected the rent pocket to pay the landlord, got %v", err)
+	}
+
+	if rent := pocketBalance(t, mark, "rent"); rent != 0 {
+		t.Errorf("Expected the rent pocket to be empty, got %v", rent)
+	}
+	if balance, _ := balances(t, accountStore, "Mark"); balance != 400 {
+		t.Errorf("Expected 400 left, got %v", balance)
+	}
+}
+
+func TestHeldPocketTransferReturnsToPocket(t *testing.T) {
+	transferService, accountStore, mark := setupPockets(t, service.WithApprovals(100, time.Hour))
+
+	result, err := transferService.TransferContext(as("maker"), service.TransferRequest{From: "Mark", To: "Landlord", Amount: 500, FromPocket: "rent"})
+	if !errors.Is(err, service.ErrApprovalRequired) {
+		t.Fatalf("Expected the transfer to be held, got %v", err)
+	}
+	if rent := pocketBalance(t, mark, "rent"); rent != 100 {
+		t.Errorf("Expected the hold to come out of the pocket, got %v", rent)
+	}
+
+	if _, err := transferService.Reject(as("checker"), result.ApprovalID, "wrong landlord"); err != nil {
+		t.Fatal(err)
+	}
+	if rent := pocketBalance(t, mark, "rent"); rent != 600 {
+		t.Errorf("Expected the rejected hold to return to the pocket, got %v", rent)
+	}
+	if balance, held := balances(t, accountStore, "Mark"); balance != 1000 || held != 0 {
+		t.Errorf("Expected 1000 with nothing held, got %v with %v held", balance, held)
+	}
+}
+
+func TestDeletePocketReturnsBalance(t *testing.T) {
+	transferService, _, mark := setupPockets(t)
+
+	returned, err := mark.DeletePocket("savings")
+	if err != nil || returned != 200 {
+		t.Fatalf("Expected 200 returned, got %v, %v", returned, err)
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Landlord", Amount: 400}); err != nil {
+		t.Errorf("Expected the returned money to be spendable, got %v", err)
+	}
+}
+
+func TestPocketsAPI(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 1000)
+	accountStore.CreateAccount("Jane", 0)
+
+	keys := auth.NewKeyStore()
+	mark, _, _ := keys.Issue(auth.Key{ID: "mark", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Mark"}})
+	jane, _, _ := keys.Issue(auth.Key{ID: "jane", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Jane"}})
+	router := api.NewAPI(service.NewTransferService(accountStore), accountStore, api.WithKeyStore(keys)).SetupRoutes()
+
+	rr := doAuth(router, "POST", "/accounts/Mark/pockets", mark, `{"name": "holiday", "goal": 800}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", "/accounts/Mark/pockets", mark, `{"name": "holiday"}`); rr.Code != http.StatusConflict || errorCode(t, rr) != "pocket_exists" {
+		t.Errorf("Expected a duplicate pocket to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", "/accounts/Mark/pockets", jane, `{"name": "mine"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected another customer to be refused, got %v", rr.Code)
+	}
+
+	rr = doAuth(router, "POST", "/accounts/Mark/pockets/move", mark, `{"to": "holiday", "amount": 300}`)
+	var account struct {
+		Balance   float64          `json:"balance"`
+		Available float64          `json:"available"`
+		Pockets   []service.Pocket `json:"pockets"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &account)
+	if rr.Code != http.StatusOK || account.Balance != 1000 || account.Available != 700 || len(account.Pockets) != 1 || account.Pockets[0].Balance != 300 {
+		t.Fatalf("Expected 300 of 1000 in the pocket, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "POST", "/transfer", mark, `{"from": "Mark", "to": "Jane", "amount": 100, "from_pocket": "holiday"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a locked pocket to be refused, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "PUT", "/accounts/Mark/pockets/holiday", mark, `{"goal": 800, "direct_debit": true}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the pocket to be updated, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", "/transfer", mark, `{"from": "Mark", "to": "Jane", "amount": 100, "from_pocket": "holiday"}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected the pocket to pay Jane, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "DELETE", "/accounts/Mark/pockets/holiday", mark, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the pocket to be deleted, got %v", rr.Code)
+	}
+	rr = doAuth(router, "GET", "/accounts/Mark/pockets", mark, "")
+	var pockets []service.Pocket
+	if json.Unmarshal(rr.Body.Bytes(), &pockets); rr.Code != http.StatusOK || len(pockets) != 0 {
+		t.Errorf("Expected no pockets left, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "DELETE", "/accounts/Mark/pockets/holiday", mark, ""); rr.Code != http.StatusNotFound || errorCode(t, rr) != "pocket_not_found" {
+		t.Errorf("Expected status 404, got %v", rr.Code)
+	}
+}
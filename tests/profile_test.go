@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+func TestAccountIDs(t *testing.T) {
+	for name, accountStore := range map[string]service.AccountManager{
+		"memory":  store.NewInMemoryStore(),
+		"sharded": store.NewShardedStore(4),
+	} {
+		mark, _ := accountStore.CreateAccount("Mark", 100)
+		jane, _ := accountStore.CreateAccount("Jane", 50)
+
+		if !service.IsAccountID(mark.ID) || mark.ID == jane.ID {
+			t.Errorf("%s: expected distinct account IDs, got %q and %q", name, mark.ID, jane.ID)
+		}
+		if mark.CreatedAt.IsZero() || mark.Profile.Type != service.TypePersonal {
+			t.Errorf("%s: expected a creation time and personal type, got %v, %q", name, mark.CreatedAt, mark.Profile.Type)
+		}
+
+		if account, err := accountStore.GetAccountByID(mark.ID); err != nil || account != mark {
+			t.Errorf("%s: expected lookup by ID to find Mark, got %v", name, err)
+		}
+		if _, err := accountStore.GetAccountByID("acc_missing"); err != service.ErrAccountNotFound {
+			t.Errorf("%s: expected ErrAccountNotFound, got %v", name, err)
+		}
+
+		for _, ref := range []string{mark.ID, "Mark"} {
+			if account, err := service.LookupAccount(accountStore, ref); err != nil || account != mark {
+				t.Errorf("%s: expected %q to resolve to Mark, got %v", name, ref, err)
+			}
+		}
+	}
+}
+
+func TestAccountRoutesAcceptIDs(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	mark, _ := accountStore.CreateAccount("Mark", 100)
+	router := api.NewAPI(service.NewTransferService(accountStore), accountStore).SetupRoutes()
+
+	rr := doAuth(router, "GET", "/accounts/"+mark.ID, "", "")
+	var account service.Account
+	if err := json.Unmarshal(rr.Body.Bytes(), &account); err != nil || account.Username != "Mark" || account.ID != mark.ID {
+		t.Errorf("Expected Mark by ID, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "POST", "/accounts/"+mark.ID+"/freeze", "", ""); rr.Code != http.StatusOK || mark.Status() != service.StatusFrozen {
+		t.Errorf("Expected freeze by ID to succeed, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "GET", "/accounts/acc_missing", "", ""); rr.Code != http.StatusNotFound || errorCode(t, rr) != "not_found" {
+		t.Errorf("Expected status 404 for an unknown ID, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestTransferAcceptsIDs(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	mark, _ := accountStore.CreateAccount("Mark", 100)
+	jane, _ := accountStore.CreateAccount("Jane", 0)
+	router := api.NewAPI(service.NewTransferService(accountStore), accountStore).SetupRoutes()
+
+	rr := doAuth(router, "POST", "/transfer", "", `{"from": "`+mark.ID+`", "to": "`+jane.ID+`", "amount": 30}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected a transfer by IDs to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if balance, _ := balances(t, accountStore, "Jane"); balance != 30 {
+		t.Errorf("Expected Jane to receive 30, got %v", balance)
+	}
+	if rr := doAuth(router, "POST", "/transfer", "", `{"from": "`+mark.ID+`", "to": "Mark", "amount": 1}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a transfer from Mark's ID to Mark to be refused, got %v", rr.Code)
+	}
+}
+
+func TestUsernamesCannotLookLikeIDs(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+
+	rr := doAuth(router, "POST", "/accounts", admin, `{"username": "acc_3f9a1c07d2b84e65"}`)
+	if rr.Code != http.StatusBadRequest || errorCode(t, rr) != "invalid_username" {
+		t.Errorf("Expected a username with the ID prefix to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	path := writeTempFile(t, "accounts.json", `[{"username": "acc_1", "balance": 0}]`)
+	if _, err := store.LoadFixtureFile(path); err == nil || !strings.Contains(err.Error(), "must not start with") {
+		t.Errorf("Expected a fixture username with the ID prefix to be refused, got %v", err)
+	}
+}
+
+func TestCreateAccountWithProfile(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+
+	rr := doAuth(router, "POST", "/accounts", admin, `{"username": "acme", "display_name": "Acme Ltd", "type": "business",
+		"contact": {"email": "billing@acme.example", "phone": "+442071234567"}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	var account service.Account
+	json.Unmarshal(rr.Body.Bytes(), &account)
+	profile := account.Profile
+	if profile.DisplayName != "Acme Ltd" || profile.Type != service.TypeBusiness || profile.Contact.Email != "billing@acme.example" {
+		t.Errorf("Expected the profile in the response, got %+v", profile)
+	}
+	if location := rr.Header().Get("Location"); location != "/accounts/"+account.ID {
+		t.Errorf("Expected Location of the new account ID, got %q", location)
+	}
+
+	rr = doAuth(router, "POST", "/accounts", admin, `{"username": "bad", "display_name": "`+strings.Repeat("x", 129)+`",
+		"type": "trust", "contact": {"email": "nobody", "phone": "555-1234"}}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %v", rr.Code)
+	}
+	fields := fieldCodes(t, rr.Body.Bytes())
+	for _, field := range []string{"display_name", "type", "contact.email", "contact.phone"} {
+		if fields[field] != "invalid_format" {
+			t.Errorf("Expected %s to be invalid, got %v", field, fields)
+		}
+	}
+
+	rr = doAuth(router, "POST", "/accounts", admin, `{"username": "eve", "displayname": "Eve Adams"}`)
+	if rr.Code != http.StatusBadRequest || fieldCodes(t, rr.Body.Bytes())["displayname"] != "unknown_field" {
+		t.Errorf("Expected an unknown field to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFixtureProfiles(t *testing.T) {
+	path := writeTempFile(t, "accounts.csv", `username,balance,display_name,type,email
+Mark,100,Mark Smith,,mark@example.com
+fees,0,Platform fees,system,
+`)
+
+	fixtures, err := store.LoadFixtureFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountStore := store.NewInMemoryStore()
+	if err := store.Seed(accountStore, fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	mark, _ := accountStore.GetAccount("Mark")
+	if profile := mark.GetProfile(); profile.DisplayName != "Mark Smith" || profile.Type != service.TypePersonal || profile.Contact.Email != "mark@example.com" {
+		t.Errorf("Fixture profile not applied to Mark: %+v", profile)
+	}
+	fees, _ := accountStore.GetAccount("fees")
+	if fees.GetProfile().Type != service.TypeSystem {
+		t.Errorf("Expected fees to be a system account, got %q", fees.GetProfile().Type)
+	}
+
+	bad := writeTempFile(t, "bad.json", `[{"username": "Mark", "balance": 1, "type": "trust"}]`)
+	if _, err := store.LoadFixtureFile(bad); err == nil || !strings.Contains(err.Error(), `unknown account type "trust"`) {
+		t.Errorf("Expected an unknown type error, got %v", err)
+	}
+
+	// Fixtures follow the same rules as the API
+	bad = writeTempFile(t, "bad.json", `[
+  {"username": "mark smith", "balance": 1},
+  {"username": "Jane", "balance": 1, "display_name": "Jane\u0007", "contact": {"email": "jane", "phone": "555-0123"}}
+]`)
+	_, err = store.LoadFixtureFile(bad)
+	for _, want := range []string{`bad.json:2: username "mark smith"`, "bad.json:3: display_name", `email "jane"`, `phone "555-0123"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error containing %q, got %v", want, err)
+		}
+	}
+}
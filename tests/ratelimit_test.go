@@ -0,0 +1,249 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/ratelimit"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// fakeClock is a manually advanced clock for limiters
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// setupRateLimitedAPI creates a router allowing bursts of 3 reads and 2
+// transfers, refilled at one request per second
+func setupRateLimitedAPI(clock *fakeClock, opts ...api.Option) http.Handler {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	transferService := service.NewTransferService(accountStore)
+	read := ratelimit.NewLimiter(1, 3, ratelimit.WithClock(clock.Now))
+	transfer := ratelimit.NewLimiter(1, 2, ratelimit.WithClock(clock.Now))
+	return api.NewAPI(transferService, accountStore, append(opts, api.WithRateLimits(read, transfer))...).SetupRoutes()
+}
+
+// doFrom sends a request from the given remote address, with an API key if
+// one is given
+func doFrom(router http.Handler, method, path, remoteAddr, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if key != "" {
+		req.Header.Set(api.APIKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := ratelimit.NewLimiter(2, 4, ratelimit.WithClock(clock.Now))
+
+	for i := 0; i < 4; i++ {
+		if d := limiter.Allow("a"); !d.Allowed || d.Remaining != 3-i {
+			t.Fatalf("Request %d: expected to be allowed with %d remaining, got %+v", i, 3-i, d)
+		}
+	}
+
+	d := limiter.Allow("a")
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != 2*time.Second {
+		t.Errorf("Expected an empty bucket to refuse with retry after 500ms and reset 2s, got %+v", d)
+	}
+
+	// Other keys have their own bucket
+	if d := limiter.Allow("b"); !d.Allowed {
+		t.Errorf("Expected a different key to be allowed, got %+v", d)
+	}
+
+	// Tokens refill at the rate, up to the burst
+	clock.Advance(500 * time.Millisecond)
+	if d := limiter.Allow("a"); !d.Allowed {
+		t.Errorf("Expected a refilled token to be allowed, got %+v", d)
+	}
+	clock.Advance(time.Hour)
+	if d := limiter.Allow("a"); d.Remaining != 3 {
+		t.Errorf("Expected the bucket to refill only up to the burst, got %+v", d)
+	}
+}
+
+func TestTokenBucketForgetsIdleKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := ratelimit.NewLimiter(1, 2, ratelimit.WithClock(clock.Now))
+
+	for _, key := range []string{"a", "b", "c"} {
+		limiter.Allow(key)
+	}
+	clock.Advance(time.Minute)
+	limiter.Allow("d")
+
+	if n := limiter.Len(); n != 1 {
+		t.Errorf("Expected full idle buckets to be dropped, got %d keys", n)
+	}
+}
+
+func TestRateLimitSeparateBudgets(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	router := setupRateLimitedAPI(clock)
+
+	for i := 0; i < 2; i++ {
+		if rr := doFrom(router, "POST", "/transfer", "10.0.0.1:1234", "", `{"from":"Mark","to":"Jane","amount":1}`); rr.Code != http.StatusOK {
+			t.Fatalf("Transfer %d: expected 200, got %d", i, rr.Code)
+		}
+	}
+
+	rr := doFrom(router, "POST", "/transfer", "10.0.0.1:1234", "", `{"from":"Mark","to":"Jane","amount":1}`)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the transfer budget is spent, got %d", rr.Code)
+	}
+	if code := errorCode(t, rr); code != "rate_limited" {
+		t.Errorf("Expected error code rate_limited, got %s", code)
+	}
+	headers := map[string]string{"Retry-After": "1", "RateLimit-Limit": "2", "RateLimit-Remaining": "0", "RateLimit-Reset": "2"}
+	for name, want := range headers {
+		if got := rr.Header().Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	// Reads have their own budget
+	rr = doFrom(router, "GET", "/accounts/Mark", "10.0.0.1:1234", "", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "2" {
+		t.Errorf("Expected a read from the read budget, got %d with %q remaining", rr.Code, rr.Header().Get("RateLimit-Remaining"))
+	}
+
+	// Other clients are unaffected
+	if rr := doFrom(router, "POST", "/transfer", "10.0.0.2:1234", "", `{"from":"Mark","to":"Jane","amount":1}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", rr.Code)
+	}
+
+	clock.Advance(time.Second)
+	if rr := doFrom(router, "POST", "/transfer", "10.0.0.1:1234", "", `{"from":"Mark","to":"Jane","amount":1}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected a transfer after the retry delay, got %d", rr.Code)
+	}
+
+	// Health checks are never limited
+	for i := 0; i < 10; i++ {
+		if rr := doFrom(router, "GET", "/healthz", "10.0.0.1:1234", "", ""); rr.Code != http.StatusOK {
+			t.Fatalf("Expected /healthz to be unlimited, got %d", rr.Code)
+		}
+	}
+}
+
+func TestRateLimitKeyedByAPIKey(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	keys := auth.NewKeyStore()
+	first := createKey(t, keys, "first", auth.ScopeRead)
+	second := createKey(t, keys, "second", auth.ScopeRead)
+	router := setupRateLimitedAPI(clock, api.WithKeyStore(keys))
+
+	// One key exhausts its budget from several addresses
+	for i, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"} {
+		if rr := doFrom(router, "GET", "/accounts", addr, first, ""); rr.Code != http.StatusOK {
+			t.Fatalf("Read %d: expected 200, got %d", i, rr.Code)
+		}
+	}
+	if rr := doFrom(router, "GET", "/accounts", "10.0.0.4:1", first, ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the key to be limited across addresses, got %d", rr.Code)
+	}
+
+	// A second key from the same address has its own budget
+	if rr := doFrom(router, "GET", "/accounts", "10.0.0.1:1", second, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected another key to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	router := setupRateLimitedAPI(clock, api.WithTrustForwardedFor(true))
+
+	send := func(forwarded string) int {
+		req := httptest.NewRequest("GET", "/accounts", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The proxy appends the address it saw, so earlier entries are up to
+	// the client
+	for i := 0; i < 3; i++ {
+		send(fmt.Sprintf("198.51.100.%d, 203.0.113.7", i))
+	}
+	if code := send("203.0.113.7"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the forwarded client to be limited, got %d", code)
+	}
+	if code := send("203.0.113.7, 203.0.113.8"); code != http.StatusOK {
+		t.Errorf("Expected a different forwarded client behind the same proxy to be allowed, got %d", code)
+	}
+}
+
+func TestRateLimitIPBeforeAuthentication(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	keys := auth.NewKeyStore()
+	valid := createKey(t, keys, "valid", auth.ScopeRead)
+	router := setupRateLimitedAPI(clock, api.WithKeyStore(keys), api.WithIPRateLimit(ratelimit.NewLimiter(1, 2, ratelimit.WithClock(clock.Now))))
+
+	for i := 0; i < 2; i++ {
+		if rr := doFrom(router, "GET", "/accounts", "10.0.0.1:1", "mts_wrong", ""); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i, rr.Code)
+		}
+	}
+	if rr := doFrom(router, "GET", "/accounts", "10.0.0.1:1", "mts_wrong", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected failed authentication to be limited, got %d", rr.Code)
+	}
+	if rr := doFrom(router, "GET", "/accounts", "10.0.0.1:1", valid, ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a valid key from the limited address to wait too, got %d", rr.Code)
+	}
+	if rr := doFrom(router, "GET", "/accounts", "10.0.0.2:1", valid, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected another address to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitByAccount(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	keys := auth.NewKeyStore()
+	first, _, _ := keys.Issue(auth.Key{ID: "first", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Mark", "Jane"}})
+	second, _, _ := keys.Issue(auth.Key{ID: "second", Roles: []auth.Role{auth.RoleCustomer}, Accounts: []string{"Mark", "Jane"}})
+	router := setupRateLimitedAPI(clock, api.WithKeyStore(keys), api.WithAccountRateLimit(ratelimit.NewLimiter(1, 1, ratelimit.WithClock(clock.Now))))
+
+	if rr := doFrom(router, "POST", "/transfer", "10.0.0.1:1", first, `{"from":"Mark","to":"Jane","amount":1}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the first transfer to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Another key debiting the same account shares its budget
+	rr := doFrom(router, "POST", "/transfer", "10.0.0.2:1", second, `{"from":"Mark","to":"Jane","amount":1}`)
+	if rr.Code != http.StatusTooManyRequests || errorCode(t, rr) != "rate_limited" {
+		t.Errorf("Expected the account to be limited across keys, got %d", rr.Code)
+	}
+	if rr := doFrom(router, "POST", "/transfer", "10.0.0.2:1", second, `{"from":"Jane","to":"Mark","amount":1}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected another account to be allowed, got %d", rr.Code)
+	}
+}
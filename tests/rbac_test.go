@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+
+	"github.com/gorilla/mux"
+)
+
+// setupRBACAPI creates a router with a key per built-in role
+func setupRBACAPI(t *testing.T, opts ...api.Option) (*mux.Router, map[auth.Role]string) {
+	t.Helper()
+
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	keys := auth.NewKeyStore()
+	secrets := make(map[auth.Role]string)
+	for _, role := range []auth.Role{auth.RoleCustomer, auth.RoleSupport, auth.RoleTreasury, auth.RoleAdmin} {
+		key := auth.Key{ID: string(role), Roles: []auth.Role{role}}
+		if role == auth.RoleCustomer {
+			key.Accounts = []string{"Mark"}
+		}
+		secret, _, err := keys.Issue(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[role] = secret
+	}
+
+	transferService := service.NewTransferService(accountStore)
+	router := api.NewAPI(transferService, accountStore, append([]api.Option{api.WithAccountCreation(true)}, append(opts, api.WithKeyStore(keys))...)...).SetupRoutes()
+	return router, secrets
+}
+
+func TestRBACRolePermissions(t *testing.T) {
+	router, keys := setupRBACAPI(t)
+
+	cases := []struct {
+		role   auth.Role
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		// Customers act on their own accounts only
+		{auth.RoleCustomer, "GET", "/accounts/Mark", "", http.StatusOK},
+		{auth.RoleCustomer, "GET", "/accounts/Jane", "", http.StatusForbidden},
+		{auth.RoleCustomer, "POST", "/transfer", `{"from": "Mark", "to": "Jane", "amount": 1}`, http.StatusOK},
+		{auth.RoleCustomer, "POST", "/accounts/Jane/freeze", "", http.StatusForbidden},
+		{auth.RoleCustomer, "PUT", "/accounts/Mark/limits", `{"max_transfer": 1000}`, http.StatusForbidden},
+		{auth.RoleCustomer, "POST", "/accounts", `{"username": "Eve"}`, http.StatusForbidden},
+
+		// Support can look at anything and freeze, but not move money
+		{auth.RoleSupport, "GET", "/accounts/Jane", "", http.StatusOK},
+		{auth.RoleSupport, "POST", "/accounts", `{"username": "Eve"}`, http.StatusCreated},
+		{auth.RoleSupport, "POST", "/accounts", `{"username": "Bob", "balance": 100}`, http.StatusForbidden},
+		{auth.RoleSupport, "POST", "/transfer", `{"from": "Mark", "to": "Jane", "amount": 1}`, http.StatusForbidden},
+		{auth.RoleSupport, "PUT", "/accounts/Mark/limits", `{"max_transfer": 1000}`, http.StatusForbidden},
+
+		// Treasury manages limits and may debit any account
+		{auth.RoleTreasury, "PUT", "/accounts/Mark/limits", `{"max_transfer": 1000}`, http.StatusOK},
+		{auth.RoleTreasury, "POST", "/transfer", `{"from": "Jane", "to": "Mark", "amount": 1}`, http.StatusOK},
+		{auth.RoleTreasury, "POST", "/accounts/Jane/freeze", "", http.StatusForbidden},
+		{auth.RoleTreasury, "GET", "/admin/keys", "", http.StatusForbidden},
+
+		// Admins can do everything
+		{auth.RoleAdmin, "GET", "/admin/keys", "", http.StatusOK},
+		{auth.RoleAdmin, "POST", "/accounts/Jane/freeze", "", http.StatusOK},
+		{auth.RoleAdmin, "POST", "/accounts/Jane/unfreeze", "", http.StatusOK},
+		{auth.RoleAdmin, "POST", "/accounts", `{"username": "Ann", "balance": 100}`, http.StatusCreated},
+	}
+
+	for _, tc := range cases {
+		rr := doAuth(router, tc.method, tc.path, keys[tc.role], tc.body)
+		if rr.Code != tc.want {
+			t.Errorf("%s %s %s: expected %v, got %v: %s", tc.role, tc.method, tc.path, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestRBACFreezeBlocksTransfers(t *testing.T) {
+	router, keys := setupRBACAPI(t)
+	transfer := `{"from": "Mark", "to": "Jane", "amount": 10}`
+
+	if rr := doAuth(router, "POST", "/accounts/Mark/freeze", keys[auth.RoleSupport], ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected freeze to succeed, got %v", rr.Code)
+	}
+	rr := doAuth(router, "POST", "/transfer", keys[auth.RoleCustomer], transfer)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "frozen") {
+		t.Errorf("Expected transfer from a frozen account to fail, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "POST", "/accounts/Mark/unfreeze", keys[auth.RoleSupport], ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected unfreeze to succeed, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", "/transfer", keys[auth.RoleCustomer], transfer); rr.Code != http.StatusOK {
+		t.Errorf("Expected transfer after unfreeze to succeed, got %v", rr.Code)
+	}
+
+	if rr := doAuth(router, "POST", "/accounts/Nobody/freeze", keys[auth.RoleSupport], ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 freezing a missing account, got %v", rr.Code)
+	}
+}
+
+func TestRBACLimits(t *testing.T) {
+	router, keys := setupRBACAPI(t)
+
+	if rr := doAuth(router, "PUT", "/accounts/Mark/limits", keys[auth.RoleTreasury], `{"max_transfer": 5}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected limits update to succeed, got %v", rr.Code)
+	}
+	rr := doAuth(router, "POST", "/transfer", keys[auth.RoleCustomer], `{"from": "Mark", "to": "Jane", "amount": 10}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "limit") {
+		t.Errorf("Expected transfer above the new limit to fail, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "PUT", "/accounts/Mark/limits", keys[auth.RoleTreasury], `{"max_transfer": -1}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a negative limit, got %v", rr.Code)
+	}
+}
+
+func TestRBACPolicyFile(t *testing.T) {
+	// Make customers read-only and add an auditor role
+	policy, err := auth.LoadPolicyFile(writeTempFile(t, "policy.json", `{
+		"roles": {
+			"customer": ["accounts:read"],
+			"auditor": ["accounts:read", "accounts:read_any"]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, keys := setupRBACAPI(t, api.WithPolicy(policy))
+	if rr := doAuth(router, "POST", "/transfer", keys[auth.RoleCustomer], `{"from": "Mark", "to": "Jane", "amount": 1}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected policy file to revoke transfers from customers, got %v", rr.Code)
+	}
+
+	// Built-in roles missing from the file keep their permissions
+	if rr := doAuth(router, "PUT", "/accounts/Mark/limits", keys[auth.RoleTreasury], `{"max_transfer": 10}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected treasury to keep its permissions, got %v", rr.Code)
+	}
+
+	auditor := &auth.Principal{ID: "audit", Roles: []auth.Role{"auditor"}}
+	if !policy.Allows(auditor, auth.PermAccountsReadAny) || policy.Allows(auditor, auth.PermTransfersCreate) {
+		t.Errorf("Unexpected auditor permissions %v", policy.Permissions(auditor))
+	}
+
+	for name, bad := range map[string]string{
+		"unknown scope":      `{"scopes": {"root": ["*"]}}`,
+		"unknown field":      `{"role": {"auditor": ["accounts:read"]}}`,
+		"unknown permission": `{"roles": {"auditor": ["accounts:reads"]}}`,
+		"empty role":         `{"roles": {"": ["accounts:read"]}}`,
+	} {
+		if _, err := auth.LoadPolicyFile(writeTempFile(t, "bad.json", bad)); err == nil {
+			t.Errorf("Expected a policy with an %s to be rejected", name)
+		}
+	}
+
+	// Keys may only hold roles the policy defines
+	keyStore := auth.NewKeyStore()
+	keyStore.Issue(auth.Key{ID: "audit", Roles: []auth.Role{"auditor"}})
+	if err := keyStore.CheckRoles(policy); err != nil {
+		t.Errorf("Expected the auditor role to be accepted, got %v", err)
+	}
+	if err := keyStore.CheckRoles(auth.DefaultPolicy()); err == nil {
+		t.Error("Expected a key with an undefined role to be rejected")
+	}
+	if _, _, err := keyStore.Issue(auth.Key{ID: "blank", Roles: []auth.Role{""}}); err == nil {
+		t.Error("Expected a key with an empty role to be rejected")
+	}
+}
+
+func TestRBACEveryRouteIsChecked(t *testing.T) {
+	router, _ := setupRBACAPI(t)
+	public := map[string]bool{"/healthz": true, "/readyz": true}
+
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		if public[tmpl] {
+			return nil
+		}
+
+		path := strings.NewReplacer("{username}", "Mark", "{id}", "admin").Replace(tmpl)
+		for _, method := range methods {
+			req, _ := http.NewRequest(method, path, strings.NewReader("{}"))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected %s %s to require credentials, got %v", method, tmpl, rr.Code)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/risk"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// setupRisk creates a service scored by the rules, sending scores of 50 to
+// review and blocking 80, with a clock starting at noon UTC
+func setupRisk(rules []risk.Rule, opts ...service.Option) (*service.TransferService, *fakeClock) {
+	accountStore := store.NewInMemoryStore()
+	for _, username := range []string{"Mark", "Jane", "Adam", "Eve", "Bob"} {
+		accountStore.CreateAccount(username, 5000)
+	}
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	engine := risk.NewEngine(50, 80, rules, risk.WithClock(clock.Now))
+	return service.NewTransferService(accountStore, append(opts, service.WithRiskEngine(engine))...), clock
+}
+
+// ruleNames returns the names of the rules an assessment triggered
+func ruleNames(assessment *service.RiskAssessment) []string {
+	var names []string
+	if assessment != nil {
+		for _, hit := range assessment.Rules {
+			names = append(names, hit.Rule)
+		}
+	}
+	return names
+}
+
+func TestRiskNewCounterparty(t *testing.T) {
+	engine := risk.NewEngine(30, 0, []risk.Rule{risk.NewCounterpartyRule{MinAmount: 1000, Score: 40}})
+	ctx := context.Background()
+
+	large := service.TransferRequest{From: "Mark", To: "Jane", Amount: 1500}
+	if a := engine.Assess(ctx, large); a.Decision != service.RiskReview || a.Score != 40 {
+		t.Errorf("Expected a large first payment to go to review, got %+v", a)
+	}
+	if a := engine.Assess(ctx, service.TransferRequest{From: "Mark", To: "Jane", Amount: 10}); a.Decision != service.RiskAllow {
+		t.Errorf("Expected a small first payment to be allowed, got %+v", a)
+	}
+
+	engine.Record(ctx, service.TransferRequest{From: "Mark", To: "Jane", Amount: 10})
+	if a := engine.Assess(ctx, large); a.Decision != service.RiskAllow {
+		t.Errorf("Expected a known counterparty to be allowed, got %+v", a)
+	}
+}
+
+func TestRiskNewCounterpartyWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	engine := risk.NewEngine(30, 0, []risk.Rule{risk.NewCounterpartyRule{MinAmount: 1000, Window: 24 * time.Hour, Score: 40}},
+		risk.WithClock(clock.Now), risk.WithCounterpartyRetention(24*time.Hour))
+	ctx := context.Background()
+	large := service.TransferRequest{From: "Mark", To: "Jane", Amount: 1500}
+
+	engine.Record(ctx, service.TransferRequest{From: "Mark", To: "Jane", Amount: 10})
+	engine.Record(ctx, service.TransferRequest{From: "Adam", To: "Eve", Amount: 10})
+	if a := engine.Assess(ctx, large); a.Decision != service.RiskAllow {
+		t.Errorf("Expected a recipient paid within the window to be known, got %+v", a)
+	}
+
+	// Counterparties outside the window are forgotten
+	clock.Advance(25 * time.Hour)
+	if a := engine.Assess(ctx, large); a.Decision != service.RiskReview {
+		t.Errorf("Expected a recipient last paid before the window to be new again, got %+v", a)
+	}
+	engine.Record(ctx, service.TransferRequest{From: "Bob", To: "Mark", Amount: 10})
+	if n := engine.Counterparties(); n != 1 {
+		t.Errorf("Expected expired counterparties to be evicted, got %d left", n)
+	}
+}
+
+func TestRiskFanOut(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	engine := risk.NewEngine(50, 0, []risk.Rule{risk.FanOutRule{Window: time.Hour, MaxRecipients: 3, Score: 50}}, risk.WithClock(clock.Now))
+	ctx := context.Background()
+
+	for _, to := range []string{"a", "b", "c"} {
+		engine.Record(ctx, service.TransferRequest{From: "Mark", To: to, Amount: 1})
+	}
+	if a := engine.Assess(ctx, service.TransferRequest{From: "Mark", To: "a", Amount: 1}); a.Decision != service.RiskAllow {
+		t.Errorf("Expected a repeat recipient to be allowed, got %+v", a)
+	}
+	if a := engine.Assess(ctx, service.TransferRequest{From: "Mark", To: "d", Amount: 1}); a.Decision != service.RiskReview {
+		t.Errorf("Expected a fourth recipient within the hour to go to review, got %+v", a)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if a := engine.Assess(ctx, service.TransferRequest{From: "Mark", To: "d", Amount: 1}); a.Decision != service.RiskAllow {
+		t.Errorf("Expected recipients outside the window to be ignored, got %+v", a)
+	}
+}
+
+func TestRiskConcurrentBurst(t *testing.T) {
+	engine := risk.NewEngine(50, 0, []risk.Rule{
+		risk.FanOutRule{Window: time.Hour, MaxRecipients: 3, Score: 50},
+		risk.RoundTripRule{Window: time.Hour, Score: 60},
+	})
+	ctx := context.Background()
+
+	// Transfers scored at the same time see each other, so at most the first
+	// three recipients go unflagged
+	var wg sync.WaitGroup
+	var reviewed atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(to string) {
+			defer wg.Done()
+			if engine.Assess(ctx, service.TransferRequest{From: "Mark", To: to, Amount: 1}).Decision == service.RiskReview {
+				reviewed.Add(1)
+			}
+		}(fmt.Sprintf("mule%d", i))
+	}
+	wg.Wait()
+	if n := reviewed.Load(); n < 7 {
+		t.Errorf("Expected at least 7 of a burst of 10 recipients to go to review, got %d", n)
+	}
+
+	// A transfer being scored counts against one coming back
+	engine.Assess(ctx, service.TransferRequest{From: "Adam", To: "Eve", Amount: 1})
+	if a := engine.Assess(ctx, service.TransferRequest{From: "Eve", To: "Adam", Amount: 1}); a.Decision != service.RiskReview {
+		t.Errorf("Expected a concurrent round trip to go to review, got %+v", a)
+	}
+}
+
+func TestRiskUnusualHour(t *testing.T) {
+	rule := risk.UnusualHourRule{StartHour: 22, EndHour: 5, Score: 20}
+
+	for hour, want := range map[int]bool{21: false, 22: true, 2: true, 5: false, 12: false} {
+		at := time.Date(2024, 1, 1, hour, 30, 0, 0, time.UTC)
+		if _, _, got := rule.Evaluate(nil, risk.Transfer{At: at}); got != want {
+			t.Errorf("Hour %d: expected match %v, got %v", hour, want, got)
+		}
+	}
+}
+
+func TestRiskRoundTripGoesToReview(t *testing.T) {
+	transferService, clock := setupRisk([]risk.Rule{risk.RoundTripRule{Window: 24 * time.Hour, Score: 60}},
+		service.WithApprovals(10000, time.Hour))
+
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 100}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+
+	result, err := transferService.TransferContext(as("jane"), service.TransferRequest{From: "Jane", To: "Mark", Amount: 100})
+	if !errors.Is(err, service.ErrApprovalRequired) {
+		t.Fatalf("Expected the round trip to await review, got %v", err)
+	}
+	if names := ruleNames(result.Risk); len(names) != 1 || names[0] != "round_trip" || result.Risk.Decision != service.RiskReview {
+		t.Errorf("Expected the round_trip rule on the result, got %+v", result.Risk)
+	}
+
+	approval, err := transferService.Approval(result.ApprovalID)
+	if err != nil || approval.Risk == nil || approval.Risk.Score != 60 {
+		t.Fatalf("Expected the assessment on the approval, got %+v, %v", approval, err)
+	}
+
+	// Approving executes without scoring the transfer again
+	if _, _, err := transferService.Approve(as("checker"), result.ApprovalID, "known refund"); err != nil {
+		t.Errorf("Expected the reviewed transfer to execute, got %v", err)
+	}
+}
+
+func TestRiskBlocksHighScores(t *testing.T) {
+	transferService, _ := setupRisk([]risk.Rule{
+		risk.NewCounterpartyRule{MinAmount: 1000, Score: 40},
+		risk.UnusualHourRule{StartHour: 0, EndHour: 24, Score: 40},
+	})
+
+	result, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 2000})
+	if !errors.Is(err, service.ErrTransferBlocked) || service.ErrorCode(err) != "risk_blocked" {
+		t.Fatalf("Expected the transfer to be blocked, got %v", err)
+	}
+	if result.Risk == nil || result.Risk.Score != 80 || len(result.Risk.Rules) != 2 {
+		t.Errorf("Expected both rules on the blocked transfer, got %+v", result.Risk)
+	}
+}
+
+func TestRiskReviewWithoutApprovalsBlocks(t *testing.T) {
+	transferService, _ := setupRisk([]risk.Rule{risk.NewCounterpartyRule{MinAmount: 1000, Score: 60}})
+
+	result, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 2000})
+	if !errors.Is(err, service.ErrTransferBlocked) || result.Risk.Decision != service.RiskBlock {
+		t.Errorf("Expected review to fail closed without approvals, got %v (%+v)", err, result.Risk)
+	}
+}
+
+func TestRiskAssessmentInTransferResponse(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+	engine := risk.NewEngine(50, 80, []risk.Rule{risk.NewCounterpartyRule{MinAmount: 1, Score: 10}})
+	router := api.NewAPI(service.NewTransferService(accountStore, service.WithRiskEngine(engine)), accountStore).SetupRoutes()
+
+	rr := doAuth(router, "POST", "/transfer", "", `{"from": "Mark", "to": "Jane", "amount": 5}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected a low score to be allowed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result service.TransferResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Risk == nil || result.Risk.Decision != service.RiskAllow || result.Risk.Score != 10 {
+		t.Errorf("Expected the assessment in the response, got %+v", result.Risk)
+	}
+}
@@ -0,0 +1,332 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+	"money-transfer-system/screening"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// testWatchlist lists one person with an alias and one company
+func testWatchlist() *screening.Watchlist {
+	return screening.NewWatchlist([]screening.Entry{
+		{ID: "SDN-1", Name: "Ivan Petrov", Aliases: []string{"Vanya Petrov"}, Program: "TEST"},
+		{ID: "SDN-2", Name: "Acme Trading LLC", Program: "TEST"},
+	})
+}
+
+// setupScreening creates a service screening against the test watchlist,
+// with accounts for clean and listed parties
+func setupScreening() (*service.TransferService, *screening.Screener, *store.InMemoryStore) {
+	accountStore := store.NewInMemoryStore()
+	for _, username := range []string{"Mark", "Jane", "ivan.petrov", "ivan.petrow", "ivan_petrova"} {
+		accountStore.CreateAccount(username, 100)
+	}
+
+	screener := screening.NewScreener(testWatchlist(), accountStore)
+	return service.NewTransferService(accountStore, service.WithScreener(screener)), screener, accountStore
+}
+
+func TestScreeningNormalize(t *testing.T) {
+	for _, name := range []string{"Ivan Petrov", "Petrov, Iván", "ivan.petrov", "  IVAN   PETROV "} {
+		if got := screening.Normalize(name); got != "ivan petrov" {
+			t.Errorf("Normalize(%q) = %q, expected %q", name, got, "ivan petrov")
+		}
+	}
+}
+
+func TestScreeningFuzzyMatch(t *testing.T) {
+	watchlist := testWatchlist()
+
+	cases := []struct {
+		name  string
+		entry string
+		exact bool
+	}{
+		{"petrov_ivan", "SDN-1", true},
+		{"IvanPetrov", "SDN-1", true},
+		{"vanya.petrov", "SDN-1", true},
+		{"acme-trading-llc", "SDN-2", true},
+		{"ivan.petrow", "SDN-1", false},
+	}
+	for _, tc := range cases {
+		match, ok := watchlist.Best(tc.name)
+		if !ok || match.Entry.ID != tc.entry {
+			t.Errorf("%s: expected a match with %s, got %+v", tc.name, tc.entry, match)
+			continue
+		}
+		if exact := match.Score == 1; exact != tc.exact || match.Score < 0.85 {
+			t.Errorf("%s: unexpected score %v", tc.name, match.Score)
+		}
+	}
+
+	if match, _ := watchlist.Best("Jane"); match.Score >= 0.85 {
+		t.Errorf("Expected an unrelated name to score low, got %+v", match)
+	}
+}
+
+func TestScreeningBlocksListedParty(t *testing.T) {
+	transferService, screener, _ := setupScreening()
+
+	result, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "ivan.petrov", Amount: 10})
+	if !errors.Is(err, service.ErrSanctioned) || service.ErrorCode(err) != "sanctioned" || result.Success {
+		t.Fatalf("Expected a transfer to a listed party to be refused, got %v", err)
+	}
+
+	hits := screener.Hits(screening.HitConfirmed)
+	if len(hits) != 1 || hits[0].Party != "ivan.petrov" || hits[0].Source != screening.SourceTransfer {
+		t.Fatalf("Expected one confirmed hit, got %+v", hits)
+	}
+
+	// Exact matches are decided already and cannot be cleared
+	if _, err := screener.Clear(as("officer"), hits[0].ID, "same name"); !errors.Is(err, screening.ErrHitClosed) {
+		t.Errorf("Expected ErrHitClosed clearing a confirmed hit, got %v", err)
+	}
+}
+
+func TestScreeningClearReleasesParty(t *testing.T) {
+	transferService, screener, _ := setupScreening()
+	req := service.TransferRequest{From: "ivan.petrow", To: "Jane", Amount: 10}
+
+	_, err := transferService.Transfer(req)
+	if !errors.Is(err, service.ErrScreeningPending) || service.ErrorCode(err) != "screening_review" {
+		t.Fatalf("Expected a potential match to await review, got %v", err)
+	}
+	// The party is screened once and stays pending until reviewed
+	if _, err := transferService.Transfer(req); !errors.Is(err, service.ErrScreeningPending) {
+		t.Fatalf("Expected the party to stay pending, got %v", err)
+	}
+	hits := screener.Hits(screening.HitPending)
+	if len(hits) != 1 {
+		t.Fatalf("Expected one pending hit, got %+v", hits)
+	}
+
+	if _, err := screener.Clear(as("officer"), hits[0].ID, ""); !errors.Is(err, service.ErrReasonRequired) {
+		t.Errorf("Expected a reason to be required, got %v", err)
+	}
+	hit, err := screener.Clear(as("officer"), hits[0].ID, "different date of birth")
+	if err != nil || hit.Status != screening.HitCleared || hit.DecidedBy != "officer" {
+		t.Fatalf("Expected the hit to be cleared by the officer, got %+v, %v", hit, err)
+	}
+
+	if _, err := transferService.Transfer(req); err != nil {
+		t.Errorf("Expected a cleared party to transfer, got %v", err)
+	}
+}
+
+func TestScreeningCache(t *testing.T) {
+	screener := screening.NewScreener(testWatchlist(), store.NewInMemoryStore(), screening.WithCacheSize(10))
+
+	// Concurrent checks of a new party share one match and one hit
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := screener.Screen(context.Background(), "ivan.petrow"); !errors.Is(err, service.ErrScreeningPending) {
+				t.Errorf("Expected a potential match to await review, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	hits := screener.Hits(screening.HitPending)
+	if len(hits) != 1 {
+		t.Fatalf("Expected one pending hit, got %+v", hits)
+	}
+
+	// Clean parties are remembered up to twice the cache size; hits are kept
+	for i := 0; i < 100; i++ {
+		if err := screener.Screen(context.Background(), fmt.Sprintf("customer%d", i)); err != nil {
+			t.Fatalf("Expected a clean party to pass, got %v", err)
+		}
+	}
+	if cached := screener.Cached(); cached > 21 {
+		t.Errorf("Expected the cache to stay bounded, got %d parties", cached)
+	}
+	if err := screener.Screen(context.Background(), "ivan.petrow"); !errors.Is(err, service.ErrScreeningPending) {
+		t.Errorf("Expected the hit to be remembered, got %v", err)
+	}
+	if hits := screener.Hits(""); len(hits) != 1 {
+		t.Errorf("Expected the party not to be screened again, got %+v", hits)
+	}
+}
+
+func TestScreeningConfirmFreezesAccount(t *testing.T) {
+	transferService, screener, accountStore := setupScreening()
+
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "ivan_petrova", Amount: 10}); !errors.Is(err, service.ErrScreeningPending) {
+		t.Fatalf("Expected a potential match to await review, got %v", err)
+	}
+	hits := screener.Hits(screening.HitPending)
+	if len(hits) != 1 {
+		t.Fatalf("Expected one pending hit, got %+v", hits)
+	}
+
+	if _, err := screener.Confirm(as("officer"), hits[0].ID, "passport matches"); err != nil {
+		t.Fatal(err)
+	}
+	account, _ := accountStore.GetAccount("ivan_petrova")
+	if account.Status() != service.StatusFrozen {
+		t.Errorf("Expected the confirmed party's account to be frozen, got %v", account.Status())
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "ivan_petrova", Amount: 10}); err == nil {
+		t.Error("Expected transfers to a confirmed party to be refused")
+	}
+}
+
+func TestScreeningAccountCreation(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	screener := screening.NewScreener(testWatchlist(), accountStore)
+	accountManager := screening.NewAccountManager(accountStore, screener)
+	ctx := context.Background()
+
+	if _, err := accountManager.CreateAccountContext(ctx, "ivan.petrov", 0); !errors.Is(err, service.ErrSanctioned) {
+		t.Errorf("Expected a listed party to be refused an account, got %v", err)
+	}
+	if _, err := accountStore.GetAccount("ivan.petrov"); err == nil {
+		t.Error("Expected no account for a listed party")
+	}
+
+	// A potential match opens a frozen account until the hit is reviewed
+	account, err := accountManager.CreateAccountContext(ctx, "ivan-petrow", 50)
+	if err != nil || account.Status() != service.StatusFrozen {
+		t.Fatalf("Expected a frozen account for a potential match, got %v", err)
+	}
+	hits := screener.Hits(screening.HitPending)
+	if len(hits) != 1 || !hits[0].Frozen || hits[0].Source != screening.SourceAccountCreation {
+		t.Fatalf("Expected a pending hit that froze the account, got %+v", hits)
+	}
+
+	if _, err := screener.Clear(as("officer"), hits[0].ID, "different person"); err != nil {
+		t.Fatal(err)
+	}
+	if account.Status() != service.StatusActive {
+		t.Errorf("Expected clearing the hit to unfreeze the account, got %v", account.Status())
+	}
+}
+
+func TestScreeningAPI(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	screener := screening.NewScreener(testWatchlist(), accountStore)
+	accountManager := screening.NewAccountManager(accountStore, screener)
+
+	keys := auth.NewKeyStore()
+	support, _, _ := keys.Issue(auth.Key{ID: "support", Roles: []auth.Role{auth.RoleSupport}})
+	compliance, _, _ := keys.Issue(auth.Key{ID: "compliance", Roles: []auth.Role{auth.RoleCompliance}})
+
+	transferService := service.NewTransferService(accountStore, service.WithScreener(screener))
+	router := api.NewAPI(transferService, accountManager, api.WithKeyStore(keys), api.WithScreener(screener), api.WithAccountCreation(true)).SetupRoutes()
+
+	rr := doAuth(router, "POST", "/accounts", support, `{"username": "ivan.petrov"}`)
+	if rr.Code != http.StatusForbidden || errorCode(t, rr) != "sanctioned" {
+		t.Errorf("Expected status 403 creating a listed party's account, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", "/accounts", support, `{"username": "ivan.petrow"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected a potential match to get an account, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doAuth(router, "GET", "/screening/hits", support, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected support to be denied the review queue, got %v", rr.Code)
+	}
+	rr = doAuth(router, "GET", "/screening/hits?status=pending", compliance, "")
+	var hits []screening.Hit
+	if err := json.Unmarshal(rr.Body.Bytes(), &hits); err != nil || len(hits) != 1 {
+		t.Fatalf("Expected one pending hit, got %s", rr.Body.String())
+	}
+	path := "/screening/hits/" + hits[0].ID
+
+	if rr := doAuth(router, "GET", path, compliance, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 reading a hit, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", path+"/clear", compliance, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 clearing without a reason, got %v", rr.Code)
+	}
+	if rr := doAuth(router, "POST", path+"/confirm", compliance, `{"reason": "matches"}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 confirming a hit, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", path+"/clear", compliance, `{"reason": "mistake"}`); rr.Code != http.StatusConflict || errorCode(t, rr) != "hit_closed" {
+		t.Errorf("Expected status 409 deciding a closed hit, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "GET", "/screening/hits/scr_missing", compliance, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing hit, got %v", rr.Code)
+	}
+}
+
+func TestScreeningHolderDisplayName(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	screener := screening.NewScreener(testWatchlist(), accountStore)
+	accountManager := screening.NewAccountManager(accountStore, screener)
+
+	keys := auth.NewKeyStore()
+	support, _, _ := keys.Issue(auth.Key{ID: "support", Roles: []auth.Role{auth.RoleSupport}})
+	router := api.NewAPI(service.NewTransferService(accountStore), accountManager, api.WithKeyStore(keys), api.WithAccountCreation(true)).SetupRoutes()
+
+	rr := doAuth(router, "POST", "/accounts", support, `{"username": "shop", "display_name": "Acme Trading LLC", "type": "business"}`)
+	if rr.Code != http.StatusForbidden || errorCode(t, rr) != "sanctioned" {
+		t.Errorf("Expected a listed display name to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := accountStore.GetAccount("shop"); err == nil {
+		t.Error("Expected no account to be stored for a listed display name")
+	}
+
+	if rr := doAuth(router, "POST", "/accounts", support, `{"username": "Mark", "display_name": "Mark Smith"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body.String())
+	}
+	rr = doAuth(router, "PUT", "/accounts/Mark/profile", support, `{"display_name": "Acme Trading LLC"}`)
+	if rr.Code != http.StatusForbidden || errorCode(t, rr) != "sanctioned" {
+		t.Errorf("Expected renaming to a listed party to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+	mark, _ := accountStore.GetAccount("Mark")
+	if name := mark.GetProfile().DisplayName; name != "Mark Smith" {
+		t.Errorf("Expected the refused name not to be saved, got %q", name)
+	}
+
+	// A potential match freezes the account until the hit is reviewed
+	if rr := doAuth(router, "PUT", "/accounts/Mark/profile", support, `{"display_name": "Ivan Petrow"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v: %s", rr.Code, rr.Body.String())
+	}
+	hits := screener.Hits(screening.HitPending)
+	if mark.Status() != service.StatusFrozen || len(hits) != 1 || hits[0].Account != "Mark" {
+		t.Fatalf("Expected a pending hit that froze Mark, got %v and %+v", mark.Status(), hits)
+	}
+	if _, err := screener.Clear(as("officer"), hits[0].ID, "different person"); err != nil {
+		t.Fatal(err)
+	}
+	if mark.Status() != service.StatusActive {
+		t.Errorf("Expected clearing the hit to unfreeze Mark, got %v", mark.Status())
+	}
+}
+
+func TestScreeningSeed(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountManager := screening.NewAccountManager(accountStore, screening.NewScreener(testWatchlist(), accountStore))
+
+	err := store.Seed(accountManager, []store.AccountFixture{
+		{Username: "Mark", Balance: 100},
+		{Username: "shop", DisplayName: "Acme Trading LLC", Type: service.TypeBusiness},
+	})
+	if !errors.Is(err, service.ErrSanctioned) {
+		t.Errorf("Expected seeding a listed display name to fail, got %v", err)
+	}
+	if _, err := accountStore.GetAccount("shop"); err == nil {
+		t.Error("Expected no account to be seeded for a listed display name")
+	}
+
+	// Screening keeps a potential match frozen even if the fixture says active
+	err = store.Seed(accountManager, []store.AccountFixture{{Username: "cafe", DisplayName: "Ivan Petrow", Status: service.StatusActive}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cafe, _ := accountStore.GetAccount("cafe"); cafe.Status() != service.StatusFrozen {
+		t.Errorf("Expected the seeded account to be frozen, got %v", cafe.Status())
+	}
+}
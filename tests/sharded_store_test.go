@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+func TestShardedStoreBasicOperations(t *testing.T) {
+	// Setup
+	accountStore := store.NewShardedStore(8)
+
+	if _, err := accountStore.CreateAccount("Mark", 100); err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+
+	// Duplicate usernames are rejected
+	if _, err := accountStore.CreateAccount("Mark", 50); err != service.ErrAccountExists {
+		t.Errorf("Expected ErrAccountExists, got: %v", err)
+	}
+
+	account, err := accountStore.GetAccount("Mark")
+	if err != nil {
+		t.Fatalf("Expected account, got error: %v", err)
+	}
+
+	if account.GetBalance() != 100 {
+		t.Errorf("Expected balance 100, got %v", account.GetBalance())
+	}
+
+	if _, err := accountStore.GetAccount("Nobody"); err != service.ErrAccountNotFound {
+		t.Errorf("Expected ErrAccountNotFound, got: %v", err)
+	}
+}
+
+func TestShardedStoreDefaultShardCount(t *testing.T) {
+	accountStore := store.NewShardedStore(0)
+
+	if accountStore.ShardCount() != store.DefaultShardCount {
+		t.Errorf("Expected %d shards, got %d", store.DefaultShardCount, accountStore.ShardCount())
+	}
+}
+
+func TestShardedStoreConcurrentCreateAndTransfer(t *testing.T) {
+	// Setup
+	accountStore := store.NewShardedStore(16)
+	transferService := service.NewTransferService(accountStore)
+
+	numAccounts := 200
+	var wg sync.WaitGroup
+	wg.Add(numAccounts)
+
+	// Create accounts concurrently
+	for i := 0; i < numAccounts; i++ {
+		go func(i int) {
+			defer wg.Done()
+			accountStore.CreateAccount(fmt.Sprintf("user-%d", i), 100)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(accountStore.ListAccounts()) != numAccounts {
+		t.Fatalf("Expected %d accounts, got %d", numAccounts, len(accountStore.ListAccounts()))
+	}
+
+	// Transfer around a ring while reading concurrently
+	wg.Add(numAccounts * 2)
+	for i := 0; i < numAccounts; i++ {
+		go func(i int) {
+			defer wg.Done()
+			transferService.Transfer(service.TransferRequest{
+				From:   fmt.Sprintf("user-%d", i),
+				To:     fmt.Sprintf("user-%d", (i+1)%numAccounts),
+				Amount: 10,
+			})
+		}(i)
+
+		go func(i int) {
+			defer wg.Done()
+			accountStore.GetAccount(fmt.Sprintf("user-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	var total float64
+	for _, account := range accountStore.ListAccounts() {
+		total += account.GetBalance()
+	}
+
+	if total != float64(numAccounts*100) {
+		t.Errorf("Expected total balance=%d, got %v", numAccounts*100, total)
+	}
+}
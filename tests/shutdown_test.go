@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// blockingManager blocks account lookups until released, keeping transfers in flight
+type blockingManager struct {
+	service.AccountManager
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (m *blockingManager) GetAccount(username string) (*service.Account, error) {
+	m.once.Do(func() {
+		close(m.entered)
+		<-m.release
+	})
+	return m.AccountManager.GetAccount(username)
+}
+
+func TestDrainWaitsForInFlightTransfers(t *testing.T) {
+	// Setup
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	manager := &blockingManager{AccountManager: accountStore, entered: make(chan struct{}), release: make(chan struct{})}
+	transferService := service.NewTransferService(manager)
+
+	// Start a transfer that stays in flight until released
+	inFlight := make(chan error, 1)
+	go func() {
+		_, err := transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 10})
+		inFlight <- err
+	}()
+	<-manager.entered
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- transferService.Drain(context.Background())
+	}()
+
+	// New transfers are rejected once draining starts
+	for !transferService.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := transferService.Transfer(service.TransferRequest{From: "Jane", To: "Mark", Amount: 5}); err != service.ErrShuttingDown {
+		t.Errorf("Expected ErrShuttingDown, got: %v", err)
+	}
+
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while a transfer was still in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Releasing the in-flight transfer lets it complete and the drain finish
+	close(manager.release)
+	if err := <-inFlight; err != nil {
+		t.Errorf("Expected in-flight transfer to succeed, got: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("Expected drain to finish, got: %v", err)
+	}
+
+	mark, _ := accountStore.GetAccount("Mark")
+	if mark.GetBalance() != 90 {
+		t.Errorf("Expected Mark balance=90, got %v", mark.GetBalance())
+	}
+}
+
+func TestDrainHonoursDeadline(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	manager := &blockingManager{AccountManager: accountStore, entered: make(chan struct{}), release: make(chan struct{})}
+	defer close(manager.release)
+	transferService := service.NewTransferService(manager)
+
+	go transferService.Transfer(service.TransferRequest{From: "Mark", To: "Jane", Amount: 10})
+	<-manager.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := transferService.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestReadinessDuringDrain(t *testing.T) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+	transferService := service.NewTransferService(accountStore)
+	router := api.NewAPI(transferService, accountStore).SetupRoutes()
+
+	get := func(path string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected ready before drain, got %v", code)
+	}
+
+	transferService.Drain(context.Background())
+
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 during drain, got %v", code)
+	}
+}
@@ -0,0 +1,342 @@
+package tests
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+var (
+	simSeed  = flag.Int64("sim.seed", 0, "replay a single simulation seed (0 runs the default seed range)")
+	simSeeds = flag.Int("sim.seeds", 25, "number of seeds to run when -sim.seed is not set")
+	simSteps = flag.Int("sim.steps", 200, "number of steps per simulation")
+)
+
+// errInjected is returned by the fault-injecting account manager
+var errInjected = errors.New("injected lookup failure")
+
+// simOpKind is the kind of operation performed by the simulator
+type simOpKind int
+
+const (
+	opTransfer simOpKind = iota
+	opDeposit
+	opWithdraw
+)
+
+func (k simOpKind) String() string {
+	return [...]string{"transfer", "deposit", "withdraw"}[k]
+}
+
+// simOp is a single recorded operation and its outcome
+type simOp struct {
+	Step       int
+	Kind       simOpKind
+	From       string
+	To         string
+	Amount     float64
+	FailLookup bool
+	Yields     int
+	Err        error
+}
+
+func (op simOp) String() string {
+	return fmt.Sprintf("step=%d %s from=%s to=%s amount=%v inject=%v yields=%d err=%v",
+		op.Step, op.Kind, op.From, op.To, op.Amount, op.FailLookup, op.Yields, op.Err)
+}
+
+// faultyManager wraps an account manager and injects lookup failures and
+// scheduler yields. Lookup failures are armed for a single serial operation;
+// yields are configured per username so concurrent batches interleave differently.
+type faultyManager struct {
+	service.AccountManager
+
+	mutex    sync.Mutex
+	failNext bool
+	yields   map[string]int
+}
+
+func (m *faultyManager) GetAccount(username string) (*service.Account, error) {
+	m.mutex.Lock()
+	fail := m.failNext
+	m.failNext = false
+	yields := m.yields[username]
+	m.mutex.Unlock()
+
+	// Yield between lookup and locking to widen race windows
+	for i := 0; i < yields; i++ {
+		runtime.Gosched()
+	}
+
+	if fail {
+		return nil, errInjected
+	}
+
+	return m.AccountManager.GetAccount(username)
+}
+
+// simulation drives a TransferService with a reproducible workload and checks
+// invariants against a sequential model after every step
+type simulation struct {
+	t        *testing.T
+	seed     int64
+	rng      *rand.Rand
+	store    *store.InMemoryStore
+	manager  *faultyManager
+	service  *service.TransferService
+	users    []string
+	model    map[string]float64
+	expected float64
+	history  []simOp
+}
+
+func newSimulation(t *testing.T, seed int64) *simulation {
+	rng := rand.New(rand.NewSource(seed))
+	accountStore := store.NewInMemoryStore()
+	manager := &faultyManager{AccountManager: accountStore, yields: make(map[string]int)}
+
+	sim := &simulation{
+		t:       t,
+		seed:    seed,
+		rng:     rng,
+		store:   accountStore,
+		manager: manager,
+		service: service.NewTransferService(manager),
+		model:   make(map[string]float64),
+	}
+
+	numUsers := 3 + rng.Intn(6)
+	for i := 0; i < numUsers; i++ {
+		username := fmt.Sprintf("sim%d", i)
+		balance := float64(rng.Intn(200))
+		account, _ := accountStore.CreateAccount(username, balance)
+
+		// Some accounts take credits through hot sub-balances
+		if rng.Intn(3) == 0 {
+			account.EnableHotCredits(1 + rng.Intn(4))
+		}
+
+		sim.users = append(sim.users, username)
+		sim.model[username] = balance
+		sim.expected += balance
+	}
+
+	return sim
+}
+
+// randomOp generates the next operation, including deliberately invalid ones
+func (s *simulation) randomOp(step int) simOp {
+	op := simOp{
+		Step:   step,
+		From:   s.users[s.rng.Intn(len(s.users))],
+		To:     s.users[s.rng.Intn(len(s.users))],
+		Amount: float64(s.rng.Intn(60)),
+		Yields: s.rng.Intn(4),
+	}
+
+	switch r := s.rng.Intn(20); {
+	case r == 0:
+		op.Kind = opDeposit
+	case r == 1:
+		op.Kind = opWithdraw
+	default:
+		op.Kind = opTransfer
+	}
+
+	switch s.rng.Intn(25) {
+	case 0:
+		op.From = "ghost"
+	case 1:
+		op.Amount = -op.Amount
+	case 2:
+		op.FailLookup = true
+	}
+
+	return op
+}
+
+// apply executes the operation against the real system
+func (s *simulation) apply(op simOp) error {
+	switch op.Kind {
+	case opDeposit, opWithdraw:
+		account, err := s.manager.GetAccount(op.From)
+		if err != nil {
+			return err
+		}
+		if op.Kind == opDeposit {
+			return account.Deposit(op.Amount)
+		}
+		return account.Withdraw(op.Amount)
+	default:
+		_, err := s.service.Transfer(service.TransferRequest{From: op.From, To: op.To, Amount: op.Amount})
+		return err
+	}
+}
+
+// record folds a completed operation into the sequential model
+func (s *simulation) record(op simOp) {
+	s.history = append(s.history, op)
+	if op.Err != nil {
+		return
+	}
+
+	switch op.Kind {
+	case opDeposit:
+		s.model[op.From] += op.Amount
+		s.expected += op.Amount
+	case opWithdraw:
+		s.model[op.From] -= op.Amount
+		s.expected -= op.Amount
+	default:
+		s.model[op.From] -= op.Amount
+		s.model[op.To] += op.Amount
+	}
+}
+
+// checkInvariants verifies conservation of money, non-negative balances and
+// that every account matches the model built from the successful operations
+func (s *simulation) checkInvariants() {
+	var total float64
+	for _, username := range s.users {
+		account, err := s.store.GetAccount(username)
+		if err != nil {
+			s.fail("account %s disappeared: %v", username, err)
+		}
+
+		balance := account.GetBalance()
+		total += balance
+
+		if balance < 0 {
+			s.fail("negative balance for %s: %v", username, balance)
+		}
+
+		if balance != s.model[username] {
+			s.fail("lost update on %s: expected %v, got %v", username, s.model[username], balance)
+		}
+	}
+
+	if total != s.expected {
+		s.fail("money not conserved: expected total %v, got %v", s.expected, total)
+	}
+}
+
+// fail reports the seed and the tail of the operation history for replay
+func (s *simulation) fail(format string, args ...interface{}) {
+	s.t.Helper()
+
+	start := len(s.history) - 10
+	if start < 0 {
+		start = 0
+	}
+
+	var tail strings.Builder
+	for _, op := range s.history[start:] {
+		tail.WriteString("\n  " + op.String())
+	}
+
+	s.t.Fatalf("%s\nreplay with: go test ./tests -run TestDeterministicSimulation -sim.seed=%d\nlast operations:%s",
+		fmt.Sprintf(format, args...), s.seed, tail.String())
+}
+
+// runSerialStep executes a batch of operations one at a time in a
+// seed-chosen order, checking invariants after each operation
+func (s *simulation) runSerialStep(step int) {
+	batch := make([]simOp, 1+s.rng.Intn(4))
+	for i := range batch {
+		batch[i] = s.randomOp(step)
+	}
+
+	for _, i := range s.rng.Perm(len(batch)) {
+		op := batch[i]
+		s.manager.mutex.Lock()
+		s.manager.failNext = op.FailLookup
+		s.manager.mutex.Unlock()
+
+		op.Err = s.apply(op)
+		s.record(op)
+		s.checkInvariants()
+	}
+}
+
+// runConcurrentStep executes a batch of operations concurrently with
+// seed-chosen yields between lookup and locking, then checks invariants.
+// The workload is reproducible; the exact goroutine interleaving is not.
+func (s *simulation) runConcurrentStep(step int) {
+	batch := make([]simOp, 2+s.rng.Intn(8))
+	s.manager.mutex.Lock()
+	for i := range batch {
+		batch[i] = s.randomOp(step)
+		batch[i].FailLookup = false
+		s.manager.yields[batch[i].From] = batch[i].Yields
+	}
+	s.manager.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(batch))
+	for i := range batch {
+		go func(op *simOp) {
+			defer wg.Done()
+			op.Err = s.apply(*op)
+		}(&batch[i])
+	}
+	wg.Wait()
+
+	for _, op := range batch {
+		s.record(op)
+	}
+	s.checkInvariants()
+}
+
+func (s *simulation) run(steps int) {
+	for step := 0; step < steps; step++ {
+		if s.rng.Intn(4) == 0 {
+			s.runConcurrentStep(step)
+		} else {
+			s.runSerialStep(step)
+		}
+	}
+}
+
+func TestDeterministicSimulation(t *testing.T) {
+	seeds := make([]int64, 0, *simSeeds)
+	if *simSeed != 0 {
+		seeds = append(seeds, *simSeed)
+	} else {
+		for i := 1; i <= *simSeeds; i++ {
+			seeds = append(seeds, int64(i))
+		}
+	}
+
+	for _, seed := range seeds {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			newSimulation(t, seed).run(*simSteps)
+		})
+	}
+}
+
+func TestSimulationIsReproducible(t *testing.T) {
+	// Serial steps only, so histories from the same seed must match exactly
+	a, b := newSimulation(t, 42), newSimulation(t, 42)
+	for step := 0; step < 50; step++ {
+		a.runSerialStep(step)
+		b.runSerialStep(step)
+	}
+
+	if len(a.history) != len(b.history) {
+		t.Fatalf("Expected identical history lengths, got %d and %d", len(a.history), len(b.history))
+	}
+
+	for i := range a.history {
+		if a.history[i].String() != b.history[i].String() {
+			t.Fatalf("Histories diverge at %d:\n  %v\n  %v", i, a.history[i], b.history[i])
+		}
+	}
+}
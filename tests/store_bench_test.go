@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+)
+
+// benchAccounts is the number of accounts preloaded into each benchmark store
+const benchAccounts = 1 << 20
+
+var (
+	benchStoresMu sync.Mutex
+	benchStores   = make(map[string]service.AccountManager)
+)
+
+// preloadedStore returns a store holding benchAccounts accounts. Stores are
+// cached by name because populating millions of accounts dominates setup time.
+func preloadedStore(b *testing.B, name string, newStore func() service.AccountManager) service.AccountManager {
+	b.Helper()
+
+	benchStoresMu.Lock()
+	defer benchStoresMu.Unlock()
+
+	if s, ok := benchStores[name]; ok {
+		return s
+	}
+
+	s := newStore()
+	for i := 0; i < benchAccounts; i++ {
+		if _, err := s.CreateAccount(benchUsername(i), 1000); err != nil {
+			b.Fatalf("Failed to preload account %d: %v", i, err)
+		}
+	}
+	benchStores[name] = s
+
+	return s
+}
+
+func benchUsername(i int) string {
+	return fmt.Sprintf("user-%d", i)
+}
+
+// benchStoreFactories lists the store configurations compared by the benchmarks
+var benchStoreFactories = []struct {
+	name     string
+	newStore func() service.AccountManager
+}{
+	{"InMemory", func() service.AccountManager { return store.NewInMemoryStore() }},
+	{"Sharded16", func() service.AccountManager { return store.NewShardedStore(16) }},
+	{"Sharded64", func() service.AccountManager { return store.NewShardedStore(64) }},
+	{"Sharded256", func() service.AccountManager { return store.NewShardedStore(256) }},
+}
+
+func BenchmarkStoreGetAccount(b *testing.B) {
+	for _, f := range benchStoreFactories {
+		b.Run(f.name, func(b *testing.B) {
+			s := preloadedStore(b, f.name, f.newStore)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					s.GetAccount(benchUsername(r.Intn(benchAccounts)))
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkStoreMixedLoad(b *testing.B) {
+	for _, f := range benchStoreFactories {
+		b.Run(f.name, func(b *testing.B) {
+			s := preloadedStore(b, f.name, f.newStore)
+			transferService := service.NewTransferService(s)
+
+			// New accounts get unique names so creates never collide between runs
+			var created int64
+			prefix := fmt.Sprintf("mixed-%d-", b.N)
+			b.ResetTimer()
+
+			// 10% creates, 70% reads, 20% transfers
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					switch op := r.Intn(10); {
+					case op == 0:
+						n := atomic.AddInt64(&created, 1)
+						s.CreateAccount(fmt.Sprintf("%s%d", prefix, n), 0)
+					case op < 8:
+						s.GetAccount(benchUsername(r.Intn(benchAccounts)))
+					default:
+						transferService.Transfer(service.TransferRequest{
+							From:   benchUsername(r.Intn(benchAccounts)),
+							To:     benchUsername(r.Intn(benchAccounts)),
+							Amount: 1,
+						})
+					}
+				}
+			})
+		})
+	}
+}
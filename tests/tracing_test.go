@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"money-transfer-system/api"
+	"money-transfer-system/service"
+	"money-transfer-system/store"
+	"money-transfer-system/tracing"
+)
+
+// setupTracedAPI creates a router whose spans are recorded in memory
+func setupTracedAPI() (http.Handler, *tracing.MemoryExporter) {
+	accountStore := store.NewInMemoryStore()
+	accountStore.CreateAccount("Mark", 100)
+	accountStore.CreateAccount("Jane", 50)
+
+	exporter := &tracing.MemoryExporter{}
+	tracer := tracing.NewTracer(exporter)
+	transferService := service.NewTransferService(accountStore, service.WithTracer(tracer))
+	router := api.NewAPI(transferService, accountStore, api.WithTracer(tracer)).SetupRoutes()
+	return router, exporter
+}
+
+func TestTransferSpanHierarchy(t *testing.T) {
+	router, exporter := setupTracedAPI()
+
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"from": "Mark", "to": "Jane", "amount": 10}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", rr.Code)
+	}
+
+	spans := exporter.Spans()
+	byName := make(map[string][]tracing.SpanData)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+
+	for name, count := range map[string]int{
+		"POST /transfer":            1,
+		"TransferHandler":           1,
+		"TransferService.Transfer":  1,
+		"AccountManager.GetAccount": 2,
+		"Account.Lock":              2,
+	} {
+		if got := len(byName[name]); got != count {
+			t.Fatalf("Expected %d %q spans, got %d (%+v)", count, name, got, spans)
+		}
+	}
+
+	server := byName["POST /transfer"][0]
+	handler := byName["TransferHandler"][0]
+	transfer := byName["TransferService.Transfer"][0]
+
+	if server.ParentID != "" {
+		t.Errorf("Expected the server span to be a root span, got parent %s", server.ParentID)
+	}
+	if handler.ParentID != server.SpanID {
+		t.Errorf("Expected TransferHandler to be a child of the server span")
+	}
+	if transfer.ParentID != handler.SpanID {
+		t.Errorf("Expected TransferService.Transfer to be a child of TransferHandler")
+	}
+	for _, name := range []string{"AccountManager.GetAccount", "Account.Lock"} {
+		for _, span := range byName[name] {
+			if span.ParentID != transfer.SpanID {
+				t.Errorf("Expected %s to be a child of TransferService.Transfer", name)
+			}
+		}
+	}
+	for _, span := range spans {
+		if span.TraceID != server.TraceID {
+			t.Errorf("Expected every span to share trace %s, %s has %s", server.TraceID, span.Name, span.TraceID)
+		}
+	}
+
+	for _, span := range byName["Account.Lock"] {
+		if _, ok := span.Attributes["lock.wait_ms"]; !ok {
+			t.Errorf("Expected Account.Lock span to record lock.wait_ms, got %v", span.Attributes)
+		}
+	}
+	if outcome := transfer.Attributes["transfer.outcome"]; outcome != "success" {
+		t.Errorf("Expected transfer.outcome success, got %v", outcome)
+	}
+}
+
+func TestTransferSpanRecordsError(t *testing.T) {
+	router, exporter := setupTracedAPI()
+
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"from": "Mark", "to": "Jane", "amount": 1000}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, span := range exporter.Spans() {
+		if span.Name == "TransferService.Transfer" {
+			if span.Error != service.ErrInsufficientFunds.Error() {
+				t.Errorf("Expected span error %q, got %q", service.ErrInsufficientFunds, span.Error)
+			}
+			return
+		}
+	}
+	t.Fatal("Expected a TransferService.Transfer span")
+}
+
+func TestTraceparentPropagation(t *testing.T) {
+	router, exporter := setupTracedAPI()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+
+	req, _ := http.NewRequest("GET", "/accounts/Mark", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].TraceID != traceID {
+		t.Errorf("Expected trace ID %s, got %s", traceID, spans[0].TraceID)
+	}
+	if spans[0].ParentID != parentID {
+		t.Errorf("Expected parent ID %s, got %s", parentID, spans[0].ParentID)
+	}
+
+	// The response carries the server span so callers can correlate
+	expected := "00-" + traceID + "-" + spans[0].SpanID + "-01"
+	if got := rr.Header().Get("traceparent"); got != expected {
+		t.Errorf("Expected traceparent response header %s, got %s", expected, got)
+	}
+}
+
+func TestTraceparentNotSampled(t *testing.T) {
+	router, exporter := setupTracedAPI()
+
+	req, _ := http.NewRequest("GET", "/accounts/Mark", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Errorf("Expected no spans for an unsampled trace, got %d", len(spans))
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := tracing.ParseTraceparent(valid)
+	if err != nil {
+		t.Fatalf("Expected valid traceparent, got %v", err)
+	}
+	if !sc.Sampled {
+		t.Error("Expected sampled flag to be set")
+	}
+	if got := tracing.FormatTraceparent(sc); got != valid {
+		t.Errorf("Expected round trip to give %s, got %s", valid, got)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+	}
+	for _, value := range invalid {
+		if _, err := tracing.ParseTraceparent(value); err != tracing.ErrInvalidTraceparent {
+			t.Errorf("Expected %q to be rejected, got %v", value, err)
+		}
+	}
+}
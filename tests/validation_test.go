@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"money-transfer-system/api"
+	"money-transfer-system/auth"
+)
+
+// fieldCodes decodes a validation error and returns the code for each field
+func fieldCodes(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+
+	var resp api.ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("Failed to decode error envelope %q: %v", body, err)
+	}
+	if resp.Error.Code != "validation_failed" {
+		t.Fatalf("Expected error code validation_failed, got %s", resp.Error.Code)
+	}
+
+	codes := make(map[string]string)
+	for _, field := range resp.Error.Fields {
+		codes[field.Field] = field.Code
+	}
+	return codes
+}
+
+func TestTransferValidation(t *testing.T) {
+	router := setupTestAPI().SetupRoutes()
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{"missing fields", `{}`, map[string]string{"from": "required", "to": "required", "amount": "required"}},
+		{"null amount", `{"from": "Mark", "to": "Jane", "amount": null}`, map[string]string{"amount": "required"}},
+		{"bad usernames", `{"from": "Mark; DROP", "to": "-Jane", "amount": 1}`, map[string]string{"from": "invalid_format", "to": "invalid_format"}},
+		{"long username", `{"from": "` + strings.Repeat("a", 65) + `", "to": "Jane", "amount": 1}`, map[string]string{"from": "invalid_format"}},
+		{"huge amount", `{"from": "Mark", "to": "Jane", "amount": 1e308}`, map[string]string{"amount": "out_of_range"}},
+		{"overflowing amount", `{"from": "Mark", "to": "Jane", "amount": 1e309}`, map[string]string{"amount": "out_of_range"}},
+		{"negative amount", `{"from": "Mark", "to": "Jane", "amount": -5}`, map[string]string{"amount": "out_of_range"}},
+		{"zero amount", `{"from": "Mark", "to": "Jane", "amount": 0}`, map[string]string{"amount": "out_of_range"}},
+		{"underflowing amount", `{"from": "Mark", "to": "Jane", "amount": 1e-400}`, map[string]string{"amount": "out_of_range"}},
+		{"too precise", `{"from": "Mark", "to": "Jane", "amount": 0.001}`, map[string]string{"amount": "too_precise"}},
+		{"string amount", `{"from": "Mark", "to": "Jane", "amount": "10"}`, map[string]string{"amount": "invalid_type"}},
+		{"numeric username", `{"from": 12, "to": "Jane", "amount": 1}`, map[string]string{"from": "invalid_type"}},
+		{"unknown field", `{"from": "Mark", "to": "Jane", "amount": 1, "memo": "x"}`, map[string]string{"memo": "unknown_field"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAuth(router, "POST", "/transfer", "", tt.body)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			got := fieldCodes(t, rr.Body.Bytes())
+			if len(got) != len(tt.want) {
+				t.Errorf("Expected fields %v, got %v", tt.want, got)
+			}
+			for field, code := range tt.want {
+				if got[field] != code {
+					t.Errorf("Expected %s to fail with %s, got %q", field, code, got[field])
+				}
+			}
+		})
+	}
+
+	// Nothing was transferred
+	var account struct{ Balance float64 }
+	json.Unmarshal(doAuth(router, "GET", "/accounts/Mark", "", "").Body.Bytes(), &account)
+	if account.Balance != 100 {
+		t.Errorf("Expected invalid transfers to leave Mark with 100, got %v", account.Balance)
+	}
+}
+
+func TestTransferValidationAcceptsCents(t *testing.T) {
+	router := setupTestAPI().SetupRoutes()
+
+	for _, amount := range []string{"0.01", "19.99", "1e1", "2.50", "1000000000000"} {
+		body := `{"from": "Mark", "to": "Jane", "amount": ` + amount + `}`
+		if rr := doAuth(router, "POST", "/transfer", "", body); rr.Code == http.StatusBadRequest && strings.Contains(rr.Body.String(), "validation_failed") {
+			t.Errorf("Expected amount %s to pass validation, got %s", amount, rr.Body.String())
+		}
+	}
+}
+
+func TestTransferMalformedBody(t *testing.T) {
+	router := setupTestAPI().SetupRoutes()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"empty", ``, http.StatusBadRequest, "invalid_request"},
+		{"not JSON", `from=Mark`, http.StatusBadRequest, "invalid_request"},
+		{"array", `[]`, http.StatusBadRequest, "invalid_request"},
+		{"trailing data", `{"from": "Mark", "to": "Jane", "amount": 1} {}`, http.StatusBadRequest, "invalid_request"},
+		{"too large", `{"from": "Mark", "to": "Jane", "amount": 1, "pad": "` + strings.Repeat("x", api.MaxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, "request_too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAuth(router, "POST", "/transfer", "", tt.body)
+			if rr.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if code := errorCode(t, rr); code != tt.code {
+				t.Errorf("Expected error code %s, got %s", tt.code, code)
+			}
+		})
+	}
+}
+
+func TestCreateAccountRejectsInvalidUsername(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+
+	rr := doAuth(router, "POST", "/accounts", admin, `{"username": "bad name"}`)
+	if rr.Code != http.StatusBadRequest || errorCode(t, rr) != "invalid_username" {
+		t.Errorf("Expected 400 invalid_username, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminBodiesAreStrict(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+	createKey(t, keys, "other", auth.ScopeRead)
+
+	for _, req := range []struct{ method, path, body string }{
+		{"PUT", "/accounts/Mark/limits", `{"max_transfer": 10, "max_transer": 5}`},
+		{"PUT", "/accounts/Mark/signing", `{"owners": ["alice", "bob"], "rules": [{"signatures": 2}], "quorum": 2}`},
+		{"POST", "/admin/keys", `{"id": "new", "scopes": ["read"], "scope": "admin"}`},
+		{"POST", "/admin/keys/other/rotate", `{"overlap": "1h", "grace": "1h"}`},
+	} {
+		rr := doAuth(router, req.method, req.path, admin, req.body)
+		if rr.Code != http.StatusBadRequest || errorCode(t, rr) != "validation_failed" {
+			t.Errorf("%s %s: expected an unknown field to be refused, got %d: %s", req.method, req.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := doAuth(router, "POST", "/admin/keys/other/rotate", admin, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected rotation without a body to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminAmountsAreValidated(t *testing.T) {
+	router, keys := setupAuthAPI(t)
+	admin := createKey(t, keys, "admin", auth.ScopeAdmin)
+	transferService, accountStore := setupEscrow(time.Hour)
+	escrows := api.NewAPI(transferService, accountStore).SetupRoutes()
+
+	for _, tt := range []struct {
+		router             http.Handler
+		method, path, body string
+		field, code        string
+	}{
+		{router, "POST", "/accounts", `{"username": "Eve", "balance": "20"}`, "balance", "invalid_type"},
+		{router, "POST", "/accounts", `{"username": "Eve", "balance": 0.001}`, "balance", "too_precise"},
+		{router, "POST", "/accounts", `{"username": "Eve", "balance": -5}`, "balance", "out_of_range"},
+		{router, "PUT", "/accounts/Mark/limits", `{"max_transfer": 1e13}`, "max_transfer", "out_of_range"},
+		{router, "PUT", "/accounts/Mark/limits", `{"max_transfer": true}`, "max_transfer", "invalid_type"},
+		{escrows, "POST", "/escrows/missing/resolve", `{"payee_amount": 1.005}`, "payee_amount", "too_precise"},
+	} {
+		rr := doAuth(tt.router, tt.method, tt.path, admin, tt.body)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected 400, got %d: %s", tt.method, tt.path, tt.body, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := fieldCodes(t, rr.Body.Bytes())[tt.field]; code != tt.code {
+			t.Errorf("%s %s %s: expected %s to be %s, got %q", tt.method, tt.path, tt.body, tt.field, tt.code, code)
+		}
+	}
+
+	// Zero is allowed where it means nothing: no limit, or nothing to the payee
+	if rr := doAuth(router, "PUT", "/accounts/Mark/limits", admin, `{"max_transfer": 0}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected a zero max_transfer to remove the limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAuth(router, "POST", "/accounts", admin, `{"username": "Eve", "balance": 0}`); rr.Code != http.StatusCreated {
+		t.Errorf("Expected a zero balance to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
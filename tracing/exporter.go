@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterExporter writes each finished span as a JSON line
+type WriterExporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// NewWriterExporter exports spans to w, for example os.Stdout
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{encoder: json.NewEncoder(w)}
+}
+
+// NewFileExporter appends spans to the file at path
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := NewWriterExporter(f)
+	exporter.closer = f
+	return exporter, nil
+}
+
+// ExportSpan writes the span
+func (e *WriterExporter) ExportSpan(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.encoder.Encode(span)
+}
+
+// Close closes the underlying file, if the exporter owns one
+func (e *WriterExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// MemoryExporter keeps finished spans in memory, for tests
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan stores the span
+func (e *MemoryExporter) ExportSpan(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]SpanData(nil), e.spans...)
+}
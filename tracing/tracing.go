@@ -0,0 +1,271 @@
+// Package tracing implements lightweight OpenTelemetry-style tracing with
+// W3C trace context propagation and exporters that work offline.
+//
+// A nil *Tracer is valid and records nothing, as is the nil *Span it
+// returns, so instrumented code does not need to check whether tracing is
+// enabled.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the trace ID is non-zero
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// IsValid reports whether the span ID is non-zero
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext is the part of a span that propagates across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// ErrInvalidTraceparent is returned for malformed traceparent headers
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceparentHeader is the W3C trace context header name
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent parses a W3C traceparent header value
+// ("00-<trace-id>-<parent-id>-<flags>")
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, err
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, err
+	}
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return SpanContext{}, err
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	sc.Sampled = flags[0]&0x01 != 0
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex of exactly the destination length
+func decodeHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return ErrInvalidTraceparent
+	}
+	return nil
+}
+
+// FormatTraceparent renders a span context as a traceparent header value
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// SpanData is a finished span as handed to exporters
+type SpanData struct {
+	Name       string                 `json:"name"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	DurationMS float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Exporter receives finished spans
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+// Tracer creates spans and sends them to an exporter when they end
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer creates a tracer that exports to the given exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Close flushes and closes the exporter if it holds a resource such as a file
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	if closer, ok := t.exporter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Span is an operation being traced
+type Span struct {
+	tracer   *Tracer
+	name     string
+	context  SpanContext
+	parentID SpanID
+	start    time.Time
+
+	mutex sync.Mutex
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+// spanKey is the context key for the active span
+type spanKey struct{}
+
+// remoteKey is the context key for a span context received from a caller
+type remoteKey struct{}
+
+// ContextWithRemoteParent returns a context whose next span continues the
+// trace described by a propagated span context
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the active span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a span as a child of the active or remote parent span in ctx,
+// and returns a context in which the new span is active
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, start: time.Now()}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.context.Sampled = parent.context.Sampled
+		span.parentID = parent.context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		span.context.TraceID = remote.TraceID
+		span.context.Sampled = remote.Sampled
+		span.parentID = remote.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = true
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanContext returns the propagation context of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute records a key/value pair on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.err = err
+}
+
+// End finishes the span and exports it. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	end := time.Now()
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+
+	data := SpanData{
+		Name:       s.name,
+		TraceID:    s.context.TraceID.String(),
+		SpanID:     s.context.SpanID.String(),
+		Start:      s.start,
+		End:        end,
+		DurationMS: float64(end.Sub(s.start).Microseconds()) / 1000,
+		Attributes: s.attrs,
+	}
+	if s.parentID.IsValid() {
+		data.ParentID = s.parentID.String()
+	}
+	if s.err != nil {
+		data.Error = s.err.Error()
+	}
+	s.mutex.Unlock()
+
+	if s.context.Sampled {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}